@@ -17,8 +17,10 @@ limitations under the License.
 package v1beta1
 
 import (
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 )
 
@@ -27,6 +29,193 @@ type PhareSpec struct {
 	MicroService MicroServiceSpec `json:"microservice"`
 	Service      *v1.ServiceSpec  `json:"service,omitempty"`
 	ToolChain    *ToolChainSpec   `json:"toolchain,omitempty"`
+
+	// PartOf is the value of the app.kubernetes.io/part-of label set on every
+	// child resource. Defaults to the Phare name.
+	// +optional
+	PartOf string `json:"partOf,omitempty"`
+
+	// Propagation selects which Phare labels and annotations are copied to child
+	// resources. When unset, labels and annotations are copied to the Service only.
+	// +optional
+	Propagation *PropagationSpec `json:"propagation,omitempty"`
+
+	// Paused stops the controller from creating, changing or deleting any child
+	// resource. Status is still updated. The phare.localcorp.internal/paused
+	// annotation has the same effect.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// Suspend scales the workload to zero. The replica count it had is kept in
+	// status and restored when Suspend is cleared.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// SuspendPolicy tunes what else is removed while suspended.
+	// +optional
+	SuspendPolicy *SuspendPolicy `json:"suspendPolicy,omitempty"`
+
+	// RestartedAt triggers a rolling restart of the workload pods whenever it
+	// changes. It is copied into the phare.localcorp.internal/restartedAt pod
+	// template annotation; the annotation of the same name on the Phare, set by
+	// `kubectl phare restart`, is used when it is more recent.
+	// +optional
+	RestartedAt *metav1.Time `json:"restartedAt,omitempty"`
+
+	// Hooks run Jobs before and after the workload is rolled out.
+	// +optional
+	Hooks *HooksSpec `json:"hooks,omitempty"`
+
+	// Rollback configures the microservice revision history and rollbacks.
+	// +optional
+	Rollback *RollbackSpec `json:"rollback,omitempty"`
+
+	// Canary runs a candidate image next to the workload and shifts HTTPRoute
+	// traffic to it step by step. Requires a Deployment, spec.service and
+	// spec.toolchain.httpRoute.
+	// +optional
+	Canary *CanarySpec `json:"canary,omitempty"`
+
+	// Strategy selects how a new pod template is rolled out. RollingUpdate
+	// updates the workload in place. BlueGreen runs <name>-blue and
+	// <name>-green Deployments and switches the Phare Service between them;
+	// it requires a Deployment and spec.service. Defaults to RollingUpdate.
+	// +kubebuilder:validation:Enum=RollingUpdate;BlueGreen
+	// +optional
+	Strategy RolloutStrategy `json:"strategy,omitempty"`
+
+	// BlueGreen tunes the BlueGreen strategy.
+	// +optional
+	BlueGreen *BlueGreenSpec `json:"blueGreen,omitempty"`
+
+	// Approval holds changes to the rendered pod template until they are
+	// approved.
+	// +optional
+	Approval *ApprovalSpec `json:"approval,omitempty"`
+
+	// Maintenance limits when pod template changes of the workload are
+	// rolled out. When unset, the PhareMaintenance objects of the namespace
+	// apply.
+	// +optional
+	Maintenance *MaintenanceSpec `json:"maintenance,omitempty"`
+
+	// Schedules set the replica count on a cron schedule. The schedule that
+	// fired last wins until another one fires; before any fired,
+	// spec.microservice.replicaCount applies.
+	// +optional
+	Schedules []ReplicaSchedule `json:"schedules,omitempty"`
+
+	// ScaleOverride sets the replica count until it expires, ahead of the
+	// schedules and spec.microservice.replicaCount.
+	// +optional
+	ScaleOverride *ScaleOverride `json:"scaleOverride,omitempty"`
+
+	// DependsOn lists Phares whose condition must be True before the
+	// workload is created or updated. Until then the DependenciesNotReady
+	// condition is True and the running workload is left as it is.
+	// +optional
+	DependsOn []PhareDependency `json:"dependsOn,omitempty"`
+
+	// Templates tunes the rendering of Go templates in config values, pod
+	// annotations, probe paths, HTTPRoute hostnames, canary analysis queries
+	// and, with templates.containers, env values and args.
+	// +optional
+	Templates *TemplatesSpec `json:"templates,omitempty"`
+}
+
+// TemplatesSpec tunes the rendering of Go templates.
+type TemplatesSpec struct {
+	// Containers opts in to rendering the env values and args of all
+	// containers as templates. They are passed as they are by default, since
+	// they often hold templates meant for the application itself.
+	// +optional
+	Containers bool `json:"containers,omitempty"`
+
+	// Strict fails rendering on missing map keys, e.g. {{ .Labels.owner }}
+	// when the Phare has no owner label, instead of rendering "<no value>".
+	// +optional
+	Strict bool `json:"strict,omitempty"`
+}
+
+// HooksSpec holds the deploy hooks of a Phare.
+type HooksSpec struct {
+	// PreDeploy runs before the workload is created or updated, for example to
+	// migrate a database. The rollout waits for it and is blocked if it fails.
+	// +optional
+	PreDeploy *HookSpec `json:"preDeploy,omitempty"`
+
+	// PostDeploy runs once the workload has the desired number of available
+	// replicas, for example a smoke test.
+	// +optional
+	PostDeploy *HookSpec `json:"postDeploy,omitempty"`
+
+	// HistoryLimit is the number of finished Jobs kept per hook, including the
+	// current one. Defaults to 3.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	HistoryLimit *int32 `json:"historyLimit,omitempty"`
+}
+
+// HookSpec describes a hook Job. A hook runs once per combination of
+// microservice image and hook spec.
+type HookSpec struct {
+	// Job is the spec of the hook Job. Containers without an image run the
+	// microservice image. The schema is not expanded to keep the CRD small; the
+	// API server validates the Job when the controller creates it.
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	Job batchv1.JobSpec `json:"job"`
+}
+
+// SuspendPolicy tunes what else is removed while a Phare is suspended.
+type SuspendPolicy struct {
+	// RemoveHTTPRoute deletes the HTTPRoute while suspended so the gateway stops
+	// routing to a backend without endpoints.
+	// +optional
+	RemoveHTTPRoute bool `json:"removeHTTPRoute,omitempty"`
+}
+
+// PropagationSpec holds the label and annotation propagation rules.
+type PropagationSpec struct {
+	// +optional
+	Labels *PropagationRule `json:"labels,omitempty"`
+	// +optional
+	Annotations *PropagationRule `json:"annotations,omitempty"`
+}
+
+// PropagationTarget names a child resource that metadata can be propagated to.
+// +kubebuilder:validation:Enum=Deployment;StatefulSet;PodTemplate;Service;ConfigMap;Secret;HTTPRoute;GCPBackendPolicy;HealthCheckPolicy
+type PropagationTarget string
+
+const (
+	PropagationTargetDeployment        PropagationTarget = "Deployment"
+	PropagationTargetStatefulSet       PropagationTarget = "StatefulSet"
+	PropagationTargetPodTemplate       PropagationTarget = "PodTemplate"
+	PropagationTargetService           PropagationTarget = "Service"
+	PropagationTargetConfigMap         PropagationTarget = "ConfigMap"
+	PropagationTargetSecret            PropagationTarget = "Secret"
+	PropagationTargetHTTPRoute         PropagationTarget = "HTTPRoute"
+	PropagationTargetGCPBackendPolicy  PropagationTarget = "GCPBackendPolicy"
+	PropagationTargetHealthCheckPolicy PropagationTarget = "HealthCheckPolicy"
+)
+
+// PropagationRule selects metadata keys by prefix and the children they are copied to.
+// Keys under phare.localcorp.internal/ are controller settings and never propagated.
+type PropagationRule struct {
+	// Include lists key prefixes to copy. An empty list copies every key.
+	// +optional
+	Include []string `json:"include,omitempty"`
+
+	// Exclude lists key prefixes never copied. Exclude wins over Include.
+	// +optional
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Targets lists the children receiving the keys. An empty list targets every
+	// child except PodTemplate, which must be listed explicitly because changing
+	// pod template metadata rolls the pods.
+	// +optional
+	Targets []PropagationTarget `json:"targets,omitempty"`
 }
 
 // MicroserviceSpec contains the specifications related to the microservice.
@@ -55,6 +244,319 @@ type MicroServiceSpec struct {
 	LivenessProbe        *v1.Probe                  `json:"livenessProbe,omitempty"`
 	ReadinessProbe       *v1.Probe                  `json:"readinessProbe,omitempty"`
 	StartupProbe         *v1.Probe                  `json:"startupProbe,omitempty"`
+	// KindMigration controls how the running workload is replaced when Kind changes.
+	KindMigration *KindMigrationSpec `json:"kindMigration,omitempty"`
+	// PhareEnv sets environment variables of the main container to the
+	// address of other Phares. They are added after Env and follow changes to
+	// the ports and hostnames of the referenced Phares.
+	// +optional
+	PhareEnv []PhareEnvVar `json:"phareEnv,omitempty"`
+	// IgnoredReferences lists ConfigMaps and Secrets referenced by the
+	// containers and volumes whose changes do not roll the pods. Changes to
+	// all other referenced ConfigMaps and Secrets do.
+	// +optional
+	IgnoredReferences []ConfigReference `json:"ignoredReferences,omitempty"`
+}
+
+// ConfigReference names a ConfigMap or Secret in the namespace of the Phare.
+type ConfigReference struct {
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind string `json:"kind"`
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// PhareEnvVar is an environment variable set to the address of a Phare.
+type PhareEnvVar struct {
+	// Name of the environment variable.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	PhareRef PhareAddressRef `json:"phareRef"`
+}
+
+// PhareAddressRef selects the address of a Phare: host:port of its Service,
+// e.g. api.apps.svc.cluster.local:8080, or the first hostname of its
+// HTTPRoute.
+type PhareAddressRef struct {
+	// Name of the Phare.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Namespace of the Phare. Defaults to the namespace of the referencing Phare.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Port selects a port of spec.service by name or number. Defaults to the
+	// first port.
+	// +optional
+	Port *intstr.IntOrString `json:"port,omitempty"`
+
+	// HTTPRoute resolves to the first hostname of spec.toolchain.httpRoute
+	// instead of the Service address.
+	// +optional
+	HTTPRoute bool `json:"httpRoute,omitempty"`
+
+	// Scheme, e.g. http, is prepended as scheme:// when set.
+	// +optional
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// KindMigrationStrategy selects how a workload is replaced when its kind changes.
+type KindMigrationStrategy string
+
+const (
+	// KindMigrationRecreate deletes the old workload before creating the new one.
+	KindMigrationRecreate KindMigrationStrategy = "Recreate"
+
+	// KindMigrationCreateBeforeDelete brings the new workload up and waits for it
+	// to become available before deleting the old one.
+	KindMigrationCreateBeforeDelete KindMigrationStrategy = "CreateBeforeDelete"
+)
+
+// KindMigrationSpec configures the replacement of a Deployment by a StatefulSet
+// or vice versa.
+type KindMigrationSpec struct {
+	// Strategy defaults to Recreate.
+	// +kubebuilder:validation:Enum=Recreate;CreateBeforeDelete
+	// +optional
+	Strategy KindMigrationStrategy `json:"strategy,omitempty"`
+
+	// TimeoutSeconds bounds how long the new workload may take to become available.
+	// When it expires the new workload is removed and the old one is kept.
+	// Defaults to 600.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+}
+
+// RollbackSpec configures how failed rollouts are handled. Every applied
+// microservice spec is stored as a ControllerRevision owned by the Phare.
+type RollbackSpec struct {
+	// Automatic reapplies the last revision that became available when the
+	// rollout of a new revision fails: the Deployment exceeded its progress
+	// deadline or pods running the new image are crash-looping or cannot pull
+	// it. The failed revision is not retried until spec.microservice changes.
+	// +optional
+	Automatic bool `json:"automatic,omitempty"`
+
+	// ToRevision applies the microservice spec stored in the given revision
+	// instead of spec.microservice. Clear it to go back to spec.microservice.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ToRevision *int64 `json:"toRevision,omitempty"`
+
+	// RevisionHistoryLimit is the number of old revisions to keep. Defaults to 10.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+}
+
+// CanarySpec describes a canary release. The candidate runs in a <name>-canary
+// Deployment behind a <name>-canary Service, and HTTPRoute backendRefs pointing
+// to the Phare Service are split between both Services.
+type CanarySpec struct {
+	// Image is the candidate image.
+	Image ImageSpec `json:"image"`
+
+	// Replicas of the canary Deployment. Defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Steps are the traffic weights sent to the canary, in order. Once the last
+	// step is done the candidate is promoted: its image is copied into
+	// spec.microservice and spec.canary is removed.
+	// +kubebuilder:validation:MinItems=1
+	Steps []CanaryStep `json:"steps"`
+
+	// Abort sends all traffic back to the stable workload and scales the canary
+	// to zero.
+	// +optional
+	Abort bool `json:"abort,omitempty"`
+
+	// Analysis checks metrics while traffic is sent to the canary and before
+	// each step advances. A breached threshold aborts the canary.
+	// +optional
+	Analysis *CanaryAnalysis `json:"analysis,omitempty"`
+}
+
+// CanaryAnalysis queries a Prometheus-compatible API during a canary release.
+type CanaryAnalysis struct {
+	// Address of the Prometheus-compatible API, e.g. http://prometheus.monitoring:9090.
+	// Defaults to the --prometheus-address flag of the controller.
+	// +optional
+	Address string `json:"address,omitempty"`
+
+	// Interval between two analyses of the same step. Defaults to 1m.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// +kubebuilder:validation:MinItems=1
+	Metrics []AnalysisMetric `json:"metrics"`
+}
+
+// AnalysisMetric is a PromQL query and the range its value must stay in.
+type AnalysisMetric struct {
+	Name string `json:"name"`
+
+	// Query is an instant PromQL query returning a scalar or a single series.
+	// {{ .Name }} and {{ .Namespace }} expand to the Phare name and namespace;
+	// canary pods carry app=<name>-canary.
+	Query string `json:"query"`
+
+	// Min is the lowest accepted value, as a decimal number.
+	// +kubebuilder:validation:Pattern=`^-?[0-9]+(\.[0-9]+)?$`
+	// +optional
+	Min *string `json:"min,omitempty"`
+
+	// Max is the highest accepted value, as a decimal number.
+	// +kubebuilder:validation:Pattern=`^-?[0-9]+(\.[0-9]+)?$`
+	// +optional
+	Max *string `json:"max,omitempty"`
+}
+
+// CanaryStep is one traffic weight of a canary release.
+type CanaryStep struct {
+	// Weight is the percentage of traffic sent to the canary.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+
+	// Pause is how long the step lasts once the canary is available. When unset
+	// the step lasts until a manual promotion: a new value of the
+	// phare.localcorp.internal/promote-canary annotation, set by
+	// `kubectl phare promote`.
+	// +optional
+	Pause *metav1.Duration `json:"pause,omitempty"`
+}
+
+// RolloutStrategy is the strategy used to roll out a new pod template.
+type RolloutStrategy string
+
+const (
+	RolloutStrategyRollingUpdate RolloutStrategy = "RollingUpdate"
+	RolloutStrategyBlueGreen     RolloutStrategy = "BlueGreen"
+)
+
+// BlueGreenSpec tunes blue/green releases. A new pod template is deployed to
+// the idle color, reachable through the <name>-preview Service, and the Phare
+// Service is switched to it once all its pods are available.
+type BlueGreenSpec struct {
+	// RequireApproval holds the switch until the
+	// phare.localcorp.internal/approve-switch annotation is set to
+	// status.blueGreen.previewHash, e.g. with `kubectl phare switch`.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
+
+	// ScaleDownDelay is how long the previous color keeps running after the
+	// switch, for a fast switch back. Defaults to 30s.
+	// +optional
+	ScaleDownDelay *metav1.Duration `json:"scaleDownDelay,omitempty"`
+}
+
+// ApprovalSpec configures manual approval of workload changes.
+type ApprovalSpec struct {
+	// Required holds every change to the rendered pod template of an existing
+	// workload until it is approved, either by setting the
+	// phare.localcorp.internal/approved-hash annotation to
+	// status.approval.pendingHash or by creating a PhareApproval for that hash.
+	// Pre-deploy hooks do not run before the approval.
+	// +optional
+	Required bool `json:"required,omitempty"`
+}
+
+// MaintenanceSpec limits when pod template changes are rolled out. Changes
+// held outside the windows are reported by the RolloutDeferred condition and
+// rolled out when a window opens; other workload changes such as replicas are
+// applied right away. The phare.localcorp.internal/emergency-rollout
+// annotation lifts the limit.
+type MaintenanceSpec struct {
+	// TimeZone is the IANA time zone of the windows and freezes. Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Windows are the periods pod template changes may be rolled out in. When
+	// empty, changes may be rolled out at any time outside the freezes.
+	// +optional
+	Windows []MaintenanceWindow `json:"windows,omitempty"`
+
+	// Freezes are date ranges in which no pod template change is rolled out,
+	// even within a window.
+	// +optional
+	Freezes []FreezePeriod `json:"freezes,omitempty"`
+}
+
+// MaintenanceWindow is a recurring period in which changes may be rolled out.
+type MaintenanceWindow struct {
+	// Schedule is a cron expression (minute hour day-of-month month
+	// day-of-week) for when the window opens, e.g. "0 2 * * mon-fri".
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// Duration is how long the window stays open.
+	Duration metav1.Duration `json:"duration"`
+}
+
+// FreezePeriod is a date range in which no change is rolled out.
+type FreezePeriod struct {
+	// Start is the first frozen day, as YYYY-MM-DD.
+	// +kubebuilder:validation:Pattern=`^[0-9]{4}-[0-9]{2}-[0-9]{2}$`
+	Start string `json:"start"`
+
+	// End is the last frozen day, as YYYY-MM-DD.
+	// +kubebuilder:validation:Pattern=`^[0-9]{4}-[0-9]{2}-[0-9]{2}$`
+	End string `json:"end"`
+
+	// Reason is reported while the freeze holds a change.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// ReplicaSchedule sets the replica count each time its schedule fires.
+type ReplicaSchedule struct {
+	// Name is reported in status.scaling while the schedule is active.
+	// Defaults to the schedule expression.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Schedule is a cron expression (minute hour day-of-month month
+	// day-of-week), e.g. "0 20 * * mon-fri".
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// TimeZone is the IANA time zone of the schedule. Defaults to UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Replicas is the replica count set when the schedule fires.
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+}
+
+// ScaleOverride temporarily sets the replica count.
+type ScaleOverride struct {
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+
+	// Until is when the override expires.
+	Until metav1.Time `json:"until"`
+}
+
+// PhareDependency references a Phare that must be ready first.
+type PhareDependency struct {
+	// Name of the Phare.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Namespace of the Phare. Defaults to the namespace of the dependent.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Condition is the condition type that must be True on the Phare.
+	// Defaults to Ready.
+	// +optional
+	Condition string `json:"condition,omitempty"`
 }
 
 // ImageSpec holds information about the microservice's container image.
@@ -76,8 +578,268 @@ const (
 
 	// PharePhaseFailed means the Phare failed to reconcile correctly.
 	PharePhaseFailed PharePhase = "Failed"
+
+	// PharePhasePaused means reconciliation is paused and children are left untouched.
+	PharePhasePaused PharePhase = "Paused"
+
+	// PharePhaseSuspended means the workload is scaled to zero.
+	PharePhaseSuspended PharePhase = "Suspended"
+
+	// PharePhaseRolledBack means the workload runs an older revision than
+	// spec.microservice.
+	PharePhaseRolledBack PharePhase = "RolledBack"
 )
 
+// Condition types reported in PhareStatus.Conditions.
+const (
+	// ConditionReady is True while the workload is available and not
+	// suspended.
+	ConditionReady = "Ready"
+
+	// ConditionDependenciesNotReady is True while spec.dependsOn holds the
+	// workload.
+	ConditionDependenciesNotReady = "DependenciesNotReady"
+
+	// ConditionPreDeployHookComplete is True once the pre-deploy hook Job for the
+	// current image and hook spec succeeded.
+	ConditionPreDeployHookComplete = "PreDeployHookComplete"
+
+	// ConditionPostDeployHookComplete is True once the post-deploy hook Job for
+	// the current image and hook spec succeeded.
+	ConditionPostDeployHookComplete = "PostDeployHookComplete"
+
+	// ConditionRolloutFailed is True when the rollout of the current revision
+	// failed.
+	ConditionRolloutFailed = "RolloutFailed"
+
+	// ConditionApprovalPending is True while a pod template change waits for
+	// approval.
+	ConditionApprovalPending = "ApprovalPending"
+
+	// ConditionRolloutDeferred is True while a pod template change is held
+	// outside the maintenance windows.
+	ConditionRolloutDeferred = "RolloutDeferred"
+
+	// ConditionTemplateRenderFailed is True while a template of the spec fails
+	// to render. Nothing rendered from the spec is applied until it is fixed.
+	ConditionTemplateRenderFailed = "TemplateRenderFailed"
+
+	// ConditionConfigValidationFailed is True while a config file fails to
+	// parse or to validate against its schema. The config ConfigMaps are not
+	// updated until it is fixed.
+	ConditionConfigValidationFailed = "ConfigValidationFailed"
+
+	// ConditionConfigTooLarge is True while a config ConfigMap, or a single
+	// file when sharding, exceeds the size limit of ConfigMaps. The config
+	// ConfigMaps are not updated until it is fixed.
+	ConditionConfigTooLarge = "ConfigTooLarge"
+
+	// ConditionCanaryAnalysisInconclusive is True while the analysis of the
+	// canary step cannot be judged, e.g. Prometheus is unreachable or a
+	// metric has no data. The step waits and the analysis is retried.
+	ConditionCanaryAnalysisInconclusive = "CanaryAnalysisInconclusive"
+)
+
+// Condition reasons used by the hook conditions.
+const (
+	ReasonHookRunning   = "Running"
+	ReasonHookSucceeded = "Succeeded"
+	ReasonHookFailed    = "Failed"
+	// ReasonHookWaitingForRollout is used while the post-deploy hook waits for
+	// the workload to become available.
+	ReasonHookWaitingForRollout = "WaitingForRollout"
+)
+
+// Condition reasons used by the RolloutFailed condition.
+const (
+	ReasonProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+	ReasonPodsFailing              = "PodsFailing"
+	ReasonRolloutHealthy           = "Healthy"
+)
+
+// Condition reasons used by the ApprovalPending condition.
+const (
+	ReasonAwaitingApproval = "AwaitingApproval"
+	ReasonApproved         = "Approved"
+)
+
+// Condition reasons used by the Ready and DependenciesNotReady conditions.
+const (
+	ReasonAvailable              = "Available"
+	ReasonNotAvailable           = "NotAvailable"
+	ReasonSuspended              = "Suspended"
+	ReasonWaitingForDependencies = "WaitingForDependencies"
+	ReasonDependenciesReady      = "DependenciesReady"
+)
+
+// Condition reasons used by the RolloutDeferred condition.
+const (
+	ReasonOutsideMaintenanceWindow = "OutsideMaintenanceWindow"
+	ReasonFrozen                   = "Frozen"
+)
+
+// Condition reasons used by the TemplateRenderFailed condition.
+const (
+	ReasonRenderFailed = "RenderFailed"
+	ReasonRendered     = "Rendered"
+)
+
+// Condition reasons used by the ConfigValidationFailed condition.
+const (
+	ReasonInvalidConfig = "InvalidConfig"
+	ReasonConfigValid   = "Valid"
+)
+
+// Condition reasons used by the ConfigTooLarge condition.
+const (
+	ReasonConfigTooLarge    = "TooLarge"
+	ReasonConfigWithinLimit = "WithinLimit"
+)
+
+// Condition reasons used by the CanaryAnalysisInconclusive condition.
+const (
+	ReasonAnalysisInconclusive = "Inconclusive"
+	ReasonAnalysisConclusive   = "Conclusive"
+)
+
+// CanaryState is the state of a canary release.
+type CanaryState string
+
+const (
+	// CanaryProgressing means traffic is being shifted to the canary.
+	CanaryProgressing CanaryState = "Progressing"
+
+	// CanaryPromoting means the candidate was copied into spec.microservice and
+	// the canary is removed once the workload is available.
+	CanaryPromoting CanaryState = "Promoting"
+
+	// CanaryAborted means all traffic was sent back to the stable workload.
+	CanaryAborted CanaryState = "Aborted"
+)
+
+// CanaryStatus tracks the progress of a canary release.
+type CanaryStatus struct {
+	// Image is the candidate the release was started for. A new candidate
+	// restarts the release from the first step.
+	Image ImageSpec `json:"image"`
+
+	State CanaryState `json:"state"`
+
+	// Step is the index of the current step.
+	Step int32 `json:"step"`
+
+	// Weight is the percentage of traffic currently sent to the canary.
+	Weight int32 `json:"weight"`
+
+	// StepStartedAt is when the current step started counting its pause.
+	// +optional
+	StepStartedAt *metav1.Time `json:"stepStartedAt,omitempty"`
+
+	// LastPromotion is the last promote-canary annotation value acted upon.
+	// +optional
+	LastPromotion string `json:"lastPromotion,omitempty"`
+
+	// LastAnalysisAt is when the metrics were last checked.
+	// +optional
+	LastAnalysisAt *metav1.Time `json:"lastAnalysisAt,omitempty"`
+
+	// AnalysisFailure describes the threshold that aborted the canary. The
+	// release stays aborted until a new candidate image is set.
+	// +optional
+	AnalysisFailure string `json:"analysisFailure,omitempty"`
+}
+
+// BlueGreenState is the state of a blue/green release.
+type BlueGreenState string
+
+const (
+	// BlueGreenStable means the active color runs the current pod template.
+	BlueGreenStable BlueGreenState = "Stable"
+
+	// BlueGreenDeploying means the preview color is rolling out the current pod template.
+	BlueGreenDeploying BlueGreenState = "Deploying"
+
+	// BlueGreenAwaitingApproval means the preview color is available and the
+	// switch waits for approval.
+	BlueGreenAwaitingApproval BlueGreenState = "AwaitingApproval"
+)
+
+// BlueGreenStatus tracks the colors of a blue/green release.
+type BlueGreenStatus struct {
+	// ActiveColor is the color the Phare Service selects, blue or green. It is
+	// empty until the first color became available.
+	// +optional
+	ActiveColor string `json:"activeColor,omitempty"`
+
+	// ActiveHash is the hash of the pod template run by the active color.
+	// +optional
+	ActiveHash string `json:"activeHash,omitempty"`
+
+	// PreviewHash is the hash of the pod template deployed to the idle color
+	// and waiting to be switched to. Empty when no switch is pending.
+	// +optional
+	PreviewHash string `json:"previewHash,omitempty"`
+
+	State BlueGreenState `json:"state"`
+
+	// SwitchedAt is when the Phare Service was last switched.
+	// +optional
+	SwitchedAt *metav1.Time `json:"switchedAt,omitempty"`
+}
+
+// RollbackStatus describes the revision applied instead of spec.microservice.
+type RollbackStatus struct {
+	// Revision is the revision currently applied.
+	Revision int64 `json:"revision"`
+
+	// FailedRevision is the revision whose rollout failed. It is unset for
+	// manual rollbacks.
+	// +optional
+	FailedRevision int64 `json:"failedRevision,omitempty"`
+
+	// Reason explains why the rollback happened.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Time is when the rollback was applied.
+	Time metav1.Time `json:"time"`
+}
+
+// ApprovalStatus tracks approved and pending pod template changes.
+type ApprovalStatus struct {
+	// ApprovedHash is the hash of the last approved pod template.
+	// +optional
+	ApprovedHash string `json:"approvedHash,omitempty"`
+
+	// ApprovedBy names what approved ApprovedHash: the annotation, a
+	// PhareApproval, or the initial rollout.
+	// +optional
+	ApprovedBy string `json:"approvedBy,omitempty"`
+
+	// PendingHash is the hash of the pod template waiting for approval.
+	// +optional
+	PendingHash string `json:"pendingHash,omitempty"`
+
+	// PendingDiff shows the pending change against the running workload.
+	// +optional
+	PendingDiff string `json:"pendingDiff,omitempty"`
+}
+
+// ScalingStatus reports the replica count set by the schedules or an override.
+type ScalingStatus struct {
+	// Active is the name of the schedule setting the replica count, or
+	// "scaleOverride". It is empty while spec.microservice.replicaCount applies.
+	// +optional
+	Active string `json:"active,omitempty"`
+
+	// Replicas is the replica count Active sets.
+	Replicas int32 `json:"replicas"`
+
+	// NextTransition is when the next schedule fires or the override expires.
+	// +optional
+	NextTransition *metav1.Time `json:"nextTransition,omitempty"`
+}
+
 // PhareStatus defines the observed state of Phare.
 type PhareStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -87,6 +849,130 @@ type PhareStatus struct {
 
 	// Message provides additional information about the current phase.
 	Message string `json:"message,omitempty"`
+
+	// KindMigration tracks an in-flight or failed workload kind migration.
+	// +optional
+	KindMigration *KindMigrationStatus `json:"kindMigration,omitempty"`
+
+	// SuspendedReplicas is the replica count the workload had when it was
+	// suspended. It is restored on resume.
+	// +optional
+	SuspendedReplicas *int32 `json:"suspendedReplicas,omitempty"`
+
+	// SuspendedReplicaCount is spec.microservice.replicaCount when the Phare
+	// was suspended. When the spec value changed since, it is applied on
+	// resume instead of SuspendedReplicas.
+	// +optional
+	SuspendedReplicaCount *int32 `json:"suspendedReplicaCount,omitempty"`
+
+	// ResumedGeneration is the generation of the Phare when the workload
+	// was resumed at SuspendedReplicas. The count is kept until the spec
+	// changes.
+	// +optional
+	ResumedGeneration *int64 `json:"resumedGeneration,omitempty"`
+
+	// CurrentRevision is the revision of the microservice spec applied to the workload.
+	// +optional
+	CurrentRevision int64 `json:"currentRevision,omitempty"`
+
+	// LastGoodRevision is the latest revision that became available.
+	// +optional
+	LastGoodRevision int64 `json:"lastGoodRevision,omitempty"`
+
+	// RolledBack is set while an older revision than spec.microservice is applied.
+	// +optional
+	RolledBack *RollbackStatus `json:"rolledBack,omitempty"`
+
+	// Canary tracks the canary release, if any.
+	// +optional
+	Canary *CanaryStatus `json:"canary,omitempty"`
+
+	// BlueGreen tracks the colors of the BlueGreen strategy. It is kept after
+	// switching back to RollingUpdate until the workload is available.
+	// +optional
+	BlueGreen *BlueGreenStatus `json:"blueGreen,omitempty"`
+
+	// Approval tracks manual approval of pod template changes.
+	// +optional
+	Approval *ApprovalStatus `json:"approval,omitempty"`
+
+	// Scaling reports the schedule or override setting the replica count. It
+	// is unset when there are neither schedules nor an override.
+	// +optional
+	Scaling *ScalingStatus `json:"scaling,omitempty"`
+
+	// ConfigMapName is the config ConfigMap mounted by the pod template.
+	// +optional
+	ConfigMapName string `json:"configMapName,omitempty"`
+
+	// ConfigMapShards are the config ConfigMaps mounted by the pod template
+	// when spec.toolchain.configSharding is set, instead of ConfigMapName.
+	// +optional
+	ConfigMapShards []string `json:"configMapShards,omitempty"`
+
+	// ConfigBundles are the ConfigMaps of spec.toolchain.configs mounted by
+	// the pod template.
+	// +optional
+	ConfigBundles []ConfigBundleStatus `json:"configBundles,omitempty"`
+
+	// ConfigFrom reports the sources of spec.toolchain.configFrom.
+	// +optional
+	ConfigFrom *ConfigFromStatus `json:"configFrom,omitempty"`
+
+	// Conditions report the state of individual reconcile steps.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ConfigFromStatus reports the config fetched from spec.toolchain.configFrom.
+type ConfigFromStatus struct {
+	// GitCommit is the commit the files of spec.toolchain.configFrom.git were
+	// read at.
+	// +optional
+	GitCommit string `json:"gitCommit,omitempty"`
+
+	// LastFetchTime is when the files were last fetched.
+	// +optional
+	LastFetchTime *metav1.Time `json:"lastFetchTime,omitempty"`
+}
+
+// ConfigBundleStatus is the ConfigMap of a config bundle.
+type ConfigBundleStatus struct {
+	Name string `json:"name"`
+	// +optional
+	ConfigMapName string `json:"configMapName,omitempty"`
+	// ConfigMapShards are the ConfigMaps of the bundle when
+	// spec.toolchain.configSharding is set, instead of ConfigMapName.
+	// +optional
+	ConfigMapShards []string `json:"configMapShards,omitempty"`
+}
+
+// KindMigrationState represents the state of a workload kind migration.
+type KindMigrationState string
+
+const (
+	// KindMigrationProgressing means the new workload is not available yet.
+	KindMigrationProgressing KindMigrationState = "Progressing"
+
+	// KindMigrationFailed means the new workload did not become available in
+	// time and was removed; the old workload is still serving.
+	KindMigrationFailed KindMigrationState = "Failed"
+)
+
+// KindMigrationStatus describes a workload kind migration.
+type KindMigrationStatus struct {
+	From  string             `json:"from"`
+	To    string             `json:"to"`
+	State KindMigrationState `json:"state"`
+
+	// StartedAt is when the new workload was first created.
+	StartedAt metav1.Time `json:"startedAt"`
+
+	// ObservedGeneration is the Phare generation the migration was started for.
+	// A failed migration is retried once the generation changes.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -115,7 +1001,40 @@ func init() {
 }
 
 type ToolChainSpec struct {
-	Config            ConfigSpec             `json:"config,omitempty"`
+	Config ConfigSpec `json:"config,omitempty"`
+	// ImmutableConfig writes Config to immutable <name>-config-<hash>
+	// ConfigMaps instead of updating <name>-config in place, so that pods
+	// started mid-rollout get the config of their own pod template.
+	// +optional
+	ImmutableConfig *ImmutableConfigSpec `json:"immutableConfig,omitempty"`
+	// ConfigSharding spreads the files of each config bundle across
+	// <configmap>-0..N ConfigMaps, mounted together as a projected volume, so
+	// that the config can exceed the 1MiB limit of a ConfigMap. It cannot be
+	// used with ImmutableConfig.
+	// +optional
+	ConfigSharding *ConfigShardingSpec `json:"configSharding,omitempty"`
+	// Configs are named config bundles, each written to a
+	// <name>-config-<bundle> ConfigMap and mounted into the containers it
+	// targets. They can be used alongside Config.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Configs []ConfigBundle `json:"configs,omitempty"`
+	// ConfigFrom sources config files from outside the Phare. They are merged
+	// into Config, whose keys take precedence, and rendered like it.
+	// +optional
+	ConfigFrom *ConfigFromSpec `json:"configFrom,omitempty"`
+	// Secrets are written to the <name>-secrets Secret, mounted at
+	// /etc/phare/secrets in the main container. Values sealed for this Phare
+	// with `kubectl phare seal` ("encrypted:...") are decrypted by the
+	// controller.
+	// +optional
+	Secrets map[string]string `json:"secrets,omitempty"`
+	// ConfigSchemas validate config files against JSON Schemas stored in
+	// ConfigMaps. Files with a .json, .yaml, .yml, .toml or .properties key
+	// are always checked to parse.
+	// +optional
+	ConfigSchemas     []ConfigSchema         `json:"configSchemas,omitempty"`
 	HTTPRoute         *HTTPRouteSpec         `json:"httpRoute,omitempty"`
 	HealthCheckPolicy *HealthCheckPolicySpec `json:"healthCheckPolicy,omitempty"`
 	GCPBackendPolicy  *GCPBackendPolicySpec  `json:"gcpBackendPolicy,omitempty"`
@@ -123,6 +1042,113 @@ type ToolChainSpec struct {
 
 type ConfigSpec map[string]string
 
+// ConfigBundle is a named set of config files mounted into some containers.
+type ConfigBundle struct {
+	// Name of the bundle.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=40
+	Name string `json:"name"`
+
+	// Data are the files of the bundle. Values are Go templates, like Config,
+	// and include resolves keys of the same bundle.
+	Data map[string]string `json:"data"`
+
+	// MountPath is where the bundle is mounted in the containers.
+	// +kubebuilder:validation:MinLength=1
+	MountPath string `json:"mountPath"`
+
+	// SubPath mounts the single file of the bundle with this key, or path in
+	// Items, at MountPath instead of the whole bundle.
+	// +optional
+	SubPath string `json:"subPath,omitempty"`
+
+	// Items select the files of the bundle and their paths, as in a ConfigMap
+	// volume. All files are mounted under their key when empty.
+	// +optional
+	Items []v1.KeyToPath `json:"items,omitempty"`
+
+	// DefaultMode is the mode of the files. Defaults to 0644.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=511
+	// +optional
+	DefaultMode *int32 `json:"defaultMode,omitempty"`
+
+	// Containers are the names of the containers, init and extra containers
+	// included, the bundle is mounted into. Defaults to the main container,
+	// named after the Phare.
+	// +optional
+	Containers []string `json:"containers,omitempty"`
+}
+
+// ConfigFromSpec names the sources of config files.
+type ConfigFromSpec struct {
+	// Git fetches the files of a path of a Git repository.
+	// +optional
+	Git *GitConfigSource `json:"git,omitempty"`
+}
+
+// GitConfigSource fetches config files from a Git repository.
+type GitConfigSource struct {
+	// URL of the repository, https or ssh (ssh://... or user@host:path).
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// Ref is the branch, tag or commit SHA to fetch. Defaults to HEAD.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Path is the directory whose files are fetched, subdirectories
+	// excluded, or a single file. Defaults to the root of the repository.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// SecretRef names a Secret of the namespace holding the credentials:
+	// username and password for HTTPS, or ssh-privatekey and optionally
+	// known_hosts for SSH.
+	// +optional
+	SecretRef *v1.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// Interval between two fetches. Defaults to 5m.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// ConfigSchema validates a config file against a JSON Schema.
+type ConfigSchema struct {
+	// Bundle is the name of the config bundle of the file. Empty for
+	// spec.toolchain.config.
+	// +optional
+	Bundle string `json:"bundle,omitempty"`
+
+	// Key of the file in the config.
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+
+	// SchemaRef selects the ConfigMap key holding the schema, written in JSON
+	// or YAML. The file is not validated while an optional schema is missing.
+	SchemaRef v1.ConfigMapKeySelector `json:"schemaRef"`
+}
+
+// ImmutableConfigSpec tunes immutable config ConfigMaps.
+type ImmutableConfigSpec struct {
+	// HistoryLimit is the number of previous config ConfigMaps kept for
+	// rollbacks. ConfigMaps mounted by running ReplicaSets are always kept.
+	// Defaults to 3.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	HistoryLimit *int32 `json:"historyLimit,omitempty"`
+}
+
+// ConfigShardingSpec tunes config ConfigMap sharding.
+type ConfigShardingSpec struct {
+	// MaxSize is the maximum size in bytes of the data of a shard, keys
+	// included. Defaults to 1048576, the limit of the API server.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=1048576
+	// +optional
+	MaxSize *int32 `json:"maxSize,omitempty"`
+}
+
 type HTTPRouteSpec struct {
 	Hostnames  []gatewayv1beta1.Hostname        `json:"hostnames,omitempty"`
 	ParentRefs []gatewayv1beta1.ParentReference `json:"parentRefs,omitempty"`
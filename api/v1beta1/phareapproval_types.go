@@ -0,0 +1,60 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PhareApprovalSpec approves one pod template change of a Phare.
+type PhareApprovalSpec struct {
+	// PhareName is the Phare in the same namespace the approval is for.
+	// +kubebuilder:validation:MinLength=1
+	PhareName string `json:"phareName"`
+
+	// Hash is the approved pod template hash, as reported in
+	// status.approval.pendingHash of the Phare.
+	// +kubebuilder:validation:MinLength=1
+	Hash string `json:"hash"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:printcolumn:name="Phare",type=string,JSONPath=`.spec.phareName`
+//+kubebuilder:printcolumn:name="Hash",type=string,JSONPath=`.spec.hash`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// PhareApproval approves a pending change of a Phare with spec.approval.required.
+// Who may approve is governed by RBAC on phareapprovals.
+type PhareApproval struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PhareApprovalSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PhareApprovalList contains a list of PhareApproval.
+type PhareApprovalList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PhareApproval `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PhareApproval{}, &PhareApprovalList{})
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//+kubebuilder:object:root=true
+
+// PhareMaintenance limits when the Phares of its namespace that do not set
+// spec.maintenance roll out pod template changes. When a namespace holds
+// several, a change is rolled out only when all of them allow it.
+type PhareMaintenance struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MaintenanceSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PhareMaintenanceList contains a list of PhareMaintenance.
+type PhareMaintenanceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PhareMaintenance `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PhareMaintenance{}, &PhareMaintenanceList{})
+}
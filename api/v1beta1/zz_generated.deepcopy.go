@@ -22,10 +22,359 @@ package v1beta1
 
 import (
 	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	apisv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnalysisMetric) DeepCopyInto(out *AnalysisMetric) {
+	*out = *in
+	if in.Min != nil {
+		in, out := &in.Min, &out.Min
+		*out = new(string)
+		**out = **in
+	}
+	if in.Max != nil {
+		in, out := &in.Max, &out.Max
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnalysisMetric.
+func (in *AnalysisMetric) DeepCopy() *AnalysisMetric {
+	if in == nil {
+		return nil
+	}
+	out := new(AnalysisMetric)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApprovalSpec) DeepCopyInto(out *ApprovalSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApprovalSpec.
+func (in *ApprovalSpec) DeepCopy() *ApprovalSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ApprovalSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApprovalStatus) DeepCopyInto(out *ApprovalStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApprovalStatus.
+func (in *ApprovalStatus) DeepCopy() *ApprovalStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ApprovalStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BlueGreenSpec) DeepCopyInto(out *BlueGreenSpec) {
+	*out = *in
+	if in.ScaleDownDelay != nil {
+		in, out := &in.ScaleDownDelay, &out.ScaleDownDelay
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BlueGreenSpec.
+func (in *BlueGreenSpec) DeepCopy() *BlueGreenSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(BlueGreenSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BlueGreenStatus) DeepCopyInto(out *BlueGreenStatus) {
+	*out = *in
+	if in.SwitchedAt != nil {
+		in, out := &in.SwitchedAt, &out.SwitchedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BlueGreenStatus.
+func (in *BlueGreenStatus) DeepCopy() *BlueGreenStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BlueGreenStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryAnalysis) DeepCopyInto(out *CanaryAnalysis) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Metrics != nil {
+		in, out := &in.Metrics, &out.Metrics
+		*out = make([]AnalysisMetric, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryAnalysis.
+func (in *CanaryAnalysis) DeepCopy() *CanaryAnalysis {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryAnalysis)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanarySpec) DeepCopyInto(out *CanarySpec) {
+	*out = *in
+	out.Image = in.Image
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]CanaryStep, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Analysis != nil {
+		in, out := &in.Analysis, &out.Analysis
+		*out = new(CanaryAnalysis)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanarySpec.
+func (in *CanarySpec) DeepCopy() *CanarySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CanarySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryStatus) DeepCopyInto(out *CanaryStatus) {
+	*out = *in
+	out.Image = in.Image
+	if in.StepStartedAt != nil {
+		in, out := &in.StepStartedAt, &out.StepStartedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.LastAnalysisAt != nil {
+		in, out := &in.LastAnalysisAt, &out.LastAnalysisAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryStatus.
+func (in *CanaryStatus) DeepCopy() *CanaryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryStep) DeepCopyInto(out *CanaryStep) {
+	*out = *in
+	if in.Pause != nil {
+		in, out := &in.Pause, &out.Pause
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryStep.
+func (in *CanaryStep) DeepCopy() *CanaryStep {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryStep)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigBundle) DeepCopyInto(out *ConfigBundle) {
+	*out = *in
+	if in.Data != nil {
+		in, out := &in.Data, &out.Data
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]v1.KeyToPath, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DefaultMode != nil {
+		in, out := &in.DefaultMode, &out.DefaultMode
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Containers != nil {
+		in, out := &in.Containers, &out.Containers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigBundle.
+func (in *ConfigBundle) DeepCopy() *ConfigBundle {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigBundle)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigBundleStatus) DeepCopyInto(out *ConfigBundleStatus) {
+	*out = *in
+	if in.ConfigMapShards != nil {
+		in, out := &in.ConfigMapShards, &out.ConfigMapShards
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigBundleStatus.
+func (in *ConfigBundleStatus) DeepCopy() *ConfigBundleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigBundleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigFromSpec) DeepCopyInto(out *ConfigFromSpec) {
+	*out = *in
+	if in.Git != nil {
+		in, out := &in.Git, &out.Git
+		*out = new(GitConfigSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigFromSpec.
+func (in *ConfigFromSpec) DeepCopy() *ConfigFromSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigFromSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigFromStatus) DeepCopyInto(out *ConfigFromStatus) {
+	*out = *in
+	if in.LastFetchTime != nil {
+		in, out := &in.LastFetchTime, &out.LastFetchTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigFromStatus.
+func (in *ConfigFromStatus) DeepCopy() *ConfigFromStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigFromStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigReference) DeepCopyInto(out *ConfigReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigReference.
+func (in *ConfigReference) DeepCopy() *ConfigReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigSchema) DeepCopyInto(out *ConfigSchema) {
+	*out = *in
+	in.SchemaRef.DeepCopyInto(&out.SchemaRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigSchema.
+func (in *ConfigSchema) DeepCopy() *ConfigSchema {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigSchema)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigShardingSpec) DeepCopyInto(out *ConfigShardingSpec) {
+	*out = *in
+	if in.MaxSize != nil {
+		in, out := &in.MaxSize, &out.MaxSize
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigShardingSpec.
+func (in *ConfigShardingSpec) DeepCopy() *ConfigShardingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigShardingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in ConfigSpec) DeepCopyInto(out *ConfigSpec) {
 	{
@@ -64,6 +413,21 @@ func (in *DefaultCheck) DeepCopy() *DefaultCheck {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FreezePeriod) DeepCopyInto(out *FreezePeriod) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FreezePeriod.
+func (in *FreezePeriod) DeepCopy() *FreezePeriod {
+	if in == nil {
+		return nil
+	}
+	out := new(FreezePeriod)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GCPBackendPolicyDefaultSpec) DeepCopyInto(out *GCPBackendPolicyDefaultSpec) {
 	*out = *in
@@ -142,6 +506,31 @@ func (in *GRPCCheck) DeepCopy() *GRPCCheck {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitConfigSource) DeepCopyInto(out *GitConfigSource) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitConfigSource.
+func (in *GitConfigSource) DeepCopy() *GitConfigSource {
+	if in == nil {
+		return nil
+	}
+	out := new(GitConfigSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HTTPRouteSpec) DeepCopyInto(out *HTTPRouteSpec) {
 	*out = *in
@@ -228,12 +617,58 @@ func (in *HealthCheckPolicySpec) DeepCopy() *HealthCheckPolicySpec {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ImageSpec) DeepCopyInto(out *ImageSpec) {
+func (in *HookSpec) DeepCopyInto(out *HookSpec) {
 	*out = *in
+	in.Job.DeepCopyInto(&out.Job)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageSpec.
-func (in *ImageSpec) DeepCopy() *ImageSpec {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HookSpec.
+func (in *HookSpec) DeepCopy() *HookSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HookSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HooksSpec) DeepCopyInto(out *HooksSpec) {
+	*out = *in
+	if in.PreDeploy != nil {
+		in, out := &in.PreDeploy, &out.PreDeploy
+		*out = new(HookSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PostDeploy != nil {
+		in, out := &in.PostDeploy, &out.PostDeploy
+		*out = new(HookSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HistoryLimit != nil {
+		in, out := &in.HistoryLimit, &out.HistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HooksSpec.
+func (in *HooksSpec) DeepCopy() *HooksSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HooksSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageSpec) DeepCopyInto(out *ImageSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageSpec.
+func (in *ImageSpec) DeepCopy() *ImageSpec {
 	if in == nil {
 		return nil
 	}
@@ -242,6 +677,62 @@ func (in *ImageSpec) DeepCopy() *ImageSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImmutableConfigSpec) DeepCopyInto(out *ImmutableConfigSpec) {
+	*out = *in
+	if in.HistoryLimit != nil {
+		in, out := &in.HistoryLimit, &out.HistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImmutableConfigSpec.
+func (in *ImmutableConfigSpec) DeepCopy() *ImmutableConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ImmutableConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KindMigrationSpec) DeepCopyInto(out *KindMigrationSpec) {
+	*out = *in
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KindMigrationSpec.
+func (in *KindMigrationSpec) DeepCopy() *KindMigrationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KindMigrationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KindMigrationStatus) DeepCopyInto(out *KindMigrationStatus) {
+	*out = *in
+	in.StartedAt.DeepCopyInto(&out.StartedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KindMigrationStatus.
+func (in *KindMigrationStatus) DeepCopy() *KindMigrationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KindMigrationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *LogConfig) DeepCopyInto(out *LogConfig) {
 	*out = *in
@@ -257,6 +748,47 @@ func (in *LogConfig) DeepCopy() *LogConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceSpec) DeepCopyInto(out *MaintenanceSpec) {
+	*out = *in
+	if in.Windows != nil {
+		in, out := &in.Windows, &out.Windows
+		*out = make([]MaintenanceWindow, len(*in))
+		copy(*out, *in)
+	}
+	if in.Freezes != nil {
+		in, out := &in.Freezes, &out.Freezes
+		*out = make([]FreezePeriod, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceSpec.
+func (in *MaintenanceSpec) DeepCopy() *MaintenanceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MaintenanceWindow) DeepCopyInto(out *MaintenanceWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MaintenanceWindow.
+func (in *MaintenanceWindow) DeepCopy() *MaintenanceWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(MaintenanceWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MicroServiceSpec) DeepCopyInto(out *MicroServiceSpec) {
 	*out = *in
@@ -367,6 +899,23 @@ func (in *MicroServiceSpec) DeepCopyInto(out *MicroServiceSpec) {
 		*out = new(v1.Probe)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.KindMigration != nil {
+		in, out := &in.KindMigration, &out.KindMigration
+		*out = new(KindMigrationSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PhareEnv != nil {
+		in, out := &in.PhareEnv, &out.PhareEnv
+		*out = make([]PhareEnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.IgnoredReferences != nil {
+		in, out := &in.IgnoredReferences, &out.IgnoredReferences
+		*out = make([]ConfigReference, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MicroServiceSpec.
@@ -385,7 +934,7 @@ func (in *Phare) DeepCopyInto(out *Phare) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Phare.
@@ -406,6 +955,130 @@ func (in *Phare) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PhareAddressRef) DeepCopyInto(out *PhareAddressRef) {
+	*out = *in
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhareAddressRef.
+func (in *PhareAddressRef) DeepCopy() *PhareAddressRef {
+	if in == nil {
+		return nil
+	}
+	out := new(PhareAddressRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PhareApproval) DeepCopyInto(out *PhareApproval) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhareApproval.
+func (in *PhareApproval) DeepCopy() *PhareApproval {
+	if in == nil {
+		return nil
+	}
+	out := new(PhareApproval)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PhareApproval) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PhareApprovalList) DeepCopyInto(out *PhareApprovalList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PhareApproval, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhareApprovalList.
+func (in *PhareApprovalList) DeepCopy() *PhareApprovalList {
+	if in == nil {
+		return nil
+	}
+	out := new(PhareApprovalList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PhareApprovalList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PhareApprovalSpec) DeepCopyInto(out *PhareApprovalSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhareApprovalSpec.
+func (in *PhareApprovalSpec) DeepCopy() *PhareApprovalSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PhareApprovalSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PhareDependency) DeepCopyInto(out *PhareDependency) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhareDependency.
+func (in *PhareDependency) DeepCopy() *PhareDependency {
+	if in == nil {
+		return nil
+	}
+	out := new(PhareDependency)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PhareEnvVar) DeepCopyInto(out *PhareEnvVar) {
+	*out = *in
+	in.PhareRef.DeepCopyInto(&out.PhareRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhareEnvVar.
+func (in *PhareEnvVar) DeepCopy() *PhareEnvVar {
+	if in == nil {
+		return nil
+	}
+	out := new(PhareEnvVar)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PhareList) DeepCopyInto(out *PhareList) {
 	*out = *in
@@ -438,6 +1111,64 @@ func (in *PhareList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PhareMaintenance) DeepCopyInto(out *PhareMaintenance) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhareMaintenance.
+func (in *PhareMaintenance) DeepCopy() *PhareMaintenance {
+	if in == nil {
+		return nil
+	}
+	out := new(PhareMaintenance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PhareMaintenance) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PhareMaintenanceList) DeepCopyInto(out *PhareMaintenanceList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PhareMaintenance, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhareMaintenanceList.
+func (in *PhareMaintenanceList) DeepCopy() *PhareMaintenanceList {
+	if in == nil {
+		return nil
+	}
+	out := new(PhareMaintenanceList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PhareMaintenanceList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PhareSpec) DeepCopyInto(out *PhareSpec) {
 	*out = *in
@@ -452,6 +1183,70 @@ func (in *PhareSpec) DeepCopyInto(out *PhareSpec) {
 		*out = new(ToolChainSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Propagation != nil {
+		in, out := &in.Propagation, &out.Propagation
+		*out = new(PropagationSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SuspendPolicy != nil {
+		in, out := &in.SuspendPolicy, &out.SuspendPolicy
+		*out = new(SuspendPolicy)
+		**out = **in
+	}
+	if in.RestartedAt != nil {
+		in, out := &in.RestartedAt, &out.RestartedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = new(HooksSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Rollback != nil {
+		in, out := &in.Rollback, &out.Rollback
+		*out = new(RollbackSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(CanarySpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BlueGreen != nil {
+		in, out := &in.BlueGreen, &out.BlueGreen
+		*out = new(BlueGreenSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Approval != nil {
+		in, out := &in.Approval, &out.Approval
+		*out = new(ApprovalSpec)
+		**out = **in
+	}
+	if in.Maintenance != nil {
+		in, out := &in.Maintenance, &out.Maintenance
+		*out = new(MaintenanceSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Schedules != nil {
+		in, out := &in.Schedules, &out.Schedules
+		*out = make([]ReplicaSchedule, len(*in))
+		copy(*out, *in)
+	}
+	if in.ScaleOverride != nil {
+		in, out := &in.ScaleOverride, &out.ScaleOverride
+		*out = new(ScaleOverride)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]PhareDependency, len(*in))
+		copy(*out, *in)
+	}
+	if in.Templates != nil {
+		in, out := &in.Templates, &out.Templates
+		*out = new(TemplatesSpec)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhareSpec.
@@ -467,6 +1262,75 @@ func (in *PhareSpec) DeepCopy() *PhareSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PhareStatus) DeepCopyInto(out *PhareStatus) {
 	*out = *in
+	if in.KindMigration != nil {
+		in, out := &in.KindMigration, &out.KindMigration
+		*out = new(KindMigrationStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SuspendedReplicas != nil {
+		in, out := &in.SuspendedReplicas, &out.SuspendedReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SuspendedReplicaCount != nil {
+		in, out := &in.SuspendedReplicaCount, &out.SuspendedReplicaCount
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ResumedGeneration != nil {
+		in, out := &in.ResumedGeneration, &out.ResumedGeneration
+		*out = new(int64)
+		**out = **in
+	}
+	if in.RolledBack != nil {
+		in, out := &in.RolledBack, &out.RolledBack
+		*out = new(RollbackStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(CanaryStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BlueGreen != nil {
+		in, out := &in.BlueGreen, &out.BlueGreen
+		*out = new(BlueGreenStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Approval != nil {
+		in, out := &in.Approval, &out.Approval
+		*out = new(ApprovalStatus)
+		**out = **in
+	}
+	if in.Scaling != nil {
+		in, out := &in.Scaling, &out.Scaling
+		*out = new(ScalingStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigMapShards != nil {
+		in, out := &in.ConfigMapShards, &out.ConfigMapShards
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ConfigBundles != nil {
+		in, out := &in.ConfigBundles, &out.ConfigBundles
+		*out = make([]ConfigBundleStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ConfigFrom != nil {
+		in, out := &in.ConfigFrom, &out.ConfigFrom
+		*out = new(ConfigFromStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PhareStatus.
@@ -479,6 +1343,167 @@ func (in *PhareStatus) DeepCopy() *PhareStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PropagationRule) DeepCopyInto(out *PropagationRule) {
+	*out = *in
+	if in.Include != nil {
+		in, out := &in.Include, &out.Include
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make([]PropagationTarget, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PropagationRule.
+func (in *PropagationRule) DeepCopy() *PropagationRule {
+	if in == nil {
+		return nil
+	}
+	out := new(PropagationRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PropagationSpec) DeepCopyInto(out *PropagationSpec) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = new(PropagationRule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = new(PropagationRule)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PropagationSpec.
+func (in *PropagationSpec) DeepCopy() *PropagationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PropagationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReplicaSchedule) DeepCopyInto(out *ReplicaSchedule) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReplicaSchedule.
+func (in *ReplicaSchedule) DeepCopy() *ReplicaSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(ReplicaSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RollbackSpec) DeepCopyInto(out *RollbackSpec) {
+	*out = *in
+	if in.ToRevision != nil {
+		in, out := &in.ToRevision, &out.ToRevision
+		*out = new(int64)
+		**out = **in
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RollbackSpec.
+func (in *RollbackSpec) DeepCopy() *RollbackSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RollbackSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RollbackStatus) DeepCopyInto(out *RollbackStatus) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RollbackStatus.
+func (in *RollbackStatus) DeepCopy() *RollbackStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RollbackStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScaleOverride) DeepCopyInto(out *ScaleOverride) {
+	*out = *in
+	in.Until.DeepCopyInto(&out.Until)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScaleOverride.
+func (in *ScaleOverride) DeepCopy() *ScaleOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(ScaleOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScalingStatus) DeepCopyInto(out *ScalingStatus) {
+	*out = *in
+	if in.NextTransition != nil {
+		in, out := &in.NextTransition, &out.NextTransition
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalingStatus.
+func (in *ScalingStatus) DeepCopy() *ScalingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ScalingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SuspendPolicy) DeepCopyInto(out *SuspendPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SuspendPolicy.
+func (in *SuspendPolicy) DeepCopy() *SuspendPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SuspendPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TargetRef) DeepCopyInto(out *TargetRef) {
 	*out = *in
@@ -494,6 +1519,21 @@ func (in *TargetRef) DeepCopy() *TargetRef {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplatesSpec) DeepCopyInto(out *TemplatesSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplatesSpec.
+func (in *TemplatesSpec) DeepCopy() *TemplatesSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplatesSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ToolChainSpec) DeepCopyInto(out *ToolChainSpec) {
 	*out = *in
@@ -504,6 +1544,42 @@ func (in *ToolChainSpec) DeepCopyInto(out *ToolChainSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.ImmutableConfig != nil {
+		in, out := &in.ImmutableConfig, &out.ImmutableConfig
+		*out = new(ImmutableConfigSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigSharding != nil {
+		in, out := &in.ConfigSharding, &out.ConfigSharding
+		*out = new(ConfigShardingSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Configs != nil {
+		in, out := &in.Configs, &out.Configs
+		*out = make([]ConfigBundle, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ConfigFrom != nil {
+		in, out := &in.ConfigFrom, &out.ConfigFrom
+		*out = new(ConfigFromSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Secrets != nil {
+		in, out := &in.Secrets, &out.Secrets
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ConfigSchemas != nil {
+		in, out := &in.ConfigSchemas, &out.ConfigSchemas
+		*out = make([]ConfigSchema, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.HTTPRoute != nil {
 		in, out := &in.HTTPRoute, &out.HTTPRoute
 		*out = new(HTTPRouteSpec)
@@ -0,0 +1,441 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-phare is a kubectl plugin for day-2 operations on Phare resources.
+//
+//	kubectl phare restart NAME [-n NAMESPACE]
+//	kubectl phare rollback NAME --to-revision N [-n NAMESPACE]
+//	kubectl phare promote NAME [-n NAMESPACE]
+//	kubectl phare switch NAME [-n NAMESPACE]
+//	kubectl phare approve NAME [-n NAMESPACE]
+//	kubectl phare scale NAME --replicas N --for DURATION [-n NAMESPACE]
+//	kubectl phare seal --key-file PATH --key-id ID --namespace NAMESPACE --name NAME [VALUE]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	"github.com/localcorp/phare-controller/pkg/seal"
+)
+
+// These annotations must match the ones read by the controller.
+const (
+	restartedAtAnnotation   = "phare.localcorp.internal/restartedAt"
+	promoteCanaryAnnotation = "phare.localcorp.internal/promote-canary"
+	approveSwitchAnnotation = "phare.localcorp.internal/approve-switch"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "restart":
+		err = restart(os.Args[2:])
+	case "rollback":
+		err = rollback(os.Args[2:])
+	case "promote":
+		err = promote(os.Args[2:])
+	case "switch":
+		err = switchColor(os.Args[2:])
+	case "approve":
+		err = approve(os.Args[2:])
+	case "scale":
+		err = scale(os.Args[2:])
+	case "seal":
+		err = sealValue(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  kubectl phare restart NAME [-n NAMESPACE] [--kubeconfig PATH]")
+	fmt.Fprintln(os.Stderr, "  kubectl phare rollback NAME --to-revision N [-n NAMESPACE] [--kubeconfig PATH]")
+	fmt.Fprintln(os.Stderr, "      --to-revision 0 returns to spec.microservice.")
+	fmt.Fprintln(os.Stderr, "  kubectl phare promote NAME [-n NAMESPACE] [--kubeconfig PATH]")
+	fmt.Fprintln(os.Stderr, "  kubectl phare switch NAME [-n NAMESPACE] [--kubeconfig PATH]")
+	fmt.Fprintln(os.Stderr, "  kubectl phare approve NAME [-n NAMESPACE] [--kubeconfig PATH]")
+	fmt.Fprintln(os.Stderr, "  kubectl phare scale NAME --replicas N --for DURATION [-n NAMESPACE] [--kubeconfig PATH]")
+	fmt.Fprintln(os.Stderr, "      --for 0 removes the override.")
+	fmt.Fprintln(os.Stderr, "  kubectl phare seal --key-file PATH --key-id ID --namespace NAMESPACE --name NAME [VALUE]")
+	fmt.Fprintln(os.Stderr, "      Encrypts VALUE, or stdin, for spec.toolchain.secrets; no cluster access is needed.")
+}
+
+// restart stamps the Phare with the current time so the controller rolls its pods.
+func restart(args []string) error {
+	name, err := stampAnnotation("restart", restartedAtAnnotation, time.RFC3339, args)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("phare.%s/%s restarted\n", pharev1beta1.GroupVersion.Group, name)
+	return nil
+}
+
+// promote advances the canary of the Phare by one step.
+func promote(args []string) error {
+	// Nanoseconds keep two promotions within the same second distinct.
+	name, err := stampAnnotation("promote", promoteCanaryAnnotation, time.RFC3339Nano, args)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("phare.%s/%s canary promoted\n", pharev1beta1.GroupVersion.Group, name)
+	return nil
+}
+
+// stampAnnotation sets annotation to the current time, formatted with layout,
+// on the Phare named in args and returns its name.
+func stampAnnotation(command, annotation, layout string, args []string) (string, error) {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	namespace := fs.String("n", "", "Namespace of the Phare. Defaults to the kubeconfig context namespace.")
+	kubeconfig := fs.String("kubeconfig", "", "Path to the kubeconfig file.")
+	if err := fs.Parse(reorderFlags(args)); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		return "", fmt.Errorf("expected exactly one Phare name, got %d", fs.NArg())
+	}
+	name := fs.Arg(0)
+
+	c, ns, err := newClient(*kubeconfig, *namespace)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.Background()
+	phare := &pharev1beta1.Phare{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: ns}, phare); err != nil {
+		return "", err
+	}
+	patch := client.MergeFrom(phare.DeepCopy())
+	annotations := phare.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[annotation] = time.Now().UTC().Format(layout)
+	phare.SetAnnotations(annotations)
+	return name, c.Patch(ctx, phare, patch)
+}
+
+// switchColor approves the pending blue/green switch of the Phare.
+func switchColor(args []string) error {
+	fs := flag.NewFlagSet("switch", flag.ExitOnError)
+	namespace := fs.String("n", "", "Namespace of the Phare. Defaults to the kubeconfig context namespace.")
+	kubeconfig := fs.String("kubeconfig", "", "Path to the kubeconfig file.")
+	if err := fs.Parse(reorderFlags(args)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected exactly one Phare name, got %d", fs.NArg())
+	}
+	name := fs.Arg(0)
+
+	c, ns, err := newClient(*kubeconfig, *namespace)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	phare := &pharev1beta1.Phare{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: ns}, phare); err != nil {
+		return err
+	}
+	st := phare.Status.BlueGreen
+	if st == nil || st.PreviewHash == "" {
+		return fmt.Errorf("phare %s has no pending blue/green switch", name)
+	}
+	// Approving the hash rather than a color keeps a stale approval from
+	// switching to a later pod template.
+	patch := client.MergeFrom(phare.DeepCopy())
+	annotations := phare.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[approveSwitchAnnotation] = st.PreviewHash
+	phare.SetAnnotations(annotations)
+	if err := c.Patch(ctx, phare, patch); err != nil {
+		return err
+	}
+
+	fmt.Printf("phare.%s/%s switch to pod template %s approved\n", pharev1beta1.GroupVersion.Group, name, st.PreviewHash)
+	return nil
+}
+
+// approve creates a PhareApproval for the pending pod template change of the
+// Phare. Unlike the approved-hash annotation it needs no write access to the
+// Phare, only RBAC to create phareapprovals.
+func approve(args []string) error {
+	fs := flag.NewFlagSet("approve", flag.ExitOnError)
+	namespace := fs.String("n", "", "Namespace of the Phare. Defaults to the kubeconfig context namespace.")
+	kubeconfig := fs.String("kubeconfig", "", "Path to the kubeconfig file.")
+	if err := fs.Parse(reorderFlags(args)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected exactly one Phare name, got %d", fs.NArg())
+	}
+	name := fs.Arg(0)
+
+	c, ns, err := newClient(*kubeconfig, *namespace)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	phare := &pharev1beta1.Phare{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: ns}, phare); err != nil {
+		return err
+	}
+	st := phare.Status.Approval
+	if st == nil || st.PendingHash == "" {
+		return fmt.Errorf("phare %s has no change waiting for approval", name)
+	}
+	fmt.Println(st.PendingDiff)
+
+	approval := &pharev1beta1.PhareApproval{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name + "-" + st.PendingHash,
+			Namespace: ns,
+		},
+		Spec: pharev1beta1.PhareApprovalSpec{
+			PhareName: name,
+			Hash:      st.PendingHash,
+		},
+	}
+	if err := c.Create(ctx, approval); err != nil {
+		return err
+	}
+
+	fmt.Printf("phare.%s/%s pod template %s approved\n", pharev1beta1.GroupVersion.Group, name, st.PendingHash)
+	return nil
+}
+
+// scale sets spec.scaleOverride to run the given replicas for a while, or
+// removes it.
+func scale(args []string) error {
+	fs := flag.NewFlagSet("scale", flag.ExitOnError)
+	namespace := fs.String("n", "", "Namespace of the Phare. Defaults to the kubeconfig context namespace.")
+	kubeconfig := fs.String("kubeconfig", "", "Path to the kubeconfig file.")
+	replicas := fs.Int("replicas", -1, "Replica count to run.")
+	duration := fs.Duration("for", -1, "How long the override lasts, e.g. 2h; 0 removes it.")
+	if err := fs.Parse(reorderFlags(args)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected exactly one Phare name, got %d", fs.NArg())
+	}
+	if *duration < 0 {
+		return fmt.Errorf("--for is required")
+	}
+	if *duration > 0 && *replicas < 0 {
+		return fmt.Errorf("--replicas is required")
+	}
+	name := fs.Arg(0)
+
+	c, ns, err := newClient(*kubeconfig, *namespace)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	phare := &pharev1beta1.Phare{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: ns}, phare); err != nil {
+		return err
+	}
+	patch := client.MergeFrom(phare.DeepCopy())
+	until := metav1.NewTime(time.Now().Add(*duration))
+	if *duration == 0 {
+		phare.Spec.ScaleOverride = nil
+	} else {
+		phare.Spec.ScaleOverride = &pharev1beta1.ScaleOverride{
+			Replicas: int32(*replicas),
+			Until:    until,
+		}
+	}
+	if err := c.Patch(ctx, phare, patch); err != nil {
+		return err
+	}
+
+	if *duration == 0 {
+		fmt.Printf("phare.%s/%s scale override removed\n", pharev1beta1.GroupVersion.Group, name)
+	} else {
+		fmt.Printf("phare.%s/%s scaled to %d replicas until %s\n", pharev1beta1.GroupVersion.Group, name, *replicas, until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// sealValue encrypts a value offline for spec.toolchain.secrets of a Phare
+// with a key of the controller's encryption keys Secret. Only that Phare can
+// use the value.
+func sealValue(args []string) error {
+	fs := flag.NewFlagSet("seal", flag.ExitOnError)
+	keyFile := fs.String("key-file", "", "Path to the key, 32 bytes raw or base64 encoded.")
+	keyID := fs.String("key-id", "", "Id of the key: its key in the encryption keys Secret.")
+	namespace := fs.String("namespace", "", "Namespace of the Phare the value is sealed for.")
+	name := fs.String("name", "", "Name of the Phare the value is sealed for.")
+	if err := fs.Parse(reorderFlags(args)); err != nil {
+		return err
+	}
+	if *keyFile == "" || *keyID == "" || *namespace == "" || *name == "" {
+		return fmt.Errorf("--key-file, --key-id, --namespace and --name are required")
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("expected at most one value, got %d", fs.NArg())
+	}
+
+	keyData, err := os.ReadFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	key, err := seal.ParseKey(keyData)
+	if err != nil {
+		return err
+	}
+	var value []byte
+	if fs.NArg() == 1 {
+		value = []byte(fs.Arg(0))
+	} else {
+		if value, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+		// Drop the new line added by echo.
+		value = []byte(strings.TrimSuffix(string(value), "\n"))
+	}
+
+	sealed, err := seal.Seal(value, seal.Scope{Namespace: *namespace, Name: *name}, *keyID, key)
+	if err != nil {
+		return err
+	}
+	fmt.Println(sealed)
+	return nil
+}
+
+// rollback points spec.rollback.toRevision at a stored revision, or clears it.
+func rollback(args []string) error {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	namespace := fs.String("n", "", "Namespace of the Phare. Defaults to the kubeconfig context namespace.")
+	kubeconfig := fs.String("kubeconfig", "", "Path to the kubeconfig file.")
+	toRevision := fs.Int64("to-revision", -1, "Revision to roll back to; 0 returns to spec.microservice.")
+	if err := fs.Parse(reorderFlags(args)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected exactly one Phare name, got %d", fs.NArg())
+	}
+	if *toRevision < 0 {
+		return fmt.Errorf("--to-revision is required")
+	}
+	name := fs.Arg(0)
+
+	c, ns, err := newClient(*kubeconfig, *namespace)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	phare := &pharev1beta1.Phare{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: ns}, phare); err != nil {
+		return err
+	}
+	patch := client.MergeFrom(phare.DeepCopy())
+	if phare.Spec.Rollback == nil {
+		phare.Spec.Rollback = &pharev1beta1.RollbackSpec{}
+	}
+	if *toRevision == 0 {
+		phare.Spec.Rollback.ToRevision = nil
+	} else {
+		phare.Spec.Rollback.ToRevision = toRevision
+	}
+	if err := c.Patch(ctx, phare, patch); err != nil {
+		return err
+	}
+
+	if *toRevision == 0 {
+		fmt.Printf("phare.%s/%s returned to spec.microservice\n", pharev1beta1.GroupVersion.Group, name)
+	} else {
+		fmt.Printf("phare.%s/%s rolled back to revision %d\n", pharev1beta1.GroupVersion.Group, name, *toRevision)
+	}
+	return nil
+}
+
+// newClient builds a client from the kubeconfig and resolves the namespace,
+// defaulting to the one of the current context.
+func newClient(kubeconfig, namespace string) (client.Client, string, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+	if namespace == "" {
+		ns, _, err := clientConfig.Namespace()
+		if err != nil {
+			return nil, "", err
+		}
+		namespace = ns
+	}
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+
+	scheme := runtime.NewScheme()
+	if err := pharev1beta1.AddToScheme(scheme); err != nil {
+		return nil, "", err
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, "", err
+	}
+	return c, namespace, nil
+}
+
+// reorderFlags moves positional arguments after flags so that both
+// `restart NAME -n ns` and `restart -n ns NAME` work with the flag package.
+func reorderFlags(args []string) []string {
+	var flags, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) > 1 && arg[0] == '-' {
+			flags = append(flags, arg)
+			if !strings.Contains(arg, "=") && i+1 < len(args) {
+				flags = append(flags, args[i+1])
+				i++
+			}
+			continue
+		}
+		positional = append(positional, arg)
+	}
+	return append(flags, positional...)
+}
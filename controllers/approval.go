@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	"github.com/localcorp/phare-controller/pkg/yamldiff"
+)
+
+const (
+	// approvedHashAnnotation approves the pod template with the given hash.
+	approvedHashAnnotation = "phare.localcorp.internal/approved-hash"
+
+	// maxPendingDiffLength keeps large diffs from bloating the Phare status.
+	maxPendingDiffLength = 4096
+)
+
+// awaitApproval reports whether the rollout of the current pod template is
+// held because it still needs an approval. The first rollout of a Phare, and
+// rollbacks to a stored revision, do not need one. During a canary release
+// the pod template to approve is the promoted candidate, so one approval
+// covers the canary, the workload changes in its diff and the promotion.
+func (r *PhareReconciler) awaitApproval(ctx context.Context, phare *pharev1beta1.Phare) (bool, error) {
+	if phare.Spec.Approval == nil || !phare.Spec.Approval.Required {
+		phare.Status.Approval = nil
+		apimeta.RemoveStatusCondition(&phare.Status.Conditions, pharev1beta1.ConditionApprovalPending)
+		return false, nil
+	}
+	if phare.Status.Approval == nil {
+		phare.Status.Approval = &pharev1beta1.ApprovalStatus{}
+	}
+	st := phare.Status.Approval
+
+	preview := phare
+	if canary := phare.Spec.Canary; canary != nil && !canary.Abort {
+		preview = phare.DeepCopy()
+		preview.Spec.MicroService.Image = canary.Image
+	}
+	hash, diff, running, err := r.rolloutPreview(ctx, preview)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case hash == st.ApprovedHash:
+		r.approve(phare, hash, st.ApprovedBy)
+		return false, nil
+	case !running && st.ApprovedHash == "":
+		r.approve(phare, hash, "initial rollout")
+		return false, nil
+	case phare.Status.RolledBack != nil:
+		r.approve(phare, hash, fmt.Sprintf("rollback to revision %d", phare.Status.RolledBack.Revision))
+		return false, nil
+	}
+
+	approvedBy, err := r.findApproval(ctx, phare, hash)
+	if err != nil {
+		return false, err
+	}
+	if approvedBy != "" {
+		r.approve(phare, hash, approvedBy)
+		return false, nil
+	}
+
+	if st.PendingHash != hash {
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "ApprovalRequired", "Pod template %s is waiting for approval", hash)
+	}
+	if len(diff) > maxPendingDiffLength {
+		diff = diff[:maxPendingDiffLength] + "\n... (truncated)"
+	}
+	st.PendingHash = hash
+	st.PendingDiff = diff
+	apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+		Type:    pharev1beta1.ConditionApprovalPending,
+		Status:  metav1.ConditionTrue,
+		Reason:  pharev1beta1.ReasonAwaitingApproval,
+		Message: fmt.Sprintf("Pod template %s is waiting for approval", hash),
+	})
+	return true, nil
+}
+
+// approvalPending reports whether awaitApproval held the pod template change.
+func approvalPending(phare *pharev1beta1.Phare) bool {
+	return apimeta.IsStatusConditionTrue(phare.Status.Conditions, pharev1beta1.ConditionApprovalPending)
+}
+
+// approve records hash as the approved pod template.
+func (r *PhareReconciler) approve(phare *pharev1beta1.Phare, hash, approvedBy string) {
+	st := phare.Status.Approval
+	if st.ApprovedHash != hash {
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "Approved", "Pod template %s approved by %s", hash, approvedBy)
+	}
+	st.ApprovedHash = hash
+	st.ApprovedBy = approvedBy
+	st.PendingHash = ""
+	st.PendingDiff = ""
+	apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+		Type:    pharev1beta1.ConditionApprovalPending,
+		Status:  metav1.ConditionFalse,
+		Reason:  pharev1beta1.ReasonApproved,
+		Message: fmt.Sprintf("Pod template %s approved by %s", hash, approvedBy),
+	})
+}
+
+// findApproval describes what approved hash, or returns "" if nothing did.
+func (r *PhareReconciler) findApproval(ctx context.Context, phare *pharev1beta1.Phare, hash string) (string, error) {
+	if phare.Annotations[approvedHashAnnotation] == hash {
+		return "annotation " + approvedHashAnnotation, nil
+	}
+	approvals := &pharev1beta1.PhareApprovalList{}
+	if err := r.List(ctx, approvals, client.InNamespace(phare.Namespace)); err != nil {
+		return "", err
+	}
+	for _, approval := range approvals.Items {
+		if approval.Spec.PhareName == phare.Name && approval.Spec.Hash == hash && approval.DeletionTimestamp.IsZero() {
+			return "PhareApproval " + approval.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// rolloutPreview returns the hash of the pod template the reconcile would roll
+// out and its diff against the running workload. running is false when there
+// is no workload yet.
+func (r *PhareReconciler) rolloutPreview(ctx context.Context, phare *pharev1beta1.Phare) (hash, diff string, running bool, err error) {
+	var current, next *corev1.PodTemplateSpec
+	switch phare.Spec.MicroService.Kind {
+	case "Deployment":
+		desired := r.newDeployment(phare)
+		if desired == nil {
+			return "", "", false, fmt.Errorf("failed to build desired Deployment for %s/%s", phare.Namespace, phare.Name)
+		}
+		if err := r.setConfigChecksum(ctx, phare, &desired.Spec.Template); err != nil {
+			return "", "", false, err
+		}
+		hash = templateHash(&desired.Spec.Template)
+		if color := activeColor(phare); isBlueGreen(phare) && color != "" {
+			desired = colorDeployment(phare, desired, color, hash)
+		}
+		existing := &appsv1.Deployment{}
+		if err := r.Get(ctx, client.ObjectKey{Name: workloadName(phare), Namespace: phare.Namespace}, existing); err != nil {
+			if errors.IsNotFound(err) {
+				return hash, "", false, nil
+			}
+			return "", "", false, err
+		}
+		merged := existing.DeepCopy()
+		r.mergeDeployments(desired, merged)
+		current, next = &existing.Spec.Template, &merged.Spec.Template
+	case "StatefulSet":
+		desired := r.newStatefulSet(phare)
+		if desired == nil {
+			return "", "", false, fmt.Errorf("failed to build desired StatefulSet for %s/%s", phare.Namespace, phare.Name)
+		}
+		if err := r.setConfigChecksum(ctx, phare, &desired.Spec.Template); err != nil {
+			return "", "", false, err
+		}
+		hash = templateHash(&desired.Spec.Template)
+		existing := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, client.ObjectKey{Name: phare.Name, Namespace: phare.Namespace}, existing); err != nil {
+			if errors.IsNotFound(err) {
+				return hash, "", false, nil
+			}
+			return "", "", false, err
+		}
+		merged := existing.DeepCopy()
+		r.mergeStatefulSets(desired, merged)
+		current, next = &existing.Spec.Template, &merged.Spec.Template
+	default:
+		return "", "", false, fmt.Errorf("unsupported kind: %s", phare.Spec.MicroService.Kind)
+	}
+
+	diff, err = templateDiff(next, current)
+	return hash, diff, true, err
+}
+
+// templateDiff diffs two pod templates with pkg/yamldiff. Comparing the
+// running template with the one merged into it keeps server-side defaults out
+// of the diff.
+func templateDiff(desired, current *corev1.PodTemplateSpec) (string, error) {
+	// JSON is valid YAML and keeps the field names of the API.
+	desiredJSON, err := json.Marshal(desired)
+	if err != nil {
+		return "", err
+	}
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return "", err
+	}
+	return yamldiff.Changes(string(desiredJSON), string(currentJSON))
+}
+
+// approvalToPhare maps a PhareApproval to the Phare it approves.
+func approvalToPhare(_ context.Context, obj client.Object) []reconcile.Request {
+	approval, ok := obj.(*pharev1beta1.PhareApproval)
+	if !ok || approval.Spec.PhareName == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: approval.Spec.PhareName, Namespace: approval.Namespace}}}
+}
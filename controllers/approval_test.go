@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func approvalPhare() *pharev1beta1.Phare {
+	phare := basePhare("demo", "default")
+	phare.Spec.Approval = &pharev1beta1.ApprovalSpec{Required: true}
+	return phare
+}
+
+func TestApprovalHoldsChangeUntilAnnotated(t *testing.T) {
+	f := newReconcileFixture(t, approvalPhare())
+
+	got := f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:latest" {
+		t.Fatalf("expected the initial rollout without approval, got %q", img)
+	}
+	if got.Status.Approval == nil || got.Status.Approval.ApprovedHash == "" {
+		t.Fatalf("expected the initial pod template to be approved, got %+v", got.Status.Approval)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.MicroService.Image.Tag = "v2" })
+	got = f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:latest" {
+		t.Fatalf("expected the change to be held, got %q", img)
+	}
+	st := got.Status.Approval
+	if st.PendingHash == "" || st.PendingHash == st.ApprovedHash {
+		t.Fatalf("expected a pending hash, got %+v", st)
+	}
+	if !strings.Contains(st.PendingDiff, `-       image: "nginx:latest"`) || !strings.Contains(st.PendingDiff, `+       image: "nginx:v2"`) {
+		t.Fatalf("expected the image change in the pending diff, got:\n%s", st.PendingDiff)
+	}
+	if !apimeta.IsStatusConditionTrue(got.Status.Conditions, pharev1beta1.ConditionApprovalPending) {
+		t.Fatalf("expected ApprovalPending condition, got %+v", got.Status.Conditions)
+	}
+	if got.Status.Phase != pharev1beta1.PharePhaseReconciling {
+		t.Fatalf("expected phase Reconciling, got %s", got.Status.Phase)
+	}
+
+	// An approval of another pod template does not apply.
+	f.update(func(p *pharev1beta1.Phare) { p.Annotations = map[string]string{approvedHashAnnotation: "0000000000"} })
+	f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:latest" {
+		t.Fatalf("expected a mismatched approval to be ignored, got %q", img)
+	}
+
+	hash := st.PendingHash
+	f.update(func(p *pharev1beta1.Phare) { p.Annotations = map[string]string{approvedHashAnnotation: hash} })
+	got = f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:v2" {
+		t.Fatalf("expected the approved change to roll out, got %q", img)
+	}
+	if got.Status.Approval.ApprovedHash != hash || got.Status.Approval.PendingHash != "" {
+		t.Fatalf("expected %s to be approved, got %+v", hash, got.Status.Approval)
+	}
+	if apimeta.IsStatusConditionTrue(got.Status.Conditions, pharev1beta1.ConditionApprovalPending) {
+		t.Fatalf("expected ApprovalPending to be cleared")
+	}
+}
+
+func TestApprovalAcceptsPhareApproval(t *testing.T) {
+	f := newReconcileFixture(t, approvalPhare())
+	f.reconcile()
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.MicroService.Image.Tag = "v2" })
+	got := f.reconcile()
+	hash := got.Status.Approval.PendingHash
+
+	for _, approval := range []*pharev1beta1.PhareApproval{
+		{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}, Spec: pharev1beta1.PhareApprovalSpec{PhareName: "other", Hash: hash}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "demo-approval", Namespace: "default"}, Spec: pharev1beta1.PhareApprovalSpec{PhareName: "demo", Hash: hash}},
+	} {
+		if err := f.r.Create(f.ctx, approval); err != nil {
+			t.Fatalf("create approval: %v", err)
+		}
+	}
+
+	got = f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:v2" {
+		t.Fatalf("expected the approved change to roll out, got %q", img)
+	}
+	if got.Status.Approval.ApprovedBy != "PhareApproval demo-approval" {
+		t.Fatalf("expected the approval to be recorded, got %q", got.Status.Approval.ApprovedBy)
+	}
+}
+
+func TestApprovalTurnedOffAppliesPendingChange(t *testing.T) {
+	f := newReconcileFixture(t, approvalPhare())
+	f.reconcile()
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.MicroService.Image.Tag = "v2" })
+	f.reconcile()
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.Approval = nil })
+	got := f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:v2" {
+		t.Fatalf("expected the change to roll out, got %q", img)
+	}
+	if got.Status.Approval != nil || apimeta.FindStatusCondition(got.Status.Conditions, pharev1beta1.ConditionApprovalPending) != nil {
+		t.Fatalf("expected approval status to be cleared, got %+v", got.Status)
+	}
+}
+
+func TestApprovalPendingStillScalesWorkload(t *testing.T) {
+	f := newReconcileFixture(t, approvalPhare())
+	f.reconcile()
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.MicroService.Image.Tag = "v2"
+		p.Spec.MicroService.ReplicaCount = 3
+	})
+	got := f.reconcile()
+	if !apimeta.IsStatusConditionTrue(got.Status.Conditions, pharev1beta1.ConditionApprovalPending) {
+		t.Fatalf("expected ApprovalPending condition, got %+v", got.Status.Conditions)
+	}
+	if img := f.deploymentImage("demo"); img != "nginx:latest" {
+		t.Fatalf("expected the pod template change to be held, got %q", img)
+	}
+	deploy := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if *deploy.Spec.Replicas != 3 {
+		t.Fatalf("expected the replica change to apply while the approval is pending, got %d", *deploy.Spec.Replicas)
+	}
+}
+
+func TestApprovalHoldsCanary(t *testing.T) {
+	phare := canaryPhare()
+	canary := phare.Spec.Canary
+	phare.Spec.Canary = nil
+	phare.Spec.Approval = &pharev1beta1.ApprovalSpec{Required: true}
+	f := newReconcileFixture(t, phare)
+	f.reconcile()
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.Canary = canary })
+	got := f.reconcile()
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: "demo-canary", Namespace: "default"}, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected no canary before approval, got %v", err)
+	}
+	if got.Status.Canary != nil {
+		t.Fatalf("expected the canary not to start before approval, got %+v", got.Status.Canary)
+	}
+	st := got.Status.Approval
+	if st == nil || !strings.Contains(st.PendingDiff, `+       image: "nginx:candidate"`) {
+		t.Fatalf("expected the candidate to wait for approval, got %+v", st)
+	}
+
+	hash := st.PendingHash
+	f.update(func(p *pharev1beta1.Phare) { p.Annotations = map[string]string{approvedHashAnnotation: hash} })
+	f.reconcile()
+	if img := f.deploymentImage("demo-canary"); img != "nginx:candidate" {
+		t.Fatalf("expected the approved canary to start, got %q", img)
+	}
+	f.setAvailable("demo-canary", true)
+	f.reconcile()
+	f.promote("1")
+	f.reconcile()
+	f.promote("2")
+	f.reconcile()
+
+	// The promotion rolls out the approved candidate without another approval.
+	got = f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:candidate" {
+		t.Fatalf("expected the promoted candidate to roll out, got %q", img)
+	}
+	if approvalPending(got) {
+		t.Fatalf("expected no pending approval after promotion, got %+v", got.Status.Approval)
+	}
+}
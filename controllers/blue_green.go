@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	colorBlue  = "blue"
+	colorGreen = "green"
+
+	// colorLabel is set on the pods of the blue and green Deployments.
+	colorLabel = "phare.localcorp.internal/color"
+
+	// templateHashAnnotation records on a color Deployment the hash of the pod
+	// template it was last given.
+	templateHashAnnotation = "phare.localcorp.internal/template-hash"
+
+	// approveSwitchAnnotation approves the switch to the preview color when it
+	// holds status.blueGreen.previewHash. `kubectl phare switch` sets it.
+	approveSwitchAnnotation = "phare.localcorp.internal/approve-switch"
+
+	defaultScaleDownDelay = 30 * time.Second
+	blueGreenPollInterval = 10 * time.Second
+	previewServiceSuffix  = "-preview"
+)
+
+// reconcileBlueGreen rolls a new pod template out to the idle color and points
+// the Phare Service at it once it is available and, if required, approved. The
+// Service itself is reconciled from status.blueGreen.activeColor at the start
+// of the next reconcile.
+func (r *PhareReconciler) reconcileBlueGreen(ctx context.Context, phare *pharev1beta1.Phare) (ctrl.Result, error) {
+	if phare.Spec.MicroService.Kind != "Deployment" || phare.Spec.Service == nil {
+		return ctrl.Result{}, fmt.Errorf("BlueGreen strategy of Phare %s/%s requires a Deployment and spec.service", phare.Namespace, phare.Name)
+	}
+	if phare.Spec.Canary != nil {
+		return ctrl.Result{}, fmt.Errorf("spec.canary cannot be combined with the BlueGreen strategy in Phare %s/%s", phare.Namespace, phare.Name)
+	}
+
+	st := phare.Status.BlueGreen
+	if st == nil {
+		st = &pharev1beta1.BlueGreenStatus{State: pharev1beta1.BlueGreenDeploying}
+		phare.Status.BlueGreen = st
+	}
+	phare.Status.KindMigration = nil
+
+	// Once a color is active the Service no longer selects the workload the
+	// strategy replaced.
+	if st.ActiveColor != "" {
+		if err := r.deleteIfExists(ctx, &appsv1.Deployment{}, phare.Name, phare.Namespace, phare); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.deleteIfExists(ctx, &appsv1.StatefulSet{}, phare.Name, phare.Namespace, phare); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	desired := r.newDeployment(phare)
+	if desired == nil {
+		return ctrl.Result{}, fmt.Errorf("failed to build desired Deployment for %s/%s", phare.Namespace, phare.Name)
+	}
+	if err := r.setConfigChecksum(ctx, phare, &desired.Spec.Template); err != nil {
+		return ctrl.Result{}, err
+	}
+	hash := templateHash(&desired.Spec.Template)
+
+	if err := r.applyChildService(ctx, phare, r.desiredPreviewService(phare)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if hash == st.ActiveHash {
+		if st.PreviewHash != "" {
+			r.Recorder.Eventf(phare, corev1.EventTypeNormal, "BlueGreenCancelled", "Pod template is back to the one of %s; cancelled the pending switch", st.ActiveColor)
+		}
+		st.PreviewHash = ""
+		st.State = pharev1beta1.BlueGreenStable
+		if err := r.applyChildDeployment(ctx, phare, colorDeployment(phare, desired, st.ActiveColor, hash)); err != nil {
+			return ctrl.Result{}, err
+		}
+		return r.scaleDownIdleColor(ctx, phare)
+	}
+
+	target := idleColor(phare)
+	if st.PreviewHash != hash {
+		st.PreviewHash = hash
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "BlueGreenDeploying", "Deploying pod template %s to %s", hash, target)
+	}
+	st.State = pharev1beta1.BlueGreenDeploying
+	if err := r.applyChildDeployment(ctx, phare, colorDeployment(phare, desired, target, hash)); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	available, err := r.colorAvailable(ctx, phare, target, hash)
+	if err != nil || !available {
+		return ctrl.Result{RequeueAfter: blueGreenPollInterval}, err
+	}
+	if st.ActiveColor != "" && requireSwitchApproval(phare) && phare.Annotations[approveSwitchAnnotation] != hash {
+		// The annotation change requeues the Phare.
+		st.State = pharev1beta1.BlueGreenAwaitingApproval
+		return ctrl.Result{}, nil
+	}
+
+	now := metav1.Now()
+	r.Recorder.Eventf(phare, corev1.EventTypeNormal, "BlueGreenSwitched", "Switched Service %s to %s", phare.Name, target)
+	st.ActiveColor = target
+	st.ActiveHash = hash
+	st.PreviewHash = ""
+	st.State = pharev1beta1.BlueGreenStable
+	st.SwitchedAt = &now
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// scaleDownIdleColor scales the previous color to zero once the scale-down
+// delay after the last switch has passed.
+func (r *PhareReconciler) scaleDownIdleColor(ctx context.Context, phare *pharev1beta1.Phare) (ctrl.Result, error) {
+	st := phare.Status.BlueGreen
+	idle := &appsv1.Deployment{}
+	if err := r.Get(ctx, client.ObjectKey{Name: colorName(phare, idleColor(phare)), Namespace: phare.Namespace}, idle); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if pointer.Int32Deref(idle.Spec.Replicas, 1) == 0 || !metav1.IsControlledBy(idle, phare) {
+		return ctrl.Result{}, nil
+	}
+
+	delay := defaultScaleDownDelay
+	if phare.Spec.BlueGreen != nil && phare.Spec.BlueGreen.ScaleDownDelay != nil {
+		delay = phare.Spec.BlueGreen.ScaleDownDelay.Duration
+	}
+	if st.SwitchedAt != nil {
+		if remaining := delay - time.Since(st.SwitchedAt.Time); remaining > 0 {
+			return ctrl.Result{RequeueAfter: remaining}, nil
+		}
+	}
+
+	patch := client.MergeFrom(idle.DeepCopy())
+	idle.Spec.Replicas = pointer.Int32(0)
+	if err := r.Patch(ctx, idle, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.Recorder.Eventf(phare, corev1.EventTypeNormal, "BlueGreenScaledDown", "Scaled %s down to zero", idle.Name)
+	return ctrl.Result{}, nil
+}
+
+// finishBlueGreen hands traffic back to the workload after the BlueGreen
+// strategy was turned off: the colors keep serving until the workload is
+// available, and are deleted once the Service no longer selects them.
+func (r *PhareReconciler) finishBlueGreen(ctx context.Context, phare *pharev1beta1.Phare) (ctrl.Result, error) {
+	if phare.Status.BlueGreen == nil {
+		return ctrl.Result{}, r.cleanupBlueGreen(ctx, phare)
+	}
+	available, err := r.workloadAvailable(ctx, phare)
+	if err != nil || !available {
+		return ctrl.Result{RequeueAfter: blueGreenPollInterval}, err
+	}
+	phare.Status.BlueGreen = nil
+	return ctrl.Result{Requeue: true}, nil
+}
+
+func (r *PhareReconciler) cleanupBlueGreen(ctx context.Context, phare *pharev1beta1.Phare) error {
+	for _, color := range []string{colorBlue, colorGreen} {
+		name := colorName(phare, color)
+		if deleted, err := r.deleteIfOwned(ctx, &appsv1.Deployment{}, name, phare.Namespace, phare); err != nil {
+			return err
+		} else if deleted {
+			r.Recorder.Eventf(phare, corev1.EventTypeNormal, "DeletedResource", "Deleted Deployment %s", name)
+		}
+	}
+	name := phare.Name + previewServiceSuffix
+	if deleted, err := r.deleteIfOwned(ctx, &corev1.Service{}, name, phare.Namespace, phare); err != nil {
+		return err
+	} else if deleted {
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "DeletedResource", "Deleted Service %s", name)
+	}
+	return nil
+}
+
+// colorAvailable reports whether the color Deployment runs the pod template
+// with the given hash on all its replicas.
+func (r *PhareReconciler) colorAvailable(ctx context.Context, phare *pharev1beta1.Phare, color, hash string) (bool, error) {
+	d := &appsv1.Deployment{}
+	if err := r.Get(ctx, client.ObjectKey{Name: colorName(phare, color), Namespace: phare.Namespace}, d); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	want := pointer.Int32Deref(d.Spec.Replicas, 1)
+	return d.Annotations[templateHashAnnotation] == hash &&
+		d.Status.ObservedGeneration >= d.Generation &&
+		d.Status.UpdatedReplicas >= want &&
+		d.Status.AvailableReplicas >= want, nil
+}
+
+// desiredPreviewService selects the idle color so a new pod template can be
+// tested before the switch.
+func (r *PhareReconciler) desiredPreviewService(phare *pharev1beta1.Phare) *corev1.Service {
+	service := r.desiredService(phare)
+	if service == nil {
+		return nil
+	}
+	service.Name = phare.Name + previewServiceSuffix
+	service.Labels = instanceLabels(service.Labels, service.Name)
+	service.Spec.Selector = map[string]string{"app": colorName(phare, idleColor(phare))}
+	internalServiceSpec(&service.Spec)
+	return service
+}
+
+// colorDeployment turns the workload Deployment into the Deployment of a color.
+// Its pods carry app=<name>-<color> so that only the Service switch decides
+// which color receives traffic.
+func colorDeployment(phare *pharev1beta1.Phare, desired *appsv1.Deployment, color, hash string) *appsv1.Deployment {
+	name := colorName(phare, color)
+	d := desired.DeepCopy()
+	d.Name = name
+	d.Labels = instanceLabels(d.Labels, name)
+	if d.Annotations == nil {
+		d.Annotations = map[string]string{}
+	}
+	d.Annotations[templateHashAnnotation] = hash
+	d.Spec.Selector.MatchLabels = instanceLabels(d.Spec.Selector.MatchLabels, name)
+	d.Spec.Template.Labels = instanceLabels(d.Spec.Template.Labels, name)
+	d.Spec.Template.Labels[colorLabel] = color
+	return d
+}
+
+// workloadName is the name of the Deployment or StatefulSet serving traffic.
+func workloadName(phare *pharev1beta1.Phare) string {
+	if color := activeColor(phare); color != "" {
+		return colorName(phare, color)
+	}
+	return phare.Name
+}
+
+// activeColor is the color the Phare Service selects, if any.
+func activeColor(phare *pharev1beta1.Phare) string {
+	if phare.Status.BlueGreen == nil {
+		return ""
+	}
+	return phare.Status.BlueGreen.ActiveColor
+}
+
+// idleColor is the color a new pod template is deployed to.
+func idleColor(phare *pharev1beta1.Phare) string {
+	if activeColor(phare) == colorBlue {
+		return colorGreen
+	}
+	return colorBlue
+}
+
+func colorName(phare *pharev1beta1.Phare, color string) string {
+	return phare.Name + "-" + color
+}
+
+func isBlueGreen(phare *pharev1beta1.Phare) bool {
+	return phare.Spec.Strategy == pharev1beta1.RolloutStrategyBlueGreen
+}
+
+func requireSwitchApproval(phare *pharev1beta1.Phare) bool {
+	return phare.Spec.BlueGreen != nil && phare.Spec.BlueGreen.RequireApproval
+}
+
+func templateHash(template *corev1.PodTemplateSpec) string {
+	data, _ := json.Marshal(template)
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:10]
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"testing"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func blueGreenPhare() *pharev1beta1.Phare {
+	phare := basePhare("demo", "default")
+	phare.Spec.Service = &corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}}
+	phare.Spec.Strategy = pharev1beta1.RolloutStrategyBlueGreen
+	phare.Spec.BlueGreen = &pharev1beta1.BlueGreenSpec{
+		RequireApproval: true,
+		ScaleDownDelay:  &metav1.Duration{},
+	}
+	return phare
+}
+
+func (f *reconcileFixture) serviceSelector(name string) string {
+	f.t.Helper()
+	service := &corev1.Service{}
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: name, Namespace: f.req.Namespace}, service); err != nil {
+		f.t.Fatalf("get service %s: %v", name, err)
+	}
+	return service.Spec.Selector["app"]
+}
+
+func TestBlueGreenSwitchesServiceAfterApproval(t *testing.T) {
+	f := newReconcileFixture(t, blueGreenPhare())
+
+	got := f.reconcile()
+	if got.Status.BlueGreen == nil || got.Status.BlueGreen.State != pharev1beta1.BlueGreenDeploying {
+		t.Fatalf("expected blue to be deploying, got %+v", got.Status.BlueGreen)
+	}
+	if sel := f.serviceSelector("demo-preview"); sel != "demo-blue" {
+		t.Fatalf("expected preview Service to select blue, got %q", sel)
+	}
+
+	// The first color is switched to without approval.
+	f.setAvailable("demo-blue", true)
+	got = f.reconcile()
+	if got.Status.BlueGreen.ActiveColor != colorBlue {
+		t.Fatalf("expected blue to become active, got %+v", got.Status.BlueGreen)
+	}
+	f.reconcile()
+	if sel := f.serviceSelector("demo"); sel != "demo-blue" {
+		t.Fatalf("expected Service to select blue, got %q", sel)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.MicroService.Image.Tag = "v2" })
+	f.reconcile()
+	if img := f.deploymentImage("demo-green"); img != "nginx:v2" {
+		t.Fatalf("expected green to run the new image, got %q", img)
+	}
+	if img := f.deploymentImage("demo-blue"); img != "nginx:latest" {
+		t.Fatalf("expected blue to keep the old image, got %q", img)
+	}
+
+	f.setAvailable("demo-green", true)
+	got = f.reconcile()
+	if got.Status.BlueGreen.State != pharev1beta1.BlueGreenAwaitingApproval {
+		t.Fatalf("expected the switch to wait for approval, got %+v", got.Status.BlueGreen)
+	}
+	if sel := f.serviceSelector("demo"); sel != "demo-blue" {
+		t.Fatalf("expected Service to keep selecting blue, got %q", sel)
+	}
+
+	hash := got.Status.BlueGreen.PreviewHash
+	f.update(func(p *pharev1beta1.Phare) { p.Annotations = map[string]string{approveSwitchAnnotation: hash} })
+	got = f.reconcile()
+	if got.Status.BlueGreen.ActiveColor != colorGreen || got.Status.BlueGreen.ActiveHash != hash {
+		t.Fatalf("expected green to become active, got %+v", got.Status.BlueGreen)
+	}
+
+	f.reconcile()
+	if sel := f.serviceSelector("demo"); sel != "demo-green" {
+		t.Fatalf("expected Service to select green, got %q", sel)
+	}
+	if sel := f.serviceSelector("demo-preview"); sel != "demo-blue" {
+		t.Fatalf("expected preview Service to select blue, got %q", sel)
+	}
+	blue := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: "demo-blue", Namespace: "default"}, blue); err != nil {
+		t.Fatalf("get blue deployment: %v", err)
+	}
+	if *blue.Spec.Replicas != 0 {
+		t.Fatalf("expected blue to be scaled down, got %d replicas", *blue.Spec.Replicas)
+	}
+}
+
+func TestBlueGreenTurnedOffHandsBackToWorkload(t *testing.T) {
+	f := newReconcileFixture(t, blueGreenPhare())
+	f.reconcile()
+	f.setAvailable("demo-blue", true)
+	f.reconcile()
+	f.reconcile()
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.Strategy = "" })
+	got := f.reconcile()
+	if got.Status.BlueGreen == nil {
+		t.Fatalf("expected colors to keep serving until the workload is available")
+	}
+	if sel := f.serviceSelector("demo"); sel != "demo-blue" {
+		t.Fatalf("expected Service to keep selecting blue, got %q", sel)
+	}
+
+	f.setAvailable("demo", true)
+	f.reconcile()
+	f.reconcile()
+	if sel := f.serviceSelector("demo"); sel != "demo" {
+		t.Fatalf("expected Service to select the workload, got %q", sel)
+	}
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: "demo-blue", Namespace: "default"}, &appsv1.Deployment{}); err == nil {
+		t.Fatalf("expected blue deployment to be deleted")
+	}
+}
@@ -0,0 +1,333 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+const (
+	// promoteCanaryAnnotation advances the canary by one step whenever its value
+	// changes. `kubectl phare promote` sets it to the current time.
+	promoteCanaryAnnotation = "phare.localcorp.internal/promote-canary"
+
+	// canaryPollInterval is how often availability is re-checked while the
+	// canary or, after promotion, the workload rolls out.
+	canaryPollInterval = 10 * time.Second
+)
+
+// reconcileCanary manages the canary Deployment and Service and moves the
+// release through its steps. The resulting weight is kept in status and read
+// by desiredHttpRoute, so it must run before the HTTPRoute is reconciled.
+func (r *PhareReconciler) reconcileCanary(ctx context.Context, phare *pharev1beta1.Phare) (ctrl.Result, error) {
+	canary := phare.Spec.Canary
+	if canary == nil {
+		if st := phare.Status.Canary; st != nil && st.State == pharev1beta1.CanaryPromoting {
+			// Keep the canary serving until the workload runs the promoted image.
+			done, err := r.workloadRunsImage(ctx, phare, st.Image)
+			if err != nil || !done {
+				return ctrl.Result{RequeueAfter: canaryPollInterval}, err
+			}
+		}
+		phare.Status.Canary = nil
+		return ctrl.Result{}, r.cleanupCanary(ctx, phare)
+	}
+
+	if phare.Spec.MicroService.Kind != "Deployment" || phare.Spec.Service == nil ||
+		phare.Spec.ToolChain == nil || phare.Spec.ToolChain.HTTPRoute == nil {
+		return ctrl.Result{}, fmt.Errorf("canary of Phare %s/%s requires a Deployment, spec.service and spec.toolchain.httpRoute", phare.Namespace, phare.Name)
+	}
+
+	st := phare.Status.Canary
+	if st == nil || st.Image != canary.Image || st.State == pharev1beta1.CanaryPromoting ||
+		(st.State == pharev1beta1.CanaryAborted && !canary.Abort && st.AnalysisFailure == "") {
+		st = &pharev1beta1.CanaryStatus{
+			Image: canary.Image,
+			State: pharev1beta1.CanaryProgressing,
+			// A promotion requested before the release started does not count.
+			LastPromotion: phare.Annotations[promoteCanaryAnnotation],
+		}
+		phare.Status.Canary = st
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "CanaryStarted", "Started canary of %s", imageRef(canary.Image))
+	}
+	if canary.Abort && st.State != pharev1beta1.CanaryAborted {
+		st.State = pharev1beta1.CanaryAborted
+		st.Weight = 0
+		st.StepStartedAt = nil
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "CanaryAborted", "Aborted canary of %s; all traffic is on the stable workload", imageRef(canary.Image))
+	}
+
+	if err := r.applyCanaryDeployment(ctx, phare); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.applyCanaryService(ctx, phare); err != nil {
+		return ctrl.Result{}, err
+	}
+	if st.State == pharev1beta1.CanaryAborted {
+		return ctrl.Result{}, nil
+	}
+
+	available, err := r.canaryAvailable(ctx, phare)
+	if err != nil || !available {
+		return ctrl.Result{RequeueAfter: canaryPollInterval}, err
+	}
+	return r.advanceCanary(ctx, phare)
+}
+
+// advanceCanary applies the weight of the current step and moves to the next
+// step, or promotes the candidate, once the step's pause elapsed or a manual
+// promotion was requested.
+func (r *PhareReconciler) advanceCanary(ctx context.Context, phare *pharev1beta1.Phare) (ctrl.Result, error) {
+	canary := phare.Spec.Canary
+	st := phare.Status.Canary
+	if int(st.Step) >= len(canary.Steps) {
+		st.Step = int32(len(canary.Steps) - 1)
+	}
+	step := canary.Steps[st.Step]
+	now := metav1.Now()
+	if st.StepStartedAt == nil {
+		st.StepStartedAt = &now
+	}
+	st.Weight = step.Weight
+
+	promotion := phare.Annotations[promoteCanaryAnnotation]
+	lastPromotion := st.LastPromotion
+	advance := false
+	var wait time.Duration
+	switch {
+	case promotion != "" && promotion != st.LastPromotion:
+		st.LastPromotion = promotion
+		advance = true
+	case step.Pause != nil:
+		wait = step.Pause.Duration - now.Sub(st.StepStartedAt.Time)
+		advance = wait <= 0
+	}
+
+	if a := canary.Analysis; a != nil && st.Weight > 0 {
+		interval := analysisInterval(a)
+		// Give traffic one interval to reach the canary before the first analysis of a step.
+		last := st.StepStartedAt.Time
+		if st.LastAnalysisAt != nil && st.LastAnalysisAt.After(last) {
+			last = st.LastAnalysisAt.Time
+		}
+		if advance || now.Sub(last) >= interval {
+			failure, err := r.analyzeCanary(ctx, phare)
+			st.LastAnalysisAt = &now
+			last = now.Time
+			r.recordAnalysisInconclusive(phare, err)
+			if err != nil {
+				// Hold the step, and a promotion, until an analysis is
+				// conclusive; the rest of the reconcile goes on.
+				st.LastPromotion = lastPromotion
+				advance = false
+				wait = 0
+			} else if failure != "" {
+				r.abortCanaryAnalysis(phare, failure)
+				// The next reconcile scales the canary down.
+				return ctrl.Result{Requeue: true}, nil
+			}
+		}
+		if next := interval - now.Sub(last); !advance && (wait <= 0 || next < wait) {
+			wait = next
+		}
+	}
+
+	if !advance {
+		// Without a pause, wait for a manual promotion; the annotation change
+		// requeues the Phare.
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	if int(st.Step)+1 < len(canary.Steps) {
+		st.Step++
+		st.Weight = canary.Steps[st.Step].Weight
+		st.StepStartedAt = &now
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "CanaryStepAdvanced", "Canary at step %d/%d: %d%% of traffic", st.Step+1, len(canary.Steps), st.Weight)
+		return ctrl.Result{Requeue: true}, nil
+	}
+	return ctrl.Result{Requeue: true}, r.promoteCanary(ctx, phare)
+}
+
+// promoteCanary copies the candidate image into spec.microservice and removes
+// spec.canary. The canary keeps its weight until the workload is rolled.
+func (r *PhareReconciler) promoteCanary(ctx context.Context, phare *pharev1beta1.Phare) error {
+	latest := &pharev1beta1.Phare{}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(phare), latest); err != nil {
+		return err
+	}
+	patch := client.MergeFrom(latest.DeepCopy())
+	latest.Spec.MicroService.Image = phare.Spec.Canary.Image
+	latest.Spec.Canary = nil
+	if err := r.Patch(ctx, latest, patch); err != nil {
+		return err
+	}
+	// Let the status update that ends this reconcile apply on top of the patch.
+	// The new image is rolled out by the next reconcile.
+	phare.ResourceVersion = latest.ResourceVersion
+	phare.Status.Canary.State = pharev1beta1.CanaryPromoting
+	r.Recorder.Eventf(phare, corev1.EventTypeNormal, "CanaryPromoted", "Promoted canary %s", imageRef(phare.Status.Canary.Image))
+	phare.Spec.Canary = nil
+	return nil
+}
+
+func (r *PhareReconciler) applyCanaryDeployment(ctx context.Context, phare *pharev1beta1.Phare) error {
+	desired := r.newCanaryDeployment(phare)
+	if desired == nil {
+		return fmt.Errorf("failed to build canary Deployment for %s/%s", phare.Namespace, phare.Name)
+	}
+	if err := r.setConfigChecksum(ctx, phare, &desired.Spec.Template); err != nil {
+		return err
+	}
+	return r.applyChildDeployment(ctx, phare, desired)
+}
+
+func (r *PhareReconciler) applyCanaryService(ctx context.Context, phare *pharev1beta1.Phare) error {
+	desired := r.desiredCanaryService(phare)
+	if desired == nil {
+		return fmt.Errorf("failed to build canary Service for %s/%s", phare.Namespace, phare.Name)
+	}
+	return r.applyChildService(ctx, phare, desired)
+}
+
+func (r *PhareReconciler) cleanupCanary(ctx context.Context, phare *pharev1beta1.Phare) error {
+	name := canaryName(phare)
+	if deleted, err := r.deleteIfOwned(ctx, &appsv1.Deployment{}, name, phare.Namespace, phare); err != nil {
+		return err
+	} else if deleted {
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "DeletedResource", "Deleted Deployment %s", name)
+	}
+	if deleted, err := r.deleteIfOwned(ctx, &corev1.Service{}, name, phare.Namespace, phare); err != nil {
+		return err
+	} else if deleted {
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "DeletedResource", "Deleted Service %s", name)
+	}
+	return nil
+}
+
+// newCanaryDeployment builds the canary from the workload Deployment: same pod
+// spec with the candidate image, and labels that keep its pods out of the
+// workload selector and the Phare Service.
+func (r *PhareReconciler) newCanaryDeployment(phare *pharev1beta1.Phare) *appsv1.Deployment {
+	candidate := phare.DeepCopy()
+	candidate.Spec.MicroService.Image = phare.Spec.Canary.Image
+	candidate.Spec.MicroService.ReplicaCount = 1
+	if phare.Spec.Canary.Replicas != nil {
+		candidate.Spec.MicroService.ReplicaCount = *phare.Spec.Canary.Replicas
+	}
+	aborted := phare.Status.Canary != nil && phare.Status.Canary.State == pharev1beta1.CanaryAborted
+	candidate.Spec.Suspend = phare.Spec.Suspend || phare.Spec.Canary.Abort || aborted
+	candidate.Status.SuspendedReplicas = nil
+	candidate.Status.SuspendedReplicaCount = nil
+	candidate.Status.ResumedGeneration = nil
+
+	deployment := r.newDeployment(candidate)
+	if deployment == nil {
+		return nil
+	}
+	deployment.Name = canaryName(phare)
+	deployment.Labels = canaryLabels(phare, deployment.Labels)
+	deployment.Spec.Selector.MatchLabels = canaryLabels(phare, deployment.Spec.Selector.MatchLabels)
+	deployment.Spec.Template.Labels = canaryLabels(phare, deployment.Spec.Template.Labels)
+	return deployment
+}
+
+func (r *PhareReconciler) desiredCanaryService(phare *pharev1beta1.Phare) *corev1.Service {
+	service := r.desiredService(phare)
+	if service == nil {
+		return nil
+	}
+	service.Name = canaryName(phare)
+	service.Labels = canaryLabels(phare, service.Labels)
+	service.Spec.Selector = map[string]string{"app": canaryName(phare)}
+	// Only the HTTPRoute reaches the canary.
+	internalServiceSpec(&service.Spec)
+	return service
+}
+
+func (r *PhareReconciler) canaryAvailable(ctx context.Context, phare *pharev1beta1.Phare) (bool, error) {
+	d := &appsv1.Deployment{}
+	if err := r.Get(ctx, client.ObjectKey{Name: canaryName(phare), Namespace: phare.Namespace}, d); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	want := pointer.Int32Deref(d.Spec.Replicas, 1)
+	return want > 0 &&
+		d.Status.ObservedGeneration >= d.Generation &&
+		d.Status.UpdatedReplicas >= want &&
+		d.Status.AvailableReplicas >= want, nil
+}
+
+// workloadRunsImage reports whether the workload Deployment was rolled to image.
+func (r *PhareReconciler) workloadRunsImage(ctx context.Context, phare *pharev1beta1.Phare, image pharev1beta1.ImageSpec) (bool, error) {
+	d := &appsv1.Deployment{}
+	if err := r.Get(ctx, client.ObjectKey{Name: phare.Name, Namespace: phare.Namespace}, d); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	running := false
+	for _, c := range d.Spec.Template.Spec.Containers {
+		if c.Name == phare.Name {
+			running = c.Image == imageRef(image)
+		}
+	}
+	if !running {
+		return false, nil
+	}
+	return r.workloadAvailable(ctx, phare)
+}
+
+// withCanaryBackends splits every backendRef pointing to the Phare Service
+// between it and the canary Service according to the canary weight.
+func withCanaryBackends(phare *pharev1beta1.Phare, rules []gatewayv1beta1.HTTPRouteRule) []gatewayv1beta1.HTTPRouteRule {
+	st := phare.Status.Canary
+	if st == nil || st.State == pharev1beta1.CanaryAborted {
+		return rules
+	}
+
+	out := make([]gatewayv1beta1.HTTPRouteRule, len(rules))
+	for i := range rules {
+		rule := rules[i].DeepCopy()
+		refs := make([]gatewayv1beta1.HTTPBackendRef, 0, len(rule.BackendRefs)+1)
+		for _, ref := range rule.BackendRefs {
+			if !isPhareServiceRef(phare, ref.BackendObjectReference) {
+				refs = append(refs, ref)
+				continue
+			}
+			canary := *ref.DeepCopy()
+			canary.Name = gatewayv1beta1.ObjectName(canaryName(phare))
+			canary.Weight = pointer.Int32(st.Weight)
+			ref.Weight = pointer.Int32(100 - st.Weight)
+			refs = append(refs, ref, canary)
+		}
+		rule.BackendRefs = refs
+		out[i] = *rule
+	}
+	return out
+}
+
+func isPhareServiceRef(phare *pharev1beta1.Phare, ref gatewayv1beta1.BackendObjectReference) bool {
+	return string(ref.Name) == phare.Name &&
+		(ref.Group == nil || *ref.Group == "") &&
+		(ref.Kind == nil || *ref.Kind == "Service") &&
+		(ref.Namespace == nil || string(*ref.Namespace) == phare.Namespace)
+}
+
+// canaryLabels points the identity labels of a workload label set at the canary.
+func canaryLabels(phare *pharev1beta1.Phare, labels map[string]string) map[string]string {
+	return instanceLabels(labels, canaryName(phare))
+}
+
+func canaryName(phare *pharev1beta1.Phare) string {
+	return phare.Name + "-canary"
+}
+
+func imageRef(image pharev1beta1.ImageSpec) string {
+	return image.Repository + ":" + image.Tag
+}
@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	"github.com/localcorp/phare-controller/pkg/analysis"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const defaultAnalysisInterval = time.Minute
+
+// analyzeCanary runs the analysis queries of the canary and returns a
+// description of the first breached threshold, or an empty string when every
+// metric is in range. Query errors, and NaN or infinite values such as a
+// ratio without traffic, are returned as errors: the analysis is
+// inconclusive, and the step is retried rather than judged on missing data.
+func (r *PhareReconciler) analyzeCanary(ctx context.Context, phare *pharev1beta1.Phare) (string, error) {
+	a := phare.Spec.Canary.Analysis
+	address := a.Address
+	if address == "" {
+		address = r.PrometheusAddress
+	}
+	if address == "" {
+		return "", fmt.Errorf("canary analysis of Phare %s/%s has no Prometheus address", phare.Namespace, phare.Name)
+	}
+	querier := r.Analysis
+	if querier == nil {
+		querier = &analysis.Prometheus{}
+	}
+
+	for _, metric := range a.Metrics {
+		// renderTemplates rendered the query.
+		value, err := querier.Query(ctx, address, metric.Query)
+		if err != nil {
+			return "", fmt.Errorf("query metric %s: %w", metric.Name, err)
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return "", fmt.Errorf("metric %s is %g, which cannot be compared to its thresholds", metric.Name, value)
+		}
+		if metric.Min != nil {
+			min, err := strconv.ParseFloat(*metric.Min, 64)
+			if err != nil {
+				return "", fmt.Errorf("parse min of metric %s: %w", metric.Name, err)
+			}
+			if value < min {
+				return fmt.Sprintf("metric %s is %g, below the minimum %s", metric.Name, value, *metric.Min), nil
+			}
+		}
+		if metric.Max != nil {
+			max, err := strconv.ParseFloat(*metric.Max, 64)
+			if err != nil {
+				return "", fmt.Errorf("parse max of metric %s: %w", metric.Name, err)
+			}
+			if value > max {
+				return fmt.Sprintf("metric %s is %g, above the maximum %s", metric.Name, value, *metric.Max), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// recordAnalysisInconclusive reports err, an inconclusive analysis, in the
+// CanaryAnalysisInconclusive condition, or clears it when err is nil.
+func (r *PhareReconciler) recordAnalysisInconclusive(phare *pharev1beta1.Phare, err error) {
+	switch {
+	case err != nil:
+		message := fmt.Sprintf("Canary step %d: %v", phare.Status.Canary.Step+1, err)
+		if c := apimeta.FindStatusCondition(phare.Status.Conditions, pharev1beta1.ConditionCanaryAnalysisInconclusive); c == nil || c.Status != metav1.ConditionTrue || c.Message != message {
+			r.Recorder.Event(phare, corev1.EventTypeWarning, "CanaryAnalysisInconclusive", message)
+		}
+		apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+			Type:    pharev1beta1.ConditionCanaryAnalysisInconclusive,
+			Status:  metav1.ConditionTrue,
+			Reason:  pharev1beta1.ReasonAnalysisInconclusive,
+			Message: message,
+		})
+	case apimeta.FindStatusCondition(phare.Status.Conditions, pharev1beta1.ConditionCanaryAnalysisInconclusive) != nil:
+		apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+			Type:    pharev1beta1.ConditionCanaryAnalysisInconclusive,
+			Status:  metav1.ConditionFalse,
+			Reason:  pharev1beta1.ReasonAnalysisConclusive,
+			Message: fmt.Sprintf("Canary step %d was analyzed", phare.Status.Canary.Step+1),
+		})
+	}
+}
+
+// abortCanaryAnalysis sends all traffic back to the stable workload. The
+// release is not retried until the candidate image changes.
+func (r *PhareReconciler) abortCanaryAnalysis(phare *pharev1beta1.Phare, failure string) {
+	st := phare.Status.Canary
+	st.State = pharev1beta1.CanaryAborted
+	st.Weight = 0
+	st.StepStartedAt = nil
+	st.AnalysisFailure = failure
+	r.Recorder.Eventf(phare, corev1.EventTypeWarning, "CanaryAnalysisFailed", "Aborted canary of %s: %s", imageRef(st.Image), failure)
+}
+
+func analysisInterval(a *pharev1beta1.CanaryAnalysis) time.Duration {
+	if a.Interval != nil && a.Interval.Duration > 0 {
+		return a.Interval.Duration
+	}
+	return defaultAnalysisInterval
+}
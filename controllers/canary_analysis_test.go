@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// prometheusStandIn serves the Prometheus instant query API, answering every
+// query with value and recording the queries it received.
+func prometheusStandIn(t *testing.T, value string, queries *[]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*queries = append(*queries, r.URL.Query().Get("query"))
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,%q]}]}}`, value)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func analyzedCanaryPhare(address string) *pharev1beta1.Phare {
+	phare := canaryPhare()
+	phare.Spec.Canary.Analysis = &pharev1beta1.CanaryAnalysis{
+		Address: address,
+		Metrics: []pharev1beta1.AnalysisMetric{{
+			Name:  "error-rate",
+			Query: `sum(rate(http_errors_total{app="{{ .Name }}-canary"}[1m]))`,
+			Max:   ptrTo("0.05"),
+		}},
+	}
+	return phare
+}
+
+func TestCanaryAnalysisPassesBeforeAdvancing(t *testing.T) {
+	var queries []string
+	server := prometheusStandIn(t, "0.01", &queries)
+	f := newReconcileFixture(t, analyzedCanaryPhare(server.URL))
+
+	f.reconcile()
+	f.setAvailable("demo-canary", true)
+	f.reconcile()
+	f.promote("1")
+	got := f.reconcile()
+
+	if got.Status.Canary.Step != 1 {
+		t.Fatalf("expected the canary to advance, got %+v", got.Status.Canary)
+	}
+	if len(queries) != 1 || queries[0] != `sum(rate(http_errors_total{app="demo-canary"}[1m]))` {
+		t.Fatalf("expected one rendered query, got %q", queries)
+	}
+}
+
+func TestCanaryAnalysisQueriesUseTemplateRenderer(t *testing.T) {
+	var queries []string
+	server := prometheusStandIn(t, "0.01", &queries)
+	phare := analyzedCanaryPhare(server.URL)
+	phare.Spec.ToolChain.Config = map[string]string{"window": "5m"}
+	phare.Spec.Canary.Analysis.Metrics[0].Query = `rate(errors{team={{ .Labels.team | default "none" | quote }}}[{{ include "window" }}])`
+	f := newReconcileFixture(t, phare)
+
+	f.reconcile()
+	f.setAvailable("demo-canary", true)
+	f.reconcile()
+	f.promote("1")
+	f.reconcile()
+	if len(queries) != 1 || queries[0] != `rate(errors{team="none"}[5m])` {
+		t.Fatalf("expected the query rendered with the template functions, got %q", queries)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.Templates = &pharev1beta1.TemplatesSpec{Strict: true}
+		p.Spec.Canary.Analysis.Metrics[0].Query = `rate(errors{team="{{ .Labels.team }}"}[1m])`
+	})
+	if _, err := f.r.Reconcile(f.ctx, f.req); err == nil {
+		t.Fatalf("expected a missing key to fail in strict mode")
+	}
+	got := &pharev1beta1.Phare{}
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, got); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	c := apimeta.FindStatusCondition(got.Status.Conditions, pharev1beta1.ConditionTemplateRenderFailed)
+	if c == nil || c.Status != metav1.ConditionTrue || !strings.Contains(c.Message, "spec.canary.analysis.metrics[0].query[error-rate]") {
+		t.Fatalf("expected TemplateRenderFailed to name the query, got %+v", c)
+	}
+}
+
+func TestCanaryAnalysisBreachAborts(t *testing.T) {
+	var queries []string
+	server := prometheusStandIn(t, "0.5", &queries)
+	f := newReconcileFixture(t, analyzedCanaryPhare(server.URL))
+
+	f.reconcile()
+	f.setAvailable("demo-canary", true)
+	f.reconcile()
+	f.promote("1")
+	got := f.reconcile()
+
+	if got.Status.Canary.State != pharev1beta1.CanaryAborted || got.Status.Canary.AnalysisFailure == "" {
+		t.Fatalf("expected the analysis to abort the canary, got %+v", got.Status.Canary)
+	}
+
+	got = f.reconcile()
+	if got.Status.Canary.State != pharev1beta1.CanaryAborted {
+		t.Fatalf("expected the canary to stay aborted, got %+v", got.Status.Canary)
+	}
+	if w := f.routeWeights(); len(w) != 1 {
+		t.Fatalf("expected all traffic on the stable workload, got %v", w)
+	}
+	canary := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: "demo-canary", Namespace: "default"}, canary); err != nil {
+		t.Fatalf("get canary deployment: %v", err)
+	}
+	if *canary.Spec.Replicas != 0 {
+		t.Fatalf("expected canary to be scaled to zero, got %d", *canary.Spec.Replicas)
+	}
+}
+
+func TestCanaryAnalysisInconclusiveHoldsStep(t *testing.T) {
+	outage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(outage.Close)
+	var queries []string
+	addresses := map[string]string{"outage": outage.URL}
+	for _, value := range []string{"NaN", "+Inf", "-Inf"} {
+		addresses[value] = prometheusStandIn(t, value, &queries).URL
+	}
+
+	for name, address := range addresses {
+		t.Run(name, func(t *testing.T) {
+			f := newReconcileFixture(t, analyzedCanaryPhare(address))
+
+			f.reconcile()
+			f.setAvailable("demo-canary", true)
+			f.reconcile()
+			f.promote("1")
+			f.update(func(p *pharev1beta1.Phare) { p.Spec.MicroService.ReplicaCount = 3 })
+			result, err := f.r.Reconcile(f.ctx, f.req)
+			if err != nil {
+				t.Fatalf("expected an inconclusive analysis not to fail the reconcile, got %v", err)
+			}
+			if result.RequeueAfter <= 0 || result.RequeueAfter > defaultAnalysisInterval {
+				t.Fatalf("expected a retry after the analysis interval, got %+v", result)
+			}
+
+			got := &pharev1beta1.Phare{}
+			if err := f.r.Get(f.ctx, f.req.NamespacedName, got); err != nil {
+				t.Fatalf("get phare: %v", err)
+			}
+			if got.Status.Canary.Step != 0 || got.Status.Canary.State == pharev1beta1.CanaryAborted {
+				t.Fatalf("expected the canary to wait at its step, got %+v", got.Status.Canary)
+			}
+			if !apimeta.IsStatusConditionTrue(got.Status.Conditions, pharev1beta1.ConditionCanaryAnalysisInconclusive) {
+				t.Fatalf("expected the CanaryAnalysisInconclusive condition, got %+v", got.Status.Conditions)
+			}
+			if w := f.routeWeights(); w["demo"] != 80 || w["demo-canary"] != 20 {
+				t.Fatalf("expected the route to keep the step weights, got %v", w)
+			}
+			stable := &appsv1.Deployment{}
+			if err := f.r.Get(f.ctx, f.req.NamespacedName, stable); err != nil {
+				t.Fatalf("get deployment: %v", err)
+			}
+			if *stable.Spec.Replicas != 3 {
+				t.Fatalf("expected the workload to be reconciled, got %d replicas", *stable.Spec.Replicas)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+func canaryPhare() *pharev1beta1.Phare {
+	phare := basePhare("demo", "default")
+	phare.Spec.Service = &corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}}
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{
+		HTTPRoute: &pharev1beta1.HTTPRouteSpec{
+			Hostnames: []gatewayv1beta1.Hostname{"demo.example.com"},
+			Rules: []gatewayv1beta1.HTTPRouteRule{{
+				BackendRefs: []gatewayv1beta1.HTTPBackendRef{{BackendRef: gatewayv1beta1.BackendRef{
+					BackendObjectReference: gatewayv1beta1.BackendObjectReference{Name: "demo"},
+				}}},
+			}},
+		},
+	}
+	phare.Spec.Canary = &pharev1beta1.CanarySpec{
+		Image: pharev1beta1.ImageSpec{Repository: "nginx", Tag: "candidate"},
+		Steps: []pharev1beta1.CanaryStep{{Weight: 20}, {Weight: 50}},
+	}
+	return phare
+}
+
+// routeWeights returns the weight of each backendRef of the first rule by name.
+func (f *reconcileFixture) routeWeights() map[string]int32 {
+	f.t.Helper()
+	route := &gatewayv1beta1.HTTPRoute{}
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, route); err != nil {
+		f.t.Fatalf("get httproute: %v", err)
+	}
+	weights := map[string]int32{}
+	for _, ref := range route.Spec.Rules[0].BackendRefs {
+		weights[string(ref.Name)] = -1
+		if ref.Weight != nil {
+			weights[string(ref.Name)] = *ref.Weight
+		}
+	}
+	return weights
+}
+
+func (f *reconcileFixture) promote(value string) {
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Annotations = map[string]string{promoteCanaryAnnotation: value}
+	})
+}
+
+func TestCanaryShiftsTrafficAndPromotes(t *testing.T) {
+	f := newReconcileFixture(t, canaryPhare())
+
+	f.reconcile()
+	canary := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: "demo-canary", Namespace: "default"}, canary); err != nil {
+		t.Fatalf("get canary deployment: %v", err)
+	}
+	if got := canary.Spec.Template.Spec.Containers[0].Image; got != "nginx:candidate" {
+		t.Fatalf("expected candidate image, got %q", got)
+	}
+	if canary.Spec.Template.Labels["app"] != "demo-canary" {
+		t.Fatalf("canary pods must not match the Phare Service selector, got labels %v", canary.Spec.Template.Labels)
+	}
+	service := &corev1.Service{}
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: "demo-canary", Namespace: "default"}, service); err != nil {
+		t.Fatalf("get canary service: %v", err)
+	}
+	if w := f.routeWeights(); w["demo"] != 100 || w["demo-canary"] != 0 {
+		t.Fatalf("expected no canary traffic before it is available, got %v", w)
+	}
+
+	f.setAvailable("demo-canary", true)
+	f.reconcile()
+	if w := f.routeWeights(); w["demo"] != 80 || w["demo-canary"] != 20 {
+		t.Fatalf("expected 80/20 split, got %v", w)
+	}
+
+	f.promote("1")
+	f.reconcile()
+	if w := f.routeWeights(); w["demo"] != 50 || w["demo-canary"] != 50 {
+		t.Fatalf("expected 50/50 split after promotion, got %v", w)
+	}
+
+	f.promote("2")
+	got := f.reconcile()
+	if got.Spec.Canary != nil || got.Spec.MicroService.Image.Tag != "candidate" {
+		t.Fatalf("expected candidate to be copied into the spec, got %+v", got.Spec)
+	}
+	if got.Status.Canary == nil || got.Status.Canary.State != pharev1beta1.CanaryPromoting {
+		t.Fatalf("expected canary to be promoting, got %+v", got.Status.Canary)
+	}
+
+	f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:candidate" {
+		t.Fatalf("expected workload to run the candidate, got %q", img)
+	}
+	f.setAvailable("demo", true)
+	got = f.reconcile()
+	if got.Status.Canary != nil {
+		t.Fatalf("expected canary status to be cleared, got %+v", got.Status.Canary)
+	}
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: "demo-canary", Namespace: "default"}, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected canary deployment to be deleted, got %v", err)
+	}
+	if w := f.routeWeights(); len(w) != 1 || w["demo"] != -1 {
+		t.Fatalf("expected the route to point only at the workload, got %v", w)
+	}
+}
+
+func TestCanaryAdvancesOnTimer(t *testing.T) {
+	phare := canaryPhare()
+	phare.Spec.Canary.Steps[0].Pause = &metav1.Duration{Duration: time.Minute}
+	f := newReconcileFixture(t, phare)
+
+	f.reconcile()
+	f.setAvailable("demo-canary", true)
+	result, err := f.r.Reconcile(f.ctx, f.req)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if result.RequeueAfter <= 0 || result.RequeueAfter > time.Minute {
+		t.Fatalf("expected requeue within the step pause, got %v", result.RequeueAfter)
+	}
+
+	if err := f.r.Status().Update(f.ctx, backdateCanaryStep(t, f, 2*time.Minute)); err != nil {
+		t.Fatalf("backdate canary step: %v", err)
+	}
+	got := f.reconcile()
+	if got.Status.Canary.Step != 1 || got.Status.Canary.Weight != 50 {
+		t.Fatalf("expected the pause to advance to step 2, got %+v", got.Status.Canary)
+	}
+}
+
+func backdateCanaryStep(t *testing.T, f *reconcileFixture, d time.Duration) *pharev1beta1.Phare {
+	t.Helper()
+	phare := &pharev1beta1.Phare{}
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, phare); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	started := metav1.NewTime(time.Now().Add(-d))
+	phare.Status.Canary.StepStartedAt = &started
+	return phare
+}
+
+func TestCanaryAbortSendsTrafficBack(t *testing.T) {
+	f := newReconcileFixture(t, canaryPhare())
+	f.reconcile()
+	f.setAvailable("demo-canary", true)
+	f.reconcile()
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.Canary.Abort = true })
+	got := f.reconcile()
+	if got.Status.Canary.State != pharev1beta1.CanaryAborted {
+		t.Fatalf("expected canary to be aborted, got %+v", got.Status.Canary)
+	}
+	if w := f.routeWeights(); len(w) != 1 {
+		t.Fatalf("expected canary backend to be removed, got %v", w)
+	}
+	canary := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: "demo-canary", Namespace: "default"}, canary); err != nil {
+		t.Fatalf("get canary deployment: %v", err)
+	}
+	if *canary.Spec.Replicas != 0 {
+		t.Fatalf("expected aborted canary to be scaled to zero, got %d", *canary.Spec.Replicas)
+	}
+}
@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"strings"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// controlKeyPrefix marks Phare labels and annotations that configure the
+// controller itself; they are never copied to children.
+const controlKeyPrefix = "phare.localcorp.internal/"
+
+const (
+	// managedLabelsAnnotation and managedAnnotationsAnnotation list, comma
+	// separated, the workload labels and annotations the controller set, so
+	// that the ones no longer propagated are removed.
+	managedLabelsAnnotation      = "phare.localcorp.internal/managed-labels"
+	managedAnnotationsAnnotation = "phare.localcorp.internal/managed-annotations"
+)
+
+// defaultPropagationRule keeps the historical behaviour of copying every Phare
+// label and annotation to the Service only.
+var defaultPropagationRule = pharev1beta1.PropagationRule{
+	Targets: []pharev1beta1.PropagationTarget{pharev1beta1.PropagationTargetService},
+}
+
+// standardLabels returns the labels set on every child resource, including the
+// recommended app.kubernetes.io labels. They take precedence over propagated labels.
+func standardLabels(phare *pharev1beta1.Phare) map[string]string {
+	partOf := phare.Spec.PartOf
+	if partOf == "" {
+		partOf = phare.Name
+	}
+	labels := map[string]string{
+		"app":                          phare.Name,
+		"app.kubernetes.io/created-by": "phare-controller",
+		"app.kubernetes.io/managed-by": "phare-controller",
+		"app.kubernetes.io/name":       phare.Name,
+		"app.kubernetes.io/instance":   phare.Name,
+		"app.kubernetes.io/part-of":    partOf,
+	}
+	if version := labelValue(phare.Spec.MicroService.Image.Tag); version != "" {
+		labels["app.kubernetes.io/version"] = version
+	}
+	return labels
+}
+
+// childLabels returns the labels of the given child: propagated Phare labels
+// overlaid with standardLabels.
+func childLabels(phare *pharev1beta1.Phare, target pharev1beta1.PropagationTarget) map[string]string {
+	var rule *pharev1beta1.PropagationRule
+	if phare.Spec.Propagation != nil {
+		rule = phare.Spec.Propagation.Labels
+	} else {
+		rule = &defaultPropagationRule
+	}
+	return mergeStringMaps(propagatedKeys(phare.Labels, rule, target), standardLabels(phare))
+}
+
+// childAnnotations returns the Phare annotations propagated to the given child,
+// or nil when there are none.
+func childAnnotations(phare *pharev1beta1.Phare, target pharev1beta1.PropagationTarget) map[string]string {
+	var rule *pharev1beta1.PropagationRule
+	if phare.Spec.Propagation != nil {
+		rule = phare.Spec.Propagation.Annotations
+	} else {
+		rule = &defaultPropagationRule
+	}
+	out := propagatedKeys(phare.Annotations, rule, target)
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// propagatedKeys filters in by rule for target. A nil rule propagates nothing.
+func propagatedKeys(in map[string]string, rule *pharev1beta1.PropagationRule, target pharev1beta1.PropagationTarget) map[string]string {
+	out := map[string]string{}
+	if rule == nil || !propagationTargets(rule, target) {
+		return out
+	}
+	for key, value := range in {
+		if strings.HasPrefix(key, controlKeyPrefix) || hasAnyPrefix(key, rule.Exclude) {
+			continue
+		}
+		if len(rule.Include) > 0 && !hasAnyPrefix(key, rule.Include) {
+			continue
+		}
+		out[key] = value
+	}
+	return out
+}
+
+func propagationTargets(rule *pharev1beta1.PropagationRule, target pharev1beta1.PropagationTarget) bool {
+	if len(rule.Targets) == 0 {
+		return target != pharev1beta1.PropagationTargetPodTemplate
+	}
+	for _, t := range rule.Targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeManagedMetadata merges the desired labels and annotations into
+// existing, which other controllers annotate too, and removes the keys the
+// controller set before that are no longer desired. Workloads without the
+// managed keys annotations, created by earlier versions, only get them set.
+func mergeManagedMetadata(existing *metav1.ObjectMeta, desired metav1.ObjectMeta) {
+	previousLabels := managedKeys(existing.Annotations[managedLabelsAnnotation])
+	previousAnnotations := managedKeys(existing.Annotations[managedAnnotationsAnnotation])
+
+	labels := mergeStringMaps(existing.Labels, desired.Labels)
+	for _, key := range previousLabels {
+		if _, ok := desired.Labels[key]; !ok {
+			delete(labels, key)
+		}
+	}
+	annotations := mergeStringMaps(existing.Annotations, desired.Annotations)
+	for _, key := range previousAnnotations {
+		if _, ok := desired.Annotations[key]; !ok {
+			delete(annotations, key)
+		}
+	}
+	setManagedKeys(annotations, managedLabelsAnnotation, desired.Labels)
+	setManagedKeys(annotations, managedAnnotationsAnnotation, desired.Annotations)
+
+	if len(labels) > 0 || existing.Labels != nil {
+		existing.Labels = labels
+	}
+	existing.Annotations = annotations
+}
+
+func managedKeys(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func setManagedKeys(annotations map[string]string, annotation string, managed map[string]string) {
+	if len(managed) == 0 {
+		delete(annotations, annotation)
+		return
+	}
+	annotations[annotation] = strings.Join(sortedKeys(managed), ",")
+}
+
+// labelValue coerces s into a valid label value, returning "" when it cannot.
+// Image tags may be longer than 63 characters or contain characters that are
+// not allowed in label values.
+func labelValue(s string) string {
+	if len(s) > validation.LabelValueMaxLength {
+		s = s[:validation.LabelValueMaxLength]
+	}
+	s = strings.TrimRight(s, "-_.")
+	if len(validation.IsValidLabelValue(s)) > 0 {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestStandardLabelsOnEveryChild(t *testing.T) {
+	scheme := testScheme(t)
+	r := &PhareReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme}
+	phare := basePhare("demo", "default")
+	phare.Spec.MicroService.Image.Tag = "1.4.2"
+	phare.Spec.PartOf = "shop"
+	phare.Spec.Service = &corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}}
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{
+		Config:           pharev1beta1.ConfigSpec{"a": "b"},
+		HTTPRoute:        &pharev1beta1.HTTPRouteSpec{},
+		GCPBackendPolicy: &pharev1beta1.GCPBackendPolicySpec{},
+	}
+	phare.Labels = map[string]string{"app.kubernetes.io/created-by": "someone-else"}
+
+	want := map[string]string{
+		"app":                          "demo",
+		"app.kubernetes.io/created-by": "phare-controller",
+		"app.kubernetes.io/managed-by": "phare-controller",
+		"app.kubernetes.io/name":       "demo",
+		"app.kubernetes.io/instance":   "demo",
+		"app.kubernetes.io/version":    "1.4.2",
+		"app.kubernetes.io/part-of":    "shop",
+	}
+	configMap, err := r.generateConfigMap(context.Background(), *phare, configBundles(phare)[0])
+	if err != nil {
+		t.Fatalf("generate configmap: %v", err)
+	}
+	children := map[string]map[string]string{
+		"Deployment":       r.newDeployment(phare).Labels,
+		"PodTemplate":      r.newDeployment(phare).Spec.Template.Labels,
+		"Service":          r.desiredService(phare).Labels,
+		"ConfigMap":        configMap.Labels,
+		"HTTPRoute":        r.desiredHttpRoute(phare).Labels,
+		"GCPBackendPolicy": r.desiredGCPBackendPolicy(phare).GetLabels(),
+	}
+	for name, labels := range children {
+		if !isSubsetOf(want, labels) {
+			t.Fatalf("%s: expected labels %v, got %v", name, want, labels)
+		}
+	}
+}
+
+func TestLabelValueSanitizesImageTags(t *testing.T) {
+	if got := labelValue("v1.2.3"); got != "v1.2.3" {
+		t.Fatalf("expected valid tag to be kept, got %q", got)
+	}
+	if got := labelValue(strings.Repeat("a", 70)); len(got) != 63 {
+		t.Fatalf("expected long tag to be truncated to 63 characters, got %d", len(got))
+	}
+	if got := labelValue("build+meta"); got != "" {
+		t.Fatalf("expected invalid tag to be dropped, got %q", got)
+	}
+}
+
+func TestPropagationRuleFiltersKeysAndTargets(t *testing.T) {
+	phare := basePhare("demo", "default")
+	phare.Labels = map[string]string{
+		"team.example.com/owner": "payments",
+		"team.example.com/tmp":   "x",
+		"cost-center":            "42",
+		controlKeyPrefix + "x":   "y",
+	}
+	phare.Annotations = map[string]string{"team.example.com/oncall": "alice"}
+	phare.Spec.Propagation = &pharev1beta1.PropagationSpec{
+		Labels: &pharev1beta1.PropagationRule{
+			Include: []string{"team.example.com/", controlKeyPrefix},
+			Exclude: []string{"team.example.com/tmp"},
+		},
+		Annotations: &pharev1beta1.PropagationRule{
+			Targets: []pharev1beta1.PropagationTarget{pharev1beta1.PropagationTargetPodTemplate},
+		},
+	}
+
+	labels := childLabels(phare, pharev1beta1.PropagationTargetConfigMap)
+	if labels["team.example.com/owner"] != "payments" {
+		t.Fatalf("expected included label to propagate, got %v", labels)
+	}
+	for _, key := range []string{"team.example.com/tmp", "cost-center", controlKeyPrefix + "x"} {
+		if _, ok := labels[key]; ok {
+			t.Fatalf("expected %s not to propagate, got %v", key, labels)
+		}
+	}
+	if _, ok := childLabels(phare, pharev1beta1.PropagationTargetPodTemplate)["team.example.com/owner"]; ok {
+		t.Fatalf("expected pod template to be excluded unless listed")
+	}
+
+	if out := childAnnotations(phare, pharev1beta1.PropagationTargetService); out != nil {
+		t.Fatalf("expected annotations to skip untargeted children, got %v", out)
+	}
+	if out := childAnnotations(phare, pharev1beta1.PropagationTargetPodTemplate); out["team.example.com/oncall"] != "alice" {
+		t.Fatalf("expected annotation on pod template, got %v", out)
+	}
+}
+
+func TestReconcileGCPBackendPolicyKeepsLabels(t *testing.T) {
+	scheme := testScheme(t)
+	phare := basePhare("demo", "default")
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{
+		GCPBackendPolicy: &pharev1beta1.GCPBackendPolicySpec{
+			Default: pharev1beta1.GCPBackendPolicyDefaultSpec{TimeoutSec: 30},
+		},
+	}
+	r := newTestReconciler(t, scheme, phare)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: phare.Name, Namespace: phare.Namespace}}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("reconcile %d: %v", i, err)
+		}
+	}
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(schema.GroupVersionKind{Group: "networking.gke.io", Version: "v1", Kind: "GCPBackendPolicy"})
+	if err := r.Get(ctx, req.NamespacedName, current); err != nil {
+		t.Fatalf("get policy: %v", err)
+	}
+	if current.GetLabels()["app.kubernetes.io/created-by"] != "phare-controller" {
+		t.Fatalf("expected managed labels to survive reconciles, got %v", current.GetLabels())
+	}
+}
+
+func TestRemovedPropagatedKeysAreRemovedFromWorkload(t *testing.T) {
+	phare := basePhare("demo", "default")
+	phare.Labels = map[string]string{"team": "payments"}
+	phare.Annotations = map[string]string{"oncall": "alice"}
+	deploymentOnly := &pharev1beta1.PropagationRule{
+		Targets: []pharev1beta1.PropagationTarget{pharev1beta1.PropagationTargetDeployment},
+	}
+	phare.Spec.Propagation = &pharev1beta1.PropagationSpec{Labels: deploymentOnly, Annotations: deploymentOnly}
+	f := newReconcileFixture(t, phare)
+	f.reconcile()
+	f.reconcile()
+
+	deploy := &appsv1.Deployment{}
+	key := types.NamespacedName{Name: "demo", Namespace: "default"}
+	if err := f.r.Get(f.ctx, key, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if deploy.Labels["team"] != "payments" || deploy.Annotations["oncall"] != "alice" {
+		t.Fatalf("expected the propagated keys, got %v and %v", deploy.Labels, deploy.Annotations)
+	}
+	deploy.Annotations["deployment.kubernetes.io/revision"] = "3"
+	if err := f.r.Update(f.ctx, deploy); err != nil {
+		t.Fatalf("update deployment: %v", err)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Labels = nil
+		p.Annotations = nil
+	})
+	f.reconcile()
+	if err := f.r.Get(f.ctx, key, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if _, ok := deploy.Labels["team"]; ok {
+		t.Fatalf("expected the label no longer propagated to be removed, got %v", deploy.Labels)
+	}
+	if _, ok := deploy.Annotations["oncall"]; ok {
+		t.Fatalf("expected the annotation no longer propagated to be removed, got %v", deploy.Annotations)
+	}
+	if deploy.Annotations["deployment.kubernetes.io/revision"] != "3" || deploy.Labels["app"] != "demo" {
+		t.Fatalf("expected the other keys to be kept, got %v and %v", deploy.Labels, deploy.Annotations)
+	}
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-cmp/cmp"
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Helpers for the extra Deployments and Services run next to the workload by
+// canary and blue/green releases.
+
+// applyChildDeployment creates desired or merges it into the existing Deployment
+// of the same name, which must be controlled by the Phare.
+func (r *PhareReconciler) applyChildDeployment(ctx context.Context, phare *pharev1beta1.Phare, desired *appsv1.Deployment) error {
+	existing := &appsv1.Deployment{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	if errors.IsNotFound(err) {
+		if err := r.Create(ctx, desired); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "CreatedResource", "Created Deployment %s", desired.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(existing, phare) {
+		return fmt.Errorf("deployment %s/%s exists and is not managed by Phare %s", existing.Namespace, existing.Name, phare.Name)
+	}
+
+	original := existing.DeepCopy()
+	r.mergeDeployments(desired, existing)
+	if cmp.Diff(original, existing, podTemplateCompareOptions()) == "" {
+		return nil
+	}
+	return r.Patch(ctx, existing, client.MergeFrom(original))
+}
+
+// applyChildService creates desired or updates the existing Service of the same
+// name, which must be controlled by the Phare. Node ports are preserved.
+func (r *PhareReconciler) applyChildService(ctx context.Context, phare *pharev1beta1.Phare, desired *corev1.Service) error {
+	existing := &corev1.Service{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(desired), existing)
+	if errors.IsNotFound(err) {
+		if err := r.Create(ctx, desired); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "CreatedResource", "Created Service %s", desired.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(existing, phare) {
+		return fmt.Errorf("service %s/%s exists and is not managed by Phare %s", existing.Namespace, existing.Name, phare.Name)
+	}
+	if !serviceSpecsDiffer(&existing.Spec, &desired.Spec, true) &&
+		stringMapsEqualNilEmpty(existing.Labels, desired.Labels) {
+		return nil
+	}
+	existing.Spec = mergeServiceSpecPreservingImmutable(existing.Spec, desired.Spec, true)
+	existing.Labels = copyStringMapPreserveNil(desired.Labels)
+	return r.updateService(ctx, existing)
+}
+
+// internalServiceSpec strips what only the Phare Service may claim, so a copy
+// of its spec can be used for an in-cluster Service: node ports, external
+// addresses and fixed cluster IPs.
+func internalServiceSpec(spec *corev1.ServiceSpec) {
+	spec.Type = corev1.ServiceTypeClusterIP
+	if spec.ClusterIP != corev1.ClusterIPNone {
+		spec.ClusterIP = ""
+		spec.ClusterIPs = nil
+	}
+	spec.ExternalIPs = nil
+	spec.LoadBalancerIP = ""
+	spec.ExternalTrafficPolicy = ""
+	spec.HealthCheckNodePort = 0
+	spec.Ports = append([]corev1.ServicePort(nil), spec.Ports...)
+	for i := range spec.Ports {
+		spec.Ports[i].NodePort = 0
+	}
+}
+
+// instanceLabels returns a copy of labels whose app and instance labels name
+// the given workload instead of the Phare, keeping its pods out of the Phare
+// Service and the workload selector.
+func instanceLabels(labels map[string]string, name string) map[string]string {
+	out := copyStringMapPreserveNil(labels)
+	if out == nil {
+		out = map[string]string{}
+	}
+	out["app"] = name
+	out["app.kubernetes.io/instance"] = name
+	return out
+}
@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/pointer"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+)
+
+// configBundleLabel marks the ConfigMaps of spec.toolchain.configs with the
+// name of their bundle.
+const configBundleLabel = "phare.localcorp.internal/config-bundle"
+
+// configBundle is a set of config files of a Phare: spec.toolchain.config,
+// with an empty name, or an entry of spec.toolchain.configs.
+type configBundle struct {
+	name string
+	// path is the field path of data, used in render errors.
+	path        string
+	data        map[string]string
+	mountPath   string
+	subPath     string
+	items       []corev1.KeyToPath
+	defaultMode *int32
+	// containers are the names of the containers the bundle is mounted into;
+	// empty for the main container.
+	containers []string
+}
+
+// configBundles returns the config bundles of phare, spec.toolchain.config
+// first.
+func configBundles(phare *pharev1beta1.Phare) []configBundle {
+	tc := phare.Spec.ToolChain
+	if tc == nil {
+		return nil
+	}
+	var bundles []configBundle
+	if tc.Config != nil {
+		bundles = append(bundles, configBundle{
+			path:      "spec.toolchain.config",
+			data:      tc.Config,
+			mountPath: configVolumeMountPath,
+		})
+	}
+	for i, c := range tc.Configs {
+		bundles = append(bundles, configBundle{
+			name:        c.Name,
+			path:        fmt.Sprintf("spec.toolchain.configs[%d].data", i),
+			data:        c.Data,
+			mountPath:   c.MountPath,
+			subPath:     c.SubPath,
+			items:       c.Items,
+			defaultMode: c.DefaultMode,
+			containers:  c.Containers,
+		})
+	}
+	return bundles
+}
+
+// configMapName returns the name of the mutable ConfigMap of the bundle.
+func (b configBundle) configMapName(phare *pharev1beta1.Phare) string {
+	if b.name == "" {
+		return phare.Name + "-config"
+	}
+	return phare.Name + "-config-" + b.name
+}
+
+func (b configBundle) volumeName() string {
+	if b.name == "" {
+		return "config-volume"
+	}
+	return "config-" + b.name
+}
+
+// currentConfigMapName returns the name of the ConfigMap of the bundle the
+// pod template mounts, as recorded by reconcileConfigMap.
+func (b configBundle) currentConfigMapName(phare *pharev1beta1.Phare) string {
+	if b.name == "" && phare.Status.ConfigMapName != "" {
+		return phare.Status.ConfigMapName
+	}
+	for _, st := range phare.Status.ConfigBundles {
+		if b.name != "" && st.Name == b.name {
+			return st.ConfigMapName
+		}
+	}
+	return b.configMapName(phare)
+}
+
+// currentShards returns the shards of the bundle the pod template mounts when
+// the config is sharded, as recorded by reconcileConfigMap.
+func (b configBundle) currentShards(phare *pharev1beta1.Phare) []string {
+	if b.name == "" {
+		return phare.Status.ConfigMapShards
+	}
+	for _, st := range phare.Status.ConfigBundles {
+		if st.Name == b.name {
+			return st.ConfigMapShards
+		}
+	}
+	return nil
+}
+
+// validateConfigBundles checks that the bundles target existing containers.
+func validateConfigBundles(phare *pharev1beta1.Phare, bundles []configBundle) error {
+	names := map[string]bool{phare.Name: true}
+	for _, c := range phare.Spec.MicroService.ExtraContainers {
+		names[c.Name] = true
+	}
+	for _, c := range phare.Spec.MicroService.InitContainers {
+		names[c.Name] = true
+	}
+	for _, b := range bundles {
+		for _, container := range b.containers {
+			if !names[container] {
+				return fmt.Errorf("config bundle %s targets unknown container %s", b.name, container)
+			}
+		}
+	}
+	return nil
+}
+
+// addConfigVolumes mounts the ConfigMaps of the config bundles of phare into
+// the pod template. spec.toolchain.config is mounted first in the main
+// container; the other bundles follow in the containers they target. Hash
+// annotation injection is handled separately by the reconcile functions so
+// they can use the request context.
+func addConfigVolumes(phare *pharev1beta1.Phare, template *corev1.PodTemplateSpec) {
+	for _, b := range configBundles(phare) {
+		if b.name == "" && len(b.data) == 0 {
+			continue
+		}
+		mode := int32(420)
+		if b.defaultMode != nil {
+			mode = *b.defaultMode
+		}
+		vol := corev1.Volume{
+			Name: b.volumeName(),
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: b.currentConfigMapName(phare),
+					},
+					Items:       b.items,
+					DefaultMode: pointer.Int32(mode),
+					Optional:    pointer.Bool(false),
+				},
+			},
+		}
+		if shards := b.currentShards(phare); len(shards) > 0 {
+			// The shards are mounted together at the same path.
+			sources := make([]corev1.VolumeProjection, 0, len(shards))
+			for _, name := range shards {
+				sources = append(sources, corev1.VolumeProjection{ConfigMap: &corev1.ConfigMapProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: name},
+					Items:                b.items,
+					// Each shard holds some of the selected keys only.
+					Optional: pointer.Bool(len(b.items) > 0),
+				}})
+			}
+			vol.VolumeSource = corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+				Sources:     sources,
+				DefaultMode: pointer.Int32(mode),
+			}}
+		}
+		mount := corev1.VolumeMount{
+			Name:      b.volumeName(),
+			MountPath: b.mountPath,
+			SubPath:   b.subPath,
+		}
+
+		if b.name == "" {
+			template.Spec.Volumes = append([]corev1.Volume{vol}, template.Spec.Volumes...)
+			template.Spec.Containers[0].VolumeMounts = append([]corev1.VolumeMount{mount}, template.Spec.Containers[0].VolumeMounts...)
+			continue
+		}
+		template.Spec.Volumes = append(template.Spec.Volumes, vol)
+		targets := map[string]bool{}
+		for _, name := range b.containers {
+			targets[name] = true
+		}
+		if len(targets) == 0 {
+			targets[phare.Name] = true
+		}
+		for _, containers := range [][]corev1.Container{template.Spec.Containers, template.Spec.InitContainers} {
+			for i := range containers {
+				if targets[containers[i].Name] {
+					containers[i].VolumeMounts = append(containers[i].VolumeMounts, mount)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"testing"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func mountOf(c corev1.Container, volume string) *corev1.VolumeMount {
+	for i := range c.VolumeMounts {
+		if c.VolumeMounts[i].Name == volume {
+			return &c.VolumeMounts[i]
+		}
+	}
+	return nil
+}
+
+func TestConfigBundlesMountedIntoTargetContainers(t *testing.T) {
+	phare := basePhare("app", "default")
+	phare.Spec.MicroService.ExtraContainers = []corev1.Container{{Name: "proxy", Image: "nginx"}}
+	phare.Spec.MicroService.InitContainers = []corev1.Container{{Name: "migrate", Image: "migrate"}}
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{
+		Config: pharev1beta1.ConfigSpec{"app.yaml": "name: {{ .Name }}"},
+		Configs: []pharev1beta1.ConfigBundle{
+			{
+				Name:       "proxy",
+				Data:       map[string]string{"default.conf": "server {}", "all.conf": `{{ include "default.conf" }}`},
+				MountPath:  "/etc/nginx/conf.d",
+				Containers: []string{"proxy", "migrate"},
+			},
+			{
+				Name:        "token",
+				Data:        map[string]string{"token": "secret"},
+				MountPath:   "/var/run/token",
+				SubPath:     "token",
+				DefaultMode: ptrInt32(0400),
+			},
+		},
+	}
+	f := newReconcileFixture(t, phare)
+
+	got := f.reconcile()
+	if len(got.Status.ConfigBundles) != 2 || got.Status.ConfigBundles[0].ConfigMapName != "app-config-proxy" {
+		t.Fatalf("expected the bundle ConfigMaps in status, got %+v", got.Status.ConfigBundles)
+	}
+	proxy := &corev1.ConfigMap{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "app-config-proxy", Namespace: "default"}, proxy); err != nil {
+		t.Fatalf("get proxy configmap: %v", err)
+	}
+	if proxy.Data["all.conf"] != "server {}" || proxy.Labels[configBundleLabel] != "proxy" {
+		t.Fatalf("expected the rendered proxy bundle, got %+v", proxy)
+	}
+
+	deploy := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "app", Namespace: "default"}, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	pod := deploy.Spec.Template.Spec
+	if pod.Volumes[0].Name != "config-volume" || pod.Volumes[0].ConfigMap.Name != "app-config" {
+		t.Fatalf("expected spec.toolchain.config to be mounted first, got %+v", pod.Volumes)
+	}
+	for _, v := range pod.Volumes {
+		if v.Name == "config-token" && *v.ConfigMap.DefaultMode != 0400 {
+			t.Fatalf("expected the token bundle mode 0400, got %o", *v.ConfigMap.DefaultMode)
+		}
+	}
+	main, sidecar, init := pod.Containers[0], pod.Containers[1], pod.InitContainers[0]
+	if m := mountOf(main, "config-volume"); m == nil || m.MountPath != configVolumeMountPath {
+		t.Fatalf("expected spec.toolchain.config at %s, got %+v", configVolumeMountPath, main.VolumeMounts)
+	}
+	if m := mountOf(main, "config-token"); m == nil || m.SubPath != "token" || m.MountPath != "/var/run/token" {
+		t.Fatalf("expected the token bundle in the main container, got %+v", main.VolumeMounts)
+	}
+	if mountOf(main, "config-proxy") != nil || mountOf(sidecar, "config-proxy") == nil || mountOf(init, "config-proxy") == nil {
+		t.Fatalf("expected the proxy bundle in the proxy and migrate containers only")
+	}
+	if deploy.Spec.Template.Annotations["checksum/config-proxy"] == "" {
+		t.Fatalf("expected a checksum of the proxy bundle, got %v", deploy.Spec.Template.Annotations)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.ToolChain.Configs = p.Spec.ToolChain.Configs[1:]
+	})
+	f.reconcile()
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "app-config-proxy", Namespace: "default"}, &corev1.ConfigMap{}); err == nil {
+		t.Fatalf("expected the ConfigMap of the removed bundle to be deleted")
+	}
+}
+
+func TestConfigBundleUnknownContainerFails(t *testing.T) {
+	phare := basePhare("app", "default")
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{Configs: []pharev1beta1.ConfigBundle{
+		{Name: "proxy", Data: map[string]string{"a": "b"}, MountPath: "/etc/proxy", Containers: []string{"missing"}},
+	}}
+	f := newReconcileFixture(t, phare)
+
+	if _, err := f.r.Reconcile(f.ctx, f.req); err == nil {
+		t.Fatalf("expected a bundle targeting an unknown container to fail")
+	}
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	"github.com/localcorp/phare-controller/pkg/gitsource"
+)
+
+const defaultGitFetchInterval = 5 * time.Minute
+
+// defaultGitFetcher is used when PhareReconciler.GitFetcher is nil.
+var defaultGitFetcher = &gitsource.Git{}
+
+// gitConfigCache keeps the files last fetched for each Phare, which are used
+// between two fetches and when a fetch fails.
+type gitConfigCache struct {
+	mu      sync.Mutex
+	entries map[types.NamespacedName]*gitConfigEntry
+}
+
+type gitConfigEntry struct {
+	source pharev1beta1.GitConfigSource
+	result *gitsource.Result
+	// attempted is when the last fetch was attempted, successful or not.
+	attempted time.Time
+}
+
+func (c *gitConfigCache) get(key types.NamespacedName) *gitConfigEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key]
+}
+
+func (c *gitConfigCache) set(key types.NamespacedName, entry *gitConfigEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry == nil {
+		delete(c.entries, key)
+		return
+	}
+	if c.entries == nil {
+		c.entries = map[types.NamespacedName]*gitConfigEntry{}
+	}
+	c.entries[key] = entry
+}
+
+// resolveConfigFrom merges the files of spec.toolchain.configFrom.git into
+// spec.toolchain.config, whose keys take precedence. The files are fetched
+// again once the interval elapsed or the source changed; in between, and
+// while fetches fail, the last files fetched are used. The commit they were
+// read at is reported in status.configFrom.
+func (r *PhareReconciler) resolveConfigFrom(ctx context.Context, phare *pharev1beta1.Phare) error {
+	key := client.ObjectKeyFromObject(phare)
+	tc := phare.Spec.ToolChain
+	if tc == nil || tc.ConfigFrom == nil || tc.ConfigFrom.Git == nil {
+		r.gitConfig.set(key, nil)
+		phare.Status.ConfigFrom = nil
+		return nil
+	}
+	src := tc.ConfigFrom.Git
+
+	entry := r.gitConfig.get(key)
+	if entry != nil && !equality.Semantic.DeepEqual(entry.source, *src) {
+		entry = nil
+	}
+	if entry == nil || time.Since(entry.attempted) >= gitFetchInterval(src) {
+		result, err := r.fetchGitConfig(ctx, phare, src)
+		if err != nil {
+			if entry == nil {
+				return err
+			}
+			r.Recorder.Eventf(phare, corev1.EventTypeWarning, "ConfigFetchFailed", "Using the config of commit %s: %v", entry.result.Commit, err)
+			entry.attempted = time.Now()
+		} else {
+			if entry == nil || entry.result.Commit != result.Commit {
+				r.Recorder.Eventf(phare, corev1.EventTypeNormal, "ConfigFetched", "Fetched config at commit %s of %s", result.Commit, src.URL)
+			}
+			entry = &gitConfigEntry{source: *src.DeepCopy(), result: result, attempted: time.Now()}
+			now := metav1.NewTime(entry.attempted)
+			phare.Status.ConfigFrom = &pharev1beta1.ConfigFromStatus{GitCommit: result.Commit, LastFetchTime: &now}
+		}
+		r.gitConfig.set(key, entry)
+	}
+
+	config := make(pharev1beta1.ConfigSpec, len(entry.result.Files)+len(tc.Config))
+	for k, v := range entry.result.Files {
+		config[k] = v
+	}
+	for k, v := range tc.Config {
+		config[k] = v
+	}
+	tc.Config = config
+	return nil
+}
+
+// fetchGitConfig fetches the files of src with the credentials of its Secret.
+func (r *PhareReconciler) fetchGitConfig(ctx context.Context, phare *pharev1beta1.Phare, src *pharev1beta1.GitConfigSource) (*gitsource.Result, error) {
+	req := gitsource.Request{URL: src.URL, Ref: src.Ref, Path: src.Path}
+	if src.SecretRef != nil {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, client.ObjectKey{Name: src.SecretRef.Name, Namespace: phare.Namespace}, secret); err != nil {
+			return nil, fmt.Errorf("failed to read the credentials of %s: %w", src.URL, err)
+		}
+		req.Auth = gitsource.Auth{
+			Username:      string(secret.Data["username"]),
+			Password:      string(secret.Data["password"]),
+			SSHPrivateKey: secret.Data[corev1.SSHAuthPrivateKey],
+			KnownHosts:    secret.Data["known_hosts"],
+		}
+	}
+	fetcher := r.GitFetcher
+	if fetcher == nil {
+		fetcher = defaultGitFetcher
+	}
+	return fetcher.Fetch(ctx, req)
+}
+
+// configFromRequeue requeues the Phare when its config is fetched next.
+func (r *PhareReconciler) configFromRequeue(phare *pharev1beta1.Phare) ctrl.Result {
+	tc := phare.Spec.ToolChain
+	if tc == nil || tc.ConfigFrom == nil || tc.ConfigFrom.Git == nil {
+		return ctrl.Result{}
+	}
+	entry := r.gitConfig.get(client.ObjectKeyFromObject(phare))
+	if entry == nil {
+		return ctrl.Result{}
+	}
+	wait := time.Until(entry.attempted.Add(gitFetchInterval(tc.ConfigFrom.Git)))
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return ctrl.Result{RequeueAfter: wait}
+}
+
+func gitFetchInterval(src *pharev1beta1.GitConfigSource) time.Duration {
+	if src.Interval != nil && src.Interval.Duration > 0 {
+		return src.Interval.Duration
+	}
+	return defaultGitFetchInterval
+}
@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	"github.com/localcorp/phare-controller/pkg/gitsource"
+)
+
+// stubGitFetcher serves files as the commit of any request.
+type stubGitFetcher struct {
+	result   *gitsource.Result
+	err      error
+	requests []gitsource.Request
+}
+
+func (f *stubGitFetcher) Fetch(_ context.Context, req gitsource.Request) (*gitsource.Result, error) {
+	f.requests = append(f.requests, req)
+	if f.err != nil {
+		return nil, f.err
+	}
+	files := make(map[string]string, len(f.result.Files))
+	for k, v := range f.result.Files {
+		files[k] = v
+	}
+	return &gitsource.Result{Commit: f.result.Commit, Files: files}, nil
+}
+
+func TestConfigFromGitRenderedIntoConfigMap(t *testing.T) {
+	first := strings.Repeat("1", 40)
+	fetcher := &stubGitFetcher{result: &gitsource.Result{Commit: first, Files: map[string]string{
+		"app.yaml":   "name: {{ .Name }}\n",
+		"extra.conf": "from git",
+	}}}
+
+	phare := basePhare("api", "default")
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{
+		Config: pharev1beta1.ConfigSpec{"extra.conf": "from spec"},
+		ConfigFrom: &pharev1beta1.ConfigFromSpec{Git: &pharev1beta1.GitConfigSource{
+			URL:      "https://git.example.com/config.git",
+			Ref:      "main",
+			Path:     "api",
+			Interval: &metav1.Duration{Duration: time.Nanosecond},
+		}},
+	}
+	f := newReconcileFixture(t, phare)
+	f.r.GitFetcher = fetcher
+	got := f.reconcile()
+
+	want := gitsource.Request{URL: "https://git.example.com/config.git", Ref: "main", Path: "api"}
+	if len(fetcher.requests) != 1 || !reflect.DeepEqual(fetcher.requests[0], want) {
+		t.Fatalf("expected a fetch of %+v, got %+v", want, fetcher.requests)
+	}
+
+	if got.Status.ConfigFrom == nil || got.Status.ConfigFrom.GitCommit != first {
+		t.Fatalf("expected status.configFrom.gitCommit %s, got %+v", first, got.Status.ConfigFrom)
+	}
+	cm := &corev1.ConfigMap{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-config", Namespace: "default"}, cm); err != nil {
+		t.Fatalf("get configmap: %v", err)
+	}
+	if cm.Data["app.yaml"] != "name: api\n" || cm.Data["extra.conf"] != "from spec" {
+		t.Fatalf("expected the rendered files, spec keys first, got %v", cm.Data)
+	}
+	deploy := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api", Namespace: "default"}, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	checksum := deploy.Spec.Template.Annotations["checksum/config-files"]
+
+	second := strings.Repeat("2", 40)
+	fetcher.result = &gitsource.Result{Commit: second, Files: map[string]string{"app.yaml": "name: {{ .Name }}-v2\n"}}
+	// The fake client merges map fields decoded into the object on status
+	// updates, which leaks the fetched files into the stored spec; the API
+	// server does not.
+	resetConfig := func(p *pharev1beta1.Phare) {
+		p.Spec.ToolChain.Config = pharev1beta1.ConfigSpec{"extra.conf": "from spec"}
+	}
+	f.update(resetConfig)
+	got = f.reconcile()
+	if got.Status.ConfigFrom.GitCommit != second {
+		t.Fatalf("expected the new commit %s, got %s", second, got.Status.ConfigFrom.GitCommit)
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-config", Namespace: "default"}, cm); err != nil || cm.Data["app.yaml"] != "name: api-v2\n" {
+		t.Fatalf("expected the new file, got %v, %v", cm.Data, err)
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api", Namespace: "default"}, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if deploy.Spec.Template.Annotations["checksum/config-files"] == checksum {
+		t.Fatalf("expected the pods to be rolled when the files change")
+	}
+
+	// A failing fetch keeps the last files.
+	f.update(resetConfig)
+	fetcher.err = errors.New("connection refused")
+	got = f.reconcile()
+	if got.Status.ConfigFrom.GitCommit != second {
+		t.Fatalf("expected the last commit to be kept, got %s", got.Status.ConfigFrom.GitCommit)
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-config", Namespace: "default"}, cm); err != nil || cm.Data["app.yaml"] != "name: api-v2\n" {
+		t.Fatalf("expected the last files to be kept, got %v, %v", cm.Data, err)
+	}
+
+	// The files of a deleted Phare are forgotten.
+	if err := f.r.Delete(f.ctx, got); err != nil {
+		t.Fatalf("delete phare: %v", err)
+	}
+	if _, err := f.r.Reconcile(f.ctx, f.req); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if entry := f.r.gitConfig.get(f.req.NamespacedName); entry != nil {
+		t.Fatalf("expected the fetched files of the deleted Phare to be removed, got %+v", entry)
+	}
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+)
+
+const (
+	// maxConfigMapSize is the limit the API server puts on the data of a
+	// ConfigMap, keys included, the same as for Secrets.
+	maxConfigMapSize = corev1.MaxSecretSize
+
+	// configShardLabel marks the sharded config ConfigMaps with their index.
+	configShardLabel = "phare.localcorp.internal/config-shard"
+)
+
+// numericBundleName matches the bundle names whose ConfigMap would be named
+// like a shard of spec.toolchain.config.
+var numericBundleName = regexp.MustCompile(`^[0-9]+$`)
+
+// configSizeError reports a config ConfigMap, or a single file of it when
+// key is set, larger than limit.
+type configSizeError struct {
+	name  string
+	key   string
+	size  int
+	limit int
+}
+
+func (e *configSizeError) Error() string {
+	if e.key != "" {
+		return fmt.Sprintf("config file %s of ConfigMap %s is %d bytes, over the %d bytes limit of a shard", e.key, e.name, e.size, e.limit)
+	}
+	return fmt.Sprintf("ConfigMap %s would hold %d bytes of data, over the %d bytes limit; set spec.toolchain.configSharding to split it", e.name, e.size, e.limit)
+}
+
+// configDataSize returns the size of data as counted by the API server.
+func configDataSize(data map[string]string) int {
+	size := 0
+	for k, v := range data {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// configShardSize returns the maximum size of the data of a shard.
+func configShardSize(sharding *pharev1beta1.ConfigShardingSpec) int {
+	if sharding.MaxSize != nil && *sharding.MaxSize > 0 && int(*sharding.MaxSize) < maxConfigMapSize {
+		return int(*sharding.MaxSize)
+	}
+	return maxConfigMapSize
+}
+
+// splitConfigMaps returns the ConfigMaps to apply for each desired ConfigMap:
+// itself, or its shards with spec.toolchain.configSharding. It fails with a
+// *configSizeError when a ConfigMap or a file does not fit.
+func splitConfigMaps(phare *pharev1beta1.Phare, desired []*corev1.ConfigMap) ([][]*corev1.ConfigMap, error) {
+	var sharding *pharev1beta1.ConfigShardingSpec
+	if phare.Spec.ToolChain != nil {
+		sharding = phare.Spec.ToolChain.ConfigSharding
+	}
+	split := make([][]*corev1.ConfigMap, 0, len(desired))
+	for _, configMap := range desired {
+		if sharding == nil {
+			if size := configDataSize(configMap.Data); size > maxConfigMapSize {
+				return nil, &configSizeError{name: configMap.Name, size: size, limit: maxConfigMapSize}
+			}
+			split = append(split, []*corev1.ConfigMap{configMap})
+			continue
+		}
+		shards, err := shardConfigMap(configMap, configShardSize(sharding))
+		if err != nil {
+			return nil, err
+		}
+		split = append(split, shards)
+	}
+	return split, nil
+}
+
+// shardConfigMap spreads the keys of desired, in order, across ConfigMaps
+// named <desired>-0..N holding at most limit bytes each. There is always at
+// least one shard.
+func shardConfigMap(desired *corev1.ConfigMap, limit int) ([]*corev1.ConfigMap, error) {
+	var shards []*corev1.ConfigMap
+	size := 0
+	for _, key := range sortedKeys(desired.Data) {
+		n := len(key) + len(desired.Data[key])
+		if n > limit {
+			return nil, &configSizeError{name: desired.Name, key: key, size: n, limit: limit}
+		}
+		if len(shards) == 0 || size+n > limit {
+			shards = append(shards, newConfigShard(desired, len(shards)))
+			size = 0
+		}
+		shards[len(shards)-1].Data[key] = desired.Data[key]
+		size += n
+	}
+	if len(shards) == 0 {
+		shards = append(shards, newConfigShard(desired, 0))
+	}
+	return shards, nil
+}
+
+func newConfigShard(desired *corev1.ConfigMap, index int) *corev1.ConfigMap {
+	shard := desired.DeepCopy()
+	shard.Name = fmt.Sprintf("%s-%d", desired.Name, index)
+	shard.Data = map[string]string{}
+	shard.Labels[configShardLabel] = strconv.Itoa(index)
+	return shard
+}
+
+// validateConfigSharding rejects the specs sharding cannot handle.
+func validateConfigSharding(phare *pharev1beta1.Phare, bundles []configBundle) error {
+	tc := phare.Spec.ToolChain
+	if tc == nil || tc.ConfigSharding == nil {
+		return nil
+	}
+	if tc.ImmutableConfig != nil {
+		return fmt.Errorf("spec.toolchain.configSharding cannot be used with spec.toolchain.immutableConfig")
+	}
+	for _, b := range bundles {
+		if numericBundleName.MatchString(b.name) {
+			return fmt.Errorf("config bundle %s cannot be sharded: its ConfigMap would be named like a shard of spec.toolchain.config", b.name)
+		}
+	}
+	return nil
+}
+
+// recordConfigSize sets the ConfigTooLarge condition from the result of
+// splitConfigMaps and emits a Warning event when a new size error appears.
+func (r *PhareReconciler) recordConfigSize(phare *pharev1beta1.Phare, err error) error {
+	var sizeErr *configSizeError
+	switch {
+	case errors.As(err, &sizeErr):
+		message := sizeErr.Error()
+		if c := apimeta.FindStatusCondition(phare.Status.Conditions, pharev1beta1.ConditionConfigTooLarge); c == nil || c.Status != metav1.ConditionTrue || c.Message != message {
+			r.Recorder.Event(phare, corev1.EventTypeWarning, "ConfigTooLarge", message)
+		}
+		apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+			Type:    pharev1beta1.ConditionConfigTooLarge,
+			Status:  metav1.ConditionTrue,
+			Reason:  pharev1beta1.ReasonConfigTooLarge,
+			Message: message,
+		})
+	case err == nil && apimeta.FindStatusCondition(phare.Status.Conditions, pharev1beta1.ConditionConfigTooLarge) != nil:
+		apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+			Type:    pharev1beta1.ConditionConfigTooLarge,
+			Status:  metav1.ConditionFalse,
+			Reason:  pharev1beta1.ReasonConfigWithinLimit,
+			Message: "All config ConfigMaps are within the size limit",
+		})
+	}
+	return err
+}
+
+// hashConfigShards returns the hash of the data of the shards together,
+// the same as configDataHash of the unsharded data.
+func (r *PhareReconciler) hashConfigShards(ctx context.Context, names []string, namespace string) (string, error) {
+	data := map[string]string{}
+	for _, name := range names {
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, cm); err != nil {
+			return "", err
+		}
+		for k, v := range cm.Data {
+			data[k] = v
+		}
+	}
+	return configDataHash(data), nil
+}
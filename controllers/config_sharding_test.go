@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+)
+
+func TestConfigSizeGuardAndSharding(t *testing.T) {
+	phare := basePhare("api", "default")
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{Config: pharev1beta1.ConfigSpec{
+		"a.txt": strings.Repeat("a", 600*1024),
+		"b.txt": strings.Repeat("b", 600*1024),
+	}}
+	f := newReconcileFixture(t, phare)
+
+	if _, err := f.r.Reconcile(f.ctx, f.req); err == nil || !strings.Contains(err.Error(), "ConfigMap api-config would hold 1228810 bytes of data") {
+		t.Fatalf("expected the config to be too large, got %v", err)
+	}
+	got := &pharev1beta1.Phare{}
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, got); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	if !apimeta.IsStatusConditionTrue(got.Status.Conditions, pharev1beta1.ConditionConfigTooLarge) {
+		t.Fatalf("expected the %s condition, got %+v", pharev1beta1.ConditionConfigTooLarge, got.Status.Conditions)
+	}
+	if !hasEvent(f.r.Recorder.(*record.FakeRecorder), "Warning ConfigTooLarge") {
+		t.Fatalf("expected a Warning ConfigTooLarge event")
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-config", Namespace: "default"}, &corev1.ConfigMap{}); err == nil {
+		t.Fatalf("expected no ConfigMap to be applied")
+	}
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.ToolChain.ConfigSharding = &pharev1beta1.ConfigShardingSpec{}
+		p.Spec.ToolChain.Config["c.txt"] = "c"
+	})
+	got = f.reconcile()
+	if want := []string{"api-config-0", "api-config-1"}; !reflect.DeepEqual(got.Status.ConfigMapShards, want) || got.Status.ConfigMapName != "" {
+		t.Fatalf("expected the shards %v, got %v and %q", want, got.Status.ConfigMapShards, got.Status.ConfigMapName)
+	}
+	if c := apimeta.FindStatusCondition(got.Status.Conditions, pharev1beta1.ConditionConfigTooLarge); c == nil || c.Status != metav1.ConditionFalse {
+		t.Fatalf("expected the %s condition to be cleared, got %+v", pharev1beta1.ConditionConfigTooLarge, c)
+	}
+	data := map[string]string{}
+	for _, name := range got.Status.ConfigMapShards {
+		cm := &corev1.ConfigMap{}
+		if err := f.r.Get(f.ctx, client.ObjectKey{Name: name, Namespace: "default"}, cm); err != nil {
+			t.Fatalf("get shard %s: %v", name, err)
+		}
+		if size := configDataSize(cm.Data); size > maxConfigMapSize {
+			t.Fatalf("shard %s holds %d bytes", name, size)
+		}
+		for k, v := range cm.Data {
+			data[k] = v
+		}
+	}
+	if len(data) != 3 {
+		t.Fatalf("expected every file in a shard, got %d", len(data))
+	}
+
+	deploy := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api", Namespace: "default"}, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	var volume *corev1.Volume
+	for i := range deploy.Spec.Template.Spec.Volumes {
+		if deploy.Spec.Template.Spec.Volumes[i].Name == "config-volume" {
+			volume = &deploy.Spec.Template.Spec.Volumes[i]
+		}
+	}
+	if volume == nil || volume.Projected == nil || len(volume.Projected.Sources) != 2 || volume.Projected.Sources[1].ConfigMap.Name != "api-config-1" {
+		t.Fatalf("expected a projected volume of the shards, got %+v", volume)
+	}
+	if mount := mountOf(deploy.Spec.Template.Spec.Containers[0], "config-volume"); mount == nil || mount.MountPath != configVolumeMountPath {
+		t.Fatalf("expected the shards to be mounted at %s, got %+v", configVolumeMountPath, mount)
+	}
+	if deploy.Spec.Template.Annotations["checksum/config-files"] != configDataHash(data) {
+		t.Fatalf("expected the checksum of the whole config")
+	}
+
+	// Shards no longer needed are deleted.
+	f.update(func(p *pharev1beta1.Phare) {
+		delete(p.Spec.ToolChain.Config, "b.txt")
+	})
+	got = f.reconcile()
+	if want := []string{"api-config-0"}; !reflect.DeepEqual(got.Status.ConfigMapShards, want) {
+		t.Fatalf("expected the shards %v, got %v", want, got.Status.ConfigMapShards)
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-config-1", Namespace: "default"}, &corev1.ConfigMap{}); err == nil {
+		t.Fatalf("expected the unused shard to be deleted")
+	}
+}
+
+func TestShardConfigMapRejectsOversizedFile(t *testing.T) {
+	desired := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-config", Labels: map[string]string{}},
+		Data:       map[string]string{"big": strings.Repeat("x", 100), "small": "x"},
+	}
+	if _, err := shardConfigMap(desired, 64); err == nil || err.Error() != "config file big of ConfigMap api-config is 103 bytes, over the 64 bytes limit of a shard" {
+		t.Fatalf("expected the file to be too large, got %v", err)
+	}
+	desired.Data["big"] = strings.Repeat("x", 60)
+	shards, err := shardConfigMap(desired, 64)
+	if err != nil || len(shards) != 2 || shards[1].Labels[configShardLabel] != "1" {
+		t.Fatalf("expected two shards, got %v, %v", shards, err)
+	}
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	"github.com/localcorp/phare-controller/pkg/validator"
+)
+
+// configValidationError is a config file that fails to parse or to validate
+// against its schema, or a schema that cannot be loaded.
+type configValidationError struct {
+	path string
+	key  string
+	err  error
+}
+
+func (e *configValidationError) Error() string {
+	return fmt.Sprintf("invalid config %s[%s]: %v", e.path, e.key, e.err)
+}
+
+func (e *configValidationError) Unwrap() error { return e.err }
+
+// validateConfig checks the rendered config files of the bundles: files with
+// a known extension must parse, and files with a schema in
+// spec.toolchain.configSchemas must validate against it. desired holds the
+// ConfigMaps generated for bundles. Errors about the config are
+// *configValidationError.
+func (r *PhareReconciler) validateConfig(ctx context.Context, phare *pharev1beta1.Phare, bundles []configBundle, desired []*corev1.ConfigMap) error {
+	if phare.Spec.ToolChain == nil {
+		return nil
+	}
+	schemas := map[string]map[string]pharev1beta1.ConfigSchema{}
+	for i, s := range phare.Spec.ToolChain.ConfigSchemas {
+		found := false
+		for _, b := range bundles {
+			found = found || b.name == s.Bundle
+		}
+		if !found {
+			return &configValidationError{
+				path: fmt.Sprintf("spec.toolchain.configSchemas[%d]", i),
+				key:  s.Key,
+				err:  fmt.Errorf("unknown config bundle %q", s.Bundle),
+			}
+		}
+		if schemas[s.Bundle] == nil {
+			schemas[s.Bundle] = map[string]pharev1beta1.ConfigSchema{}
+		}
+		schemas[s.Bundle][s.Key] = s
+	}
+
+	for i, b := range bundles {
+		for _, key := range sortedKeys(desired[i].Data) {
+			var schema *validator.Schema
+			if ref, ok := schemas[b.name][key]; ok {
+				var err error
+				if schema, err = r.loadConfigSchema(ctx, phare.Namespace, b.path, key, ref.SchemaRef); err != nil {
+					return err
+				}
+			}
+			if err := validator.ValidateConfig(key, desired[i].Data[key], schema); err != nil {
+				return &configValidationError{path: b.path, key: key, err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// loadConfigSchema reads the schema of the config file key of the bundle at
+// path, or returns nil if an optional schema is missing. A missing or invalid
+// schema is a *configValidationError.
+func (r *PhareReconciler) loadConfigSchema(ctx context.Context, namespace, path, key string, ref corev1.ConfigMapKeySelector) (*validator.Schema, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return &configValidationError{path: path, key: key, err: fmt.Errorf(format, args...)}
+	}
+	optional := ref.Optional != nil && *ref.Optional
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: namespace}, cm); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		if optional {
+			return nil, nil
+		}
+		return nil, invalid("schema ConfigMap %s not found", ref.Name)
+	}
+	text, ok := cm.Data[ref.Key]
+	if !ok {
+		if optional {
+			return nil, nil
+		}
+		return nil, invalid("schema ConfigMap %s has no key %s", ref.Name, ref.Key)
+	}
+	schema, err := validator.ParseSchema(text)
+	if err != nil {
+		return nil, invalid("schema ConfigMap %s[%s]: %w", ref.Name, ref.Key, err)
+	}
+	return schema, nil
+}
+
+// recordConfigValidation sets the ConfigValidationFailed condition from the
+// result of validateConfig, and emits a Warning event when a config file
+// starts failing. err is returned unchanged.
+func (r *PhareReconciler) recordConfigValidation(phare *pharev1beta1.Phare, err error) error {
+	var validationErr *configValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		message := validationErr.Error()
+		if c := apimeta.FindStatusCondition(phare.Status.Conditions, pharev1beta1.ConditionConfigValidationFailed); c == nil || c.Status != metav1.ConditionTrue || c.Message != message {
+			r.Recorder.Event(phare, corev1.EventTypeWarning, "ConfigValidationFailed", message)
+		}
+		apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+			Type:    pharev1beta1.ConditionConfigValidationFailed,
+			Status:  metav1.ConditionTrue,
+			Reason:  pharev1beta1.ReasonInvalidConfig,
+			Message: message,
+		})
+	case err == nil && apimeta.FindStatusCondition(phare.Status.Conditions, pharev1beta1.ConditionConfigValidationFailed) != nil:
+		apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+			Type:    pharev1beta1.ConditionConfigValidationFailed,
+			Status:  metav1.ConditionFalse,
+			Reason:  pharev1beta1.ReasonConfigValid,
+			Message: "All config files are valid",
+		})
+	}
+	return err
+}
+
+// configSchemaReferences returns the schema ConfigMaps of phare as
+// "ConfigMap/<name>", for the referencedConfigIndex.
+func configSchemaReferences(phare *pharev1beta1.Phare) []string {
+	if phare.Spec.ToolChain == nil {
+		return nil
+	}
+	var refs []string
+	for _, s := range phare.Spec.ToolChain.ConfigSchemas {
+		refs = append(refs, "ConfigMap/"+s.SchemaRef.Name)
+	}
+	return refs
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+)
+
+func TestInvalidConfigBlocksConfigMapUpdate(t *testing.T) {
+	phare := basePhare("api", "default")
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{Config: pharev1beta1.ConfigSpec{
+		"app.json": `{"port": 8080}`,
+	}}
+	f := newReconcileFixture(t, phare)
+	f.reconcile()
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.ToolChain.Config["app.json"] = `{"port": 8080,}`
+	})
+	if _, err := f.r.Reconcile(f.ctx, f.req); err == nil {
+		t.Fatalf("expected the invalid JSON to fail the reconcile")
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-config", Namespace: "default"}, cm); err != nil {
+		t.Fatalf("get configmap: %v", err)
+	}
+	if cm.Data["app.json"] != `{"port": 8080}` {
+		t.Fatalf("expected the ConfigMap to be left as it was, got %v", cm.Data)
+	}
+	got := &pharev1beta1.Phare{}
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, got); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	c := apimeta.FindStatusCondition(got.Status.Conditions, pharev1beta1.ConditionConfigValidationFailed)
+	if c == nil || c.Status != metav1.ConditionTrue || !strings.HasPrefix(c.Message, "invalid config spec.toolchain.config[app.json]: invalid JSON") {
+		t.Fatalf("expected ConfigValidationFailed to name the key, got %+v", c)
+	}
+	if !hasEvent(f.r.Recorder.(*record.FakeRecorder), "Warning ConfigValidationFailed") {
+		t.Fatalf("expected a Warning ConfigValidationFailed event")
+	}
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.ToolChain.Config["app.json"] = `{"port": 9090}`
+	})
+	got = f.reconcile()
+	if apimeta.IsStatusConditionTrue(got.Status.Conditions, pharev1beta1.ConditionConfigValidationFailed) {
+		t.Fatalf("expected ConfigValidationFailed to be False once fixed, got %+v", got.Status.Conditions)
+	}
+}
+
+func TestConfigValidatedAgainstSchemaConfigMap(t *testing.T) {
+	phare := basePhare("api", "default")
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{
+		Configs: []pharev1beta1.ConfigBundle{{
+			Name:      "app",
+			MountPath: "/etc/app",
+			Data:      map[string]string{"settings.yaml": "port: 70000\n"},
+		}},
+		ConfigSchemas: []pharev1beta1.ConfigSchema{{
+			Bundle: "app",
+			Key:    "settings.yaml",
+			SchemaRef: corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "app-schema"},
+				Key:                  "schema.json",
+			},
+		}},
+	}
+	f := newReconcileFixture(t, phare)
+
+	// A missing schema fails the validation.
+	if _, err := f.r.Reconcile(f.ctx, f.req); err == nil || !strings.Contains(err.Error(), "schema ConfigMap app-schema not found") {
+		t.Fatalf("expected the missing schema to fail the reconcile, got %v", err)
+	}
+
+	schema := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-schema", Namespace: "default"},
+		Data:       map[string]string{"schema.json": `{"properties": {"port": {"type": "integer", "maximum": 65535}}}`},
+	}
+	if err := f.r.Create(f.ctx, schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	_, err := f.r.Reconcile(f.ctx, f.req)
+	if err == nil || err.Error() != "invalid config spec.toolchain.configs[0].data[settings.yaml]: schema validation failed at /port: must be <= 65535 but found 70000" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-config-app", Namespace: "default"}, &corev1.ConfigMap{}); err == nil {
+		t.Fatalf("expected no ConfigMap to be created for the invalid config")
+	}
+
+	// The schema ConfigMap is indexed, so that changing it revalidates.
+	phares := &pharev1beta1.PhareList{}
+	if err := f.r.List(f.ctx, phares, client.MatchingFields{referencedConfigIndex: "ConfigMap/app-schema"}); err != nil || len(phares.Items) != 1 {
+		t.Fatalf("expected the Phare to be indexed by its schema ConfigMap, got %d, %v", len(phares.Items), err)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.ToolChain.Configs[0].Data["settings.yaml"] = "port: 8080\n"
+	})
+	f.reconcile()
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-config-app", Namespace: "default"}, &corev1.ConfigMap{}); err != nil {
+		t.Fatalf("expected the valid config to be applied: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+)
+
+// dependsOnIndex indexes Phares by the namespace/name of the Phares they
+// depend on.
+const dependsOnIndex = "spec.dependsOn"
+
+// awaitDependencies reports whether spec.dependsOn holds the workload, and
+// sets the DependenciesNotReady condition accordingly.
+func (r *PhareReconciler) awaitDependencies(ctx context.Context, phare *pharev1beta1.Phare) (bool, error) {
+	if len(phare.Spec.DependsOn) == 0 {
+		apimeta.RemoveStatusCondition(&phare.Status.Conditions, pharev1beta1.ConditionDependenciesNotReady)
+		return false, nil
+	}
+
+	var waiting []string
+	for _, dep := range phare.Spec.DependsOn {
+		key := dependencyKey(phare, dep)
+		conditionType := dep.Condition
+		if conditionType == "" {
+			conditionType = pharev1beta1.ConditionReady
+		}
+		target := &pharev1beta1.Phare{}
+		if err := r.Get(ctx, key, target); err != nil {
+			if !errors.IsNotFound(err) {
+				return false, err
+			}
+			waiting = append(waiting, fmt.Sprintf("%s (not found)", key))
+			continue
+		}
+		if !apimeta.IsStatusConditionTrue(target.Status.Conditions, conditionType) {
+			waiting = append(waiting, fmt.Sprintf("%s (%s is not True)", key, conditionType))
+		}
+	}
+
+	if len(waiting) == 0 {
+		apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+			Type:    pharev1beta1.ConditionDependenciesNotReady,
+			Status:  metav1.ConditionFalse,
+			Reason:  pharev1beta1.ReasonDependenciesReady,
+			Message: "All dependencies are ready",
+		})
+		return false, nil
+	}
+	message := "Waiting for dependencies: " + strings.Join(waiting, ", ")
+	if c := apimeta.FindStatusCondition(phare.Status.Conditions, pharev1beta1.ConditionDependenciesNotReady); c == nil || c.Message != message {
+		r.Recorder.Event(phare, corev1.EventTypeNormal, "WaitingForDependencies", message)
+	}
+	apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+		Type:    pharev1beta1.ConditionDependenciesNotReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  pharev1beta1.ReasonWaitingForDependencies,
+		Message: message,
+	})
+	return true, nil
+}
+
+// setReadyCondition reports whether the workload is available in the Ready
+// condition that other Phares depend on.
+func (r *PhareReconciler) setReadyCondition(ctx context.Context, phare *pharev1beta1.Phare) error {
+	condition := metav1.Condition{
+		Type:    pharev1beta1.ConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  pharev1beta1.ReasonNotAvailable,
+		Message: "Workload is not available",
+	}
+	if phare.Spec.Suspend {
+		condition.Reason = pharev1beta1.ReasonSuspended
+		condition.Message = "Workload is scaled to zero"
+	} else {
+		available, err := r.workloadAvailable(ctx, phare)
+		if err != nil {
+			return err
+		}
+		if available {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = pharev1beta1.ReasonAvailable
+			condition.Message = "Workload is available"
+		}
+	}
+	apimeta.SetStatusCondition(&phare.Status.Conditions, condition)
+	return nil
+}
+
+func dependencyKey(phare *pharev1beta1.Phare, dep pharev1beta1.PhareDependency) client.ObjectKey {
+	namespace := dep.Namespace
+	if namespace == "" {
+		namespace = phare.Namespace
+	}
+	return client.ObjectKey{Name: dep.Name, Namespace: namespace}
+}
+
+// dependsOnIndexValues extracts the dependsOnIndex values of a Phare.
+func dependsOnIndexValues(obj client.Object) []string {
+	phare, ok := obj.(*pharev1beta1.Phare)
+	if !ok {
+		return nil
+	}
+	values := make([]string, 0, len(phare.Spec.DependsOn))
+	for _, dep := range phare.Spec.DependsOn {
+		values = append(values, dependencyKey(phare, dep).String())
+	}
+	return values
+}
+
+// dependentsOf maps a Phare to the Phares that depend on it or use its
+// address in spec.microservice.phareEnv.
+func (r *PhareReconciler) dependentsOf(ctx context.Context, obj client.Object) []reconcile.Request {
+	seen := map[client.ObjectKey]bool{}
+	var requests []reconcile.Request
+	for _, index := range []string{dependsOnIndex, phareEnvIndex} {
+		dependents := &pharev1beta1.PhareList{}
+		if err := r.List(ctx, dependents, client.MatchingFields{index: client.ObjectKeyFromObject(obj).String()}); err != nil {
+			r.Log.Error(err, "Failed to list dependent Phares", "Phare.Namespace", obj.GetNamespace(), "Phare.Name", obj.GetName())
+			return nil
+		}
+		for _, dependent := range dependents.Items {
+			key := client.ObjectKeyFromObject(&dependent)
+			if !seen[key] {
+				seen[key] = true
+				requests = append(requests, reconcile.Request{NamespacedName: key})
+			}
+		}
+	}
+	return requests
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestDependsOnHoldsWorkloadUntilDependencyReady(t *testing.T) {
+	api := basePhare("api", "default")
+	api.Spec.DependsOn = []pharev1beta1.PhareDependency{{Name: "config"}}
+	f := newReconcileFixture(t, api)
+
+	got := f.reconcile()
+	c := apimeta.FindStatusCondition(got.Status.Conditions, pharev1beta1.ConditionDependenciesNotReady)
+	if c == nil || !strings.Contains(c.Message, "default/config (not found)") {
+		t.Fatalf("expected a missing dependency to be reported, got %+v", c)
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api", Namespace: "default"}, &appsv1.Deployment{}); err == nil {
+		t.Fatalf("expected the api workload to be held")
+	}
+	if got.Status.Phase != pharev1beta1.PharePhaseReconciling {
+		t.Fatalf("expected phase Reconciling, got %s", got.Status.Phase)
+	}
+
+	if err := f.r.Create(f.ctx, basePhare("config", "default")); err != nil {
+		t.Fatalf("create config phare: %v", err)
+	}
+	configReq := ctrl.Request{NamespacedName: client.ObjectKey{Name: "config", Namespace: "default"}}
+	if _, err := f.r.Reconcile(f.ctx, configReq); err != nil {
+		t.Fatalf("reconcile config: %v", err)
+	}
+	got = f.reconcile()
+	c = apimeta.FindStatusCondition(got.Status.Conditions, pharev1beta1.ConditionDependenciesNotReady)
+	if c == nil || !strings.Contains(c.Message, "default/config (Ready is not True)") {
+		t.Fatalf("expected an unavailable dependency to be reported, got %+v", c)
+	}
+
+	f.setAvailable("config", true)
+	if _, err := f.r.Reconcile(f.ctx, configReq); err != nil {
+		t.Fatalf("reconcile config: %v", err)
+	}
+	config := &pharev1beta1.Phare{}
+	if err := f.r.Get(f.ctx, configReq.NamespacedName, config); err != nil {
+		t.Fatalf("get config phare: %v", err)
+	}
+	if !apimeta.IsStatusConditionTrue(config.Status.Conditions, pharev1beta1.ConditionReady) {
+		t.Fatalf("expected config to be Ready, got %+v", config.Status.Conditions)
+	}
+	if reqs := f.r.dependentsOf(f.ctx, config); len(reqs) != 1 || reqs[0].Name != "api" {
+		t.Fatalf("expected config to requeue api, got %v", reqs)
+	}
+
+	got = f.reconcile()
+	if img := f.deploymentImage("api"); img != "nginx:latest" {
+		t.Fatalf("expected the api workload once config is ready, got %q", img)
+	}
+	if apimeta.IsStatusConditionTrue(got.Status.Conditions, pharev1beta1.ConditionDependenciesNotReady) {
+		t.Fatalf("expected DependenciesNotReady to be False, got %+v", got.Status.Conditions)
+	}
+}
+
+func TestDependsOnCustomCondition(t *testing.T) {
+	worker := basePhare("worker", "default")
+	worker.Spec.DependsOn = []pharev1beta1.PhareDependency{{Name: "api", Namespace: "apps", Condition: pharev1beta1.ConditionPostDeployHookComplete}}
+	f := newReconcileFixture(t, worker)
+
+	api := basePhare("api", "apps")
+	api.Status.Conditions = []metav1.Condition{{Type: pharev1beta1.ConditionReady, Status: metav1.ConditionTrue, Reason: pharev1beta1.ReasonAvailable}}
+	if err := f.r.Create(f.ctx, api); err != nil {
+		t.Fatalf("create api phare: %v", err)
+	}
+
+	got := f.reconcile()
+	c := apimeta.FindStatusCondition(got.Status.Conditions, pharev1beta1.ConditionDependenciesNotReady)
+	if c == nil || !strings.Contains(c.Message, "apps/api (PostDeployHookComplete is not True)") {
+		t.Fatalf("expected the custom condition to be required, got %+v", c)
+	}
+}
@@ -39,7 +39,8 @@ func (r *PhareReconciler) reconcileHttpRoute(ctx context.Context, req ctrl.Reque
 	}
 
 	if !specMatchesDesired(existingHttpRoute.Spec, desired.Spec) ||
-		!stringMapsEqualNilEmpty(existingHttpRoute.GetLabels(), desired.GetLabels()) {
+		!stringMapsEqualNilEmpty(existingHttpRoute.GetLabels(), desired.GetLabels()) ||
+		!stringMapsEqualNilEmpty(existingHttpRoute.GetAnnotations(), desired.GetAnnotations()) {
 		r.Log.Info("HTTPRoute does not match the desired configuration", "HTTPRoute.Namespace", desired.Namespace, "HTTPRoute.Name", desired.Name)
 
 		patch := client.MergeFrom(existingHttpRoute.DeepCopy())
@@ -48,6 +49,7 @@ func (r *PhareReconciler) reconcileHttpRoute(ctx context.Context, req ctrl.Reque
 		// Copy desired spec into the current object before patching.
 		existingHttpRoute.Spec = desired.Spec
 		existingHttpRoute.ObjectMeta.Labels = copyStringMapPreserveNil(desired.ObjectMeta.Labels)
+		existingHttpRoute.ObjectMeta.Annotations = copyStringMapPreserveNil(desired.ObjectMeta.Annotations)
 
 		if err := r.Patch(ctx, existingHttpRoute, patch, client.FieldOwner("phare-controller")); err != nil {
 			return err
@@ -61,25 +63,20 @@ func (r *PhareReconciler) reconcileHttpRoute(ctx context.Context, req ctrl.Reque
 }
 
 func (r *PhareReconciler) desiredHttpRoute(phare *pharev1beta1.Phare) *gatewayv1beta1.HTTPRoute {
-	// Keep the same labels at the metadata level
-	metadataLabels := map[string]string{
-		"app":                          phare.Name,
-		"app.kubernetes.io/created-by": "phare-controller",
-	}
-
 	httpRoute := &gatewayv1beta1.HTTPRoute{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "gateway.networking.k8s.io/v1beta1", // Now it's hard-coded, but it should be a variable or generated
 			Kind:       "HTTPRoute",                         // Same here
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      phare.Name,
-			Namespace: phare.Namespace,
-			Labels:    metadataLabels,
+			Name:        phare.Name,
+			Namespace:   phare.Namespace,
+			Labels:      childLabels(phare, pharev1beta1.PropagationTargetHTTPRoute),
+			Annotations: childAnnotations(phare, pharev1beta1.PropagationTargetHTTPRoute),
 		},
 		Spec: gatewayv1beta1.HTTPRouteSpec{
 			Hostnames: phare.Spec.ToolChain.HTTPRoute.Hostnames,
-			Rules:     phare.Spec.ToolChain.HTTPRoute.Rules,
+			Rules:     withCanaryBackends(phare, phare.Spec.ToolChain.HTTPRoute.Rules),
 			CommonRouteSpec: gatewayv1beta1.CommonRouteSpec{
 				ParentRefs: phare.Spec.ToolChain.HTTPRoute.ParentRefs,
 			},
@@ -99,11 +96,6 @@ func (r *PhareReconciler) desiredGCPBackendPolicy(phare *pharev1beta1.Phare) *un
 		return nil
 	}
 
-	metadataLabels := map[string]string{
-		"app":                          phare.Name,
-		"app.kubernetes.io/created-by": "phare-controller",
-	}
-
 	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(phare.Spec.ToolChain.GCPBackendPolicy)
 	if err != nil {
 		r.Log.Error(err, "Failed to convert GCPBackendPolicy spec to unstructured map")
@@ -117,11 +109,12 @@ func (r *PhareReconciler) desiredGCPBackendPolicy(phare *pharev1beta1.Phare) *un
 			"metadata": map[string]interface{}{
 				"name":      phare.Name,
 				"namespace": phare.Namespace,
-				"labels":    metadataLabels,
 			},
 			"spec": spec,
 		},
 	}
+	gcpBackendPolicy.SetLabels(childLabels(phare, pharev1beta1.PropagationTargetGCPBackendPolicy))
+	gcpBackendPolicy.SetAnnotations(childAnnotations(phare, pharev1beta1.PropagationTargetGCPBackendPolicy))
 	if err := ctrl.SetControllerReference(phare, gcpBackendPolicy, r.Scheme); err != nil {
 		r.Log.Error(err, "Failed to set controller reference for GCPBackendPolicy")
 		return nil
@@ -157,7 +150,8 @@ func (r *PhareReconciler) reconcileGCPBackendPolicy(ctx context.Context, req ctr
 	}
 
 	if !specMatchesDesired(existingGCPBackendPolicy.Object["spec"], desired.Object["spec"]) ||
-		!stringMapsEqualNilEmpty(existingGCPBackendPolicy.GetLabels(), desired.GetLabels()) {
+		!stringMapsEqualNilEmpty(existingGCPBackendPolicy.GetLabels(), desired.GetLabels()) ||
+		!stringMapsEqualNilEmpty(existingGCPBackendPolicy.GetAnnotations(), desired.GetAnnotations()) {
 		r.Log.Info("GCPBackendPolicy does not match the desired configuration", "GCPBackendPolicy.Namespace", desired.GetNamespace(), "GCPBackendPolicy.Name", desired.GetName())
 
 		patch := client.MergeFrom(existingGCPBackendPolicy.DeepCopy())
@@ -166,6 +160,7 @@ func (r *PhareReconciler) reconcileGCPBackendPolicy(ctx context.Context, req ctr
 		// Copy desired spec into the current object before patching.
 		existingGCPBackendPolicy.Object["spec"] = desired.Object["spec"]
 		existingGCPBackendPolicy.SetLabels(copyStringMapPreserveNil(desired.GetLabels()))
+		existingGCPBackendPolicy.SetAnnotations(copyStringMapPreserveNil(desired.GetAnnotations()))
 
 		if err := r.Patch(ctx, existingGCPBackendPolicy, patch, client.FieldOwner("phare-controller")); err != nil {
 			return err
@@ -182,11 +177,6 @@ func (r *PhareReconciler) desiredHealthCheckPolicy(phare *pharev1beta1.Phare) *u
 		return nil
 	}
 
-	metadataLabels := map[string]string{
-		"app":                          phare.Name,
-		"app.kubernetes.io/created-by": "phare-controller",
-	}
-
 	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(phare.Spec.ToolChain.HealthCheckPolicy)
 	if err != nil {
 		r.Log.Error(err, "Failed to convert HealthCheckPolicy spec to unstructured map")
@@ -201,11 +191,12 @@ func (r *PhareReconciler) desiredHealthCheckPolicy(phare *pharev1beta1.Phare) *u
 			"metadata": map[string]interface{}{
 				"name":      phare.Name,
 				"namespace": phare.Namespace,
-				"labels":    metadataLabels,
 			},
 			"spec": spec,
 		},
 	}
+	healthCheckPolicy.SetLabels(childLabels(phare, pharev1beta1.PropagationTargetHealthCheckPolicy))
+	healthCheckPolicy.SetAnnotations(childAnnotations(phare, pharev1beta1.PropagationTargetHealthCheckPolicy))
 	if err := ctrl.SetControllerReference(phare, healthCheckPolicy, r.Scheme); err != nil {
 		r.Log.Error(err, "Failed to set controller reference for HealthCheckPolicy")
 		return nil
@@ -241,7 +232,8 @@ func (r *PhareReconciler) reconcileHealthCheckPolicy(ctx context.Context, req ct
 	}
 
 	if !specMatchesDesired(existingHealthCheckPolicy.Object["spec"], desired.Object["spec"]) ||
-		!stringMapsEqualNilEmpty(existingHealthCheckPolicy.GetLabels(), desired.GetLabels()) {
+		!stringMapsEqualNilEmpty(existingHealthCheckPolicy.GetLabels(), desired.GetLabels()) ||
+		!stringMapsEqualNilEmpty(existingHealthCheckPolicy.GetAnnotations(), desired.GetAnnotations()) {
 		r.Log.Info("HealthCheckPolicy does not match the desired configuration", "HealthCheckPolicy.Namespace", desired.GetNamespace(), "HealthCheckPolicy.Name", desired.GetName())
 
 		patch := client.MergeFrom(existingHealthCheckPolicy.DeepCopy())
@@ -250,6 +242,7 @@ func (r *PhareReconciler) reconcileHealthCheckPolicy(ctx context.Context, req ct
 		// Copy desired spec into the current object before patching.
 		existingHealthCheckPolicy.Object["spec"] = desired.Object["spec"]
 		existingHealthCheckPolicy.SetLabels(copyStringMapPreserveNil(desired.GetLabels()))
+		existingHealthCheckPolicy.SetAnnotations(copyStringMapPreserveNil(desired.GetAnnotations()))
 
 		if err := r.Patch(ctx, existingHealthCheckPolicy, patch, client.FieldOwner("phare-controller")); err != nil {
 			return err
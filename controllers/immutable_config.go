@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+)
+
+const (
+	// configHashLabel marks the immutable config ConfigMaps of a Phare with
+	// the hash in their name.
+	configHashLabel = "phare.localcorp.internal/config-hash"
+
+	// configHashLength is the length of the hash in immutable ConfigMap names.
+	configHashLength = 10
+
+	defaultConfigHistoryLimit = 3
+)
+
+// applyImmutableConfigMap creates the immutable ConfigMap of desired, named
+// after desired and the hash of its data, and returns its name.
+func (r *PhareReconciler) applyImmutableConfigMap(ctx context.Context, phare *pharev1beta1.Phare, desired *corev1.ConfigMap) (string, error) {
+	hash := configDataHash(desired.Data)[:configHashLength]
+	desired.Name = fmt.Sprintf("%s-%s", desired.Name, hash)
+	desired.Labels[configHashLabel] = hash
+	desired.Immutable = pointer.Bool(true)
+
+	existing := &corev1.ConfigMap{}
+	err := r.Get(ctx, client.ObjectKey{Name: desired.Name, Namespace: phare.Namespace}, existing)
+	switch {
+	case errors.IsNotFound(err):
+		if err := r.Create(ctx, desired); err != nil {
+			return "", err
+		}
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "CreatedResource", "Created ConfigMap %s", desired.Name)
+	case err != nil:
+		return "", err
+	case !stringMapsEqualNilEmpty(existing.Labels, desired.Labels) || !stringMapsEqualNilEmpty(existing.Annotations, desired.Annotations):
+		// The data of the ConfigMap is immutable, its metadata is not.
+		existing.Labels = copyStringMapPreserveNil(desired.Labels)
+		existing.Annotations = copyStringMapPreserveNil(desired.Annotations)
+		if err := r.Update(ctx, existing); err != nil {
+			return "", err
+		}
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "UpdatedResource", "Updated ConfigMap %s", desired.Name)
+	}
+	return desired.Name, nil
+}
+
+// pruneConfigMaps deletes the config ConfigMaps of the Phare not in current.
+// With immutable ConfigMaps the newest history limit of each bundle are kept,
+// <name>-config counting as a previous config of spec.toolchain.config.
+// ConfigMaps of removed bundles are not kept, and ConfigMaps mounted by
+// running pods are never deleted.
+func (r *PhareReconciler) pruneConfigMaps(ctx context.Context, phare *pharev1beta1.Phare, current map[string]bool) error {
+	configMaps := &corev1.ConfigMapList{}
+	if err := r.List(ctx, configMaps, client.InNamespace(phare.Namespace), client.MatchingLabels{
+		"app.kubernetes.io/instance": phare.Name,
+	}); err != nil {
+		return err
+	}
+
+	// previous groups the ConfigMaps by bundle, "" for spec.toolchain.config.
+	previous := map[string][]corev1.ConfigMap{}
+	for _, cm := range configMaps.Items {
+		if current[cm.Name] || !metav1.IsControlledBy(&cm, phare) {
+			continue
+		}
+		_, hashed := cm.Labels[configHashLabel]
+		_, sharded := cm.Labels[configShardLabel]
+		bundle, inBundle := cm.Labels[configBundleLabel]
+		if hashed || sharded || inBundle || cm.Name == phare.Name+"-config" {
+			previous[bundle] = append(previous[bundle], cm)
+		}
+	}
+
+	keep := map[string]int{}
+	if tc := phare.Spec.ToolChain; tc != nil && tc.ImmutableConfig != nil {
+		limit := defaultConfigHistoryLimit
+		if tc.ImmutableConfig.HistoryLimit != nil {
+			limit = int(*tc.ImmutableConfig.HistoryLimit)
+		}
+		for _, b := range configBundles(phare) {
+			keep[b.name] = limit
+		}
+	}
+
+	var inUse map[string]bool
+	for bundle, configMaps := range previous {
+		if len(configMaps) <= keep[bundle] {
+			continue
+		}
+		sort.Slice(configMaps, func(i, j int) bool {
+			return configMaps[j].CreationTimestamp.Before(&configMaps[i].CreationTimestamp)
+		})
+		if inUse == nil {
+			var err error
+			if inUse, err = r.configMapsInUse(ctx, phare); err != nil {
+				return err
+			}
+		}
+		for i := keep[bundle]; i < len(configMaps); i++ {
+			cm := &configMaps[i]
+			if inUse[cm.Name] {
+				continue
+			}
+			if err := r.Delete(ctx, cm); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			r.Recorder.Eventf(phare, corev1.EventTypeNormal, "DeletedResource", "Deleted ConfigMap %s", cm.Name)
+		}
+	}
+	return nil
+}
+
+// configMapsInUse returns the names of the ConfigMaps, shards included,
+// mounted by the ReplicaSets of the Phare that still have pods, those of the
+// blue/green colors and the canary included, and by the current and update
+// revisions of its StatefulSet.
+func (r *PhareReconciler) configMapsInUse(ctx context.Context, phare *pharev1beta1.Phare) (map[string]bool, error) {
+	inUse := map[string]bool{}
+	addVolumes := func(template *corev1.PodTemplateSpec) {
+		for _, volume := range template.Spec.Volumes {
+			if volume.ConfigMap != nil {
+				inUse[volume.ConfigMap.Name] = true
+			}
+			if volume.Projected != nil {
+				for _, source := range volume.Projected.Sources {
+					if source.ConfigMap != nil {
+						inUse[source.ConfigMap.Name] = true
+					}
+				}
+			}
+		}
+	}
+
+	// Colors and the canary keep app.kubernetes.io/name and change the
+	// instance label to their own name; ReplicaSets of older controller
+	// versions may only have the instance label.
+	deployments := map[string]bool{
+		phare.Name:                   true,
+		colorName(phare, colorBlue):  true,
+		colorName(phare, colorGreen): true,
+		canaryName(phare):            true,
+	}
+	for _, label := range []string{"app.kubernetes.io/name", "app.kubernetes.io/instance"} {
+		replicaSets := &appsv1.ReplicaSetList{}
+		if err := r.reader().List(ctx, replicaSets, client.InNamespace(phare.Namespace), client.MatchingLabels{label: phare.Name}); err != nil {
+			return nil, err
+		}
+		for i := range replicaSets.Items {
+			rs := &replicaSets.Items[i]
+			// Orphans count too: their pods may still mount the ConfigMaps.
+			if owner := metav1.GetControllerOf(rs); owner != nil && (owner.Kind != "Deployment" || !deployments[owner.Name]) {
+				continue
+			}
+			if rs.Status.Replicas > 0 || (rs.Spec.Replicas != nil && *rs.Spec.Replicas > 0) {
+				addVolumes(&rs.Spec.Template)
+			}
+		}
+	}
+
+	statefulSet := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, client.ObjectKey{Name: phare.Name, Namespace: phare.Namespace}, statefulSet); errors.IsNotFound(err) {
+		return inUse, nil
+	} else if err != nil {
+		return nil, err
+	}
+	addVolumes(&statefulSet.Spec.Template)
+	// Pods not yet rolled run the template of the current revision.
+	for _, name := range []string{statefulSet.Status.CurrentRevision, statefulSet.Status.UpdateRevision} {
+		if name == "" {
+			continue
+		}
+		template, err := r.statefulSetRevisionTemplate(ctx, statefulSet, name)
+		if err != nil {
+			return nil, err
+		}
+		if template != nil {
+			addVolumes(template)
+		}
+	}
+	return inUse, nil
+}
+
+// statefulSetRevisionTemplate returns the pod template stored in the
+// ControllerRevision name of statefulSet, or nil if it is gone. The revision
+// holds a patch replacing spec.template.
+func (r *PhareReconciler) statefulSetRevisionTemplate(ctx context.Context, statefulSet *appsv1.StatefulSet, name string) (*corev1.PodTemplateSpec, error) {
+	revision := &appsv1.ControllerRevision{}
+	if err := r.reader().Get(ctx, client.ObjectKey{Name: name, Namespace: statefulSet.Namespace}, revision); errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !metav1.IsControlledBy(revision, statefulSet) {
+		return nil, nil
+	}
+	var patch struct {
+		Spec struct {
+			Template corev1.PodTemplateSpec `json:"template"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(revision.Data.Raw, &patch); err != nil {
+		return nil, fmt.Errorf("failed to decode ControllerRevision %s: %w", name, err)
+	}
+	return &patch.Spec.Template, nil
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func configVolumeName(t *testing.T, f *reconcileFixture) string {
+	t.Helper()
+	deploy := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "app", Namespace: "default"}, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	for _, volume := range deploy.Spec.Template.Spec.Volumes {
+		if volume.Name == "config-volume" {
+			return volume.ConfigMap.Name
+		}
+	}
+	t.Fatalf("expected a config volume, got %+v", deploy.Spec.Template.Spec.Volumes)
+	return ""
+}
+
+func TestImmutableConfigMapPerContent(t *testing.T) {
+	phare := basePhare("app", "default")
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{
+		Config:          pharev1beta1.ConfigSpec{"app.yaml": "v: 1"},
+		ImmutableConfig: &pharev1beta1.ImmutableConfigSpec{},
+	}
+	f := newReconcileFixture(t, phare)
+
+	got := f.reconcile()
+	first := got.Status.ConfigMapName
+	if !strings.HasPrefix(first, "app-config-") || len(first) != len("app-config-")+configHashLength {
+		t.Fatalf("expected a hashed ConfigMap name, got %q", first)
+	}
+	cm := &corev1.ConfigMap{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: first, Namespace: "default"}, cm); err != nil {
+		t.Fatalf("get configmap: %v", err)
+	}
+	if cm.Immutable == nil || !*cm.Immutable || cm.Data["app.yaml"] != "v: 1" {
+		t.Fatalf("expected an immutable ConfigMap with the config, got %+v", cm)
+	}
+	if name := configVolumeName(t, f); name != first {
+		t.Fatalf("expected the pod template to mount %s, got %s", first, name)
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "app-config", Namespace: "default"}, &corev1.ConfigMap{}); err == nil {
+		t.Fatalf("expected no mutable ConfigMap")
+	}
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.ToolChain.Config["app.yaml"] = "v: 2"
+	})
+	got = f.reconcile()
+	second := got.Status.ConfigMapName
+	if second == first {
+		t.Fatalf("expected a new ConfigMap for the new config")
+	}
+	if name := configVolumeName(t, f); name != second {
+		t.Fatalf("expected the pod template to mount %s, got %s", second, name)
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: first, Namespace: "default"}, &corev1.ConfigMap{}); err != nil {
+		t.Fatalf("expected the previous ConfigMap to be kept: %v", err)
+	}
+}
+
+// createConfigHistory creates the mutable ConfigMap of the Phare app and three
+// hashed ones, oldest first.
+func createConfigHistory(t *testing.T, f *reconcileFixture, phare *pharev1beta1.Phare) {
+	t.Helper()
+	now := time.Now()
+	for i, name := range []string{"app-config", "app-config-aaaaaaaaaa", "app-config-bbbbbbbbbb", "app-config-cccccccccc"} {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			Labels:            map[string]string{"app.kubernetes.io/instance": "app"},
+			CreationTimestamp: metav1.NewTime(now.Add(time.Duration(i) * time.Minute)),
+			OwnerReferences:   []metav1.OwnerReference{controllerOwnerRef(phare)},
+		}}
+		if name != "app-config" {
+			cm.Labels[configHashLabel] = strings.TrimPrefix(name, "app-config-")
+		}
+		if err := f.r.Create(f.ctx, cm); err != nil {
+			t.Fatalf("create configmap %s: %v", name, err)
+		}
+	}
+}
+
+// mountingTemplate is a pod template mounting the ConfigMap name.
+func mountingTemplate(name string) corev1.PodTemplateSpec {
+	return corev1.PodTemplateSpec{Spec: corev1.PodSpec{Volumes: []corev1.Volume{{
+		Name:         "config-volume",
+		VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}}},
+	}}}}
+}
+
+// mountingReplicaSet is a ReplicaSet with a pod mounting the ConfigMap
+// configMap, controlled by the Deployment owner if set.
+func mountingReplicaSet(name, owner string, labels map[string]string, configMap string) *appsv1.ReplicaSet {
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+		Spec:       appsv1.ReplicaSetSpec{Replicas: ptrInt32(1), Template: mountingTemplate(configMap)},
+	}
+	if owner != "" {
+		rs.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       owner,
+			UID:        types.UID(owner),
+			Controller: pointer.Bool(true),
+		}}
+	}
+	return rs
+}
+
+func expectConfigMapsKept(t *testing.T, f *reconcileFixture, want map[string]bool) {
+	t.Helper()
+	for name, kept := range want {
+		err := f.r.Get(f.ctx, client.ObjectKey{Name: name, Namespace: "default"}, &corev1.ConfigMap{})
+		if kept && err != nil {
+			t.Fatalf("expected %s to be kept: %v", name, err)
+		}
+		if !kept && err == nil {
+			t.Fatalf("expected %s to be deleted", name)
+		}
+	}
+}
+
+func TestPruneConfigMapsKeepsMountedOnes(t *testing.T) {
+	phare := basePhare("app", "default")
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{
+		Config:          pharev1beta1.ConfigSpec{"app.yaml": "v: 3"},
+		ImmutableConfig: &pharev1beta1.ImmutableConfigSpec{HistoryLimit: ptrInt32(1)},
+	}
+	f := newReconcileFixture(t, phare)
+	createConfigHistory(t, f, phare)
+	// A ReplicaSet still running pods of an older template mounts the oldest hashed ConfigMap.
+	rs := mountingReplicaSet("app-old", "", map[string]string{"app.kubernetes.io/instance": "app"}, "app-config-aaaaaaaaaa")
+	if err := f.r.Create(f.ctx, rs); err != nil {
+		t.Fatalf("create replicaset: %v", err)
+	}
+
+	got := f.reconcile()
+	expectConfigMapsKept(t, f, map[string]bool{
+		got.Status.ConfigMapName: true, // current
+		"app-config-cccccccccc":  true, // newest previous one
+		"app-config-aaaaaaaaaa":  true, // mounted by app-old
+		"app-config-bbbbbbbbbb":  false,
+		"app-config":             false,
+	})
+}
+
+func TestPruneConfigMapsKeepsOnesMountedByActiveColor(t *testing.T) {
+	phare := basePhare("app", "default")
+	phare.Spec.Service = &corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 80}}}
+	phare.Spec.Strategy = pharev1beta1.RolloutStrategyBlueGreen
+	phare.Spec.BlueGreen = &pharev1beta1.BlueGreenSpec{RequireApproval: true}
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{
+		Config:          pharev1beta1.ConfigSpec{"app.yaml": "v: 3"},
+		ImmutableConfig: &pharev1beta1.ImmutableConfigSpec{HistoryLimit: ptrInt32(1)},
+	}
+	f := newReconcileFixture(t, phare)
+	createConfigHistory(t, f, phare)
+	for _, rs := range []*appsv1.ReplicaSet{
+		// The active color still runs an older config.
+		mountingReplicaSet("app-blue-1", "app-blue", map[string]string{
+			"app.kubernetes.io/name":     "app",
+			"app.kubernetes.io/instance": "app-blue",
+		}, "app-config-aaaaaaaaaa"),
+		// Another workload with the same name label does not count.
+		mountingReplicaSet("other-1", "other", map[string]string{"app.kubernetes.io/name": "app"}, "app-config-bbbbbbbbbb"),
+	} {
+		if err := f.r.Create(f.ctx, rs); err != nil {
+			t.Fatalf("create replicaset: %v", err)
+		}
+	}
+
+	got := f.reconcile()
+	expectConfigMapsKept(t, f, map[string]bool{
+		got.Status.ConfigMapName: true,
+		"app-config-cccccccccc":  true,
+		"app-config-aaaaaaaaaa":  true, // mounted by app-blue
+		"app-config-bbbbbbbbbb":  false,
+		"app-config":             false,
+	})
+}
+
+func TestPruneConfigMapsKeepsOnesOfStatefulSetCurrentRevision(t *testing.T) {
+	phare := basePhare("app", "default")
+	phare.Spec.MicroService.Kind = "StatefulSet"
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{
+		Config:          pharev1beta1.ConfigSpec{"app.yaml": "v: 3"},
+		ImmutableConfig: &pharev1beta1.ImmutableConfigSpec{HistoryLimit: ptrInt32(1)},
+	}
+	f := newReconcileFixture(t, phare)
+	f.reconcile()
+
+	// Pods not rolled yet run the template of the current revision.
+	statefulSet := &appsv1.StatefulSet{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "app", Namespace: "default"}, statefulSet); err != nil {
+		t.Fatalf("get statefulset: %v", err)
+	}
+	template := mountingTemplate("app-config-aaaaaaaaaa")
+	data, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"template": template}})
+	if err != nil {
+		t.Fatalf("marshal revision: %v", err)
+	}
+	revision := &appsv1.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "app-5d8f7c9b6",
+			Namespace:       "default",
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(statefulSet, appsv1.SchemeGroupVersion.WithKind("StatefulSet"))},
+		},
+		Data:     runtime.RawExtension{Raw: data},
+		Revision: 1,
+	}
+	if err := f.r.Create(f.ctx, revision); err != nil {
+		t.Fatalf("create revision: %v", err)
+	}
+	statefulSet.Status.CurrentRevision = revision.Name
+	if err := f.r.Status().Update(f.ctx, statefulSet); err != nil {
+		t.Fatalf("update statefulset status: %v", err)
+	}
+	createConfigHistory(t, f, phare)
+
+	got := f.reconcile()
+	expectConfigMapsKept(t, f, map[string]bool{
+		got.Status.ConfigMapName: true,
+		"app-config-cccccccccc":  true,
+		"app-config-aaaaaaaaaa":  true, // mounted by the current revision
+		"app-config-bbbbbbbbbb":  false,
+		"app-config":             false,
+	})
+}
@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// defaultKindMigrationTimeout applies when kindMigration.timeoutSeconds is unset.
+	defaultKindMigrationTimeout = 10 * time.Minute
+
+	// kindMigrationPollInterval is how often availability of the new workload is
+	// re-checked. StatefulSet status changes are filtered out by the watch
+	// predicate, so polling is required.
+	kindMigrationPollInterval = 10 * time.Second
+)
+
+func kindMigrationStrategy(phare *pharev1beta1.Phare) pharev1beta1.KindMigrationStrategy {
+	if m := phare.Spec.MicroService.KindMigration; m != nil && m.Strategy != "" {
+		return m.Strategy
+	}
+	return pharev1beta1.KindMigrationRecreate
+}
+
+func kindMigrationTimeout(phare *pharev1beta1.Phare) time.Duration {
+	if m := phare.Spec.MicroService.KindMigration; m != nil && m.TimeoutSeconds != nil {
+		return time.Duration(*m.TimeoutSeconds) * time.Second
+	}
+	return defaultKindMigrationTimeout
+}
+
+// migrateWorkloadKind replaces the stale workload (the kind no longer named in the
+// spec) without downtime: the new workload is created first and the stale one is
+// deleted only once the new one reports the desired number of available replicas.
+// Both select pods by app=<name>, so the Service keeps routing to whichever pods
+// are ready. If the new workload is not available before the timeout, it is
+// deleted and the stale workload is kept until the Phare generation changes.
+func (r *PhareReconciler) migrateWorkloadKind(ctx context.Context, phare *pharev1beta1.Phare, stale client.Object) (ctrl.Result, error) {
+	staleKind := "Deployment"
+	if _, ok := stale.(*appsv1.StatefulSet); ok {
+		staleKind = "StatefulSet"
+	}
+	targetKind := phare.Spec.MicroService.Kind
+
+	if err := r.Get(ctx, client.ObjectKey{Name: phare.Name, Namespace: phare.Namespace}, stale); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		// Nothing to migrate from.
+		phare.Status.KindMigration = nil
+		return ctrl.Result{}, r.reconcileWorkload(ctx, *phare)
+	}
+	if !metav1.IsControlledBy(stale, phare) {
+		phare.Status.KindMigration = nil
+		return ctrl.Result{}, r.reconcileWorkload(ctx, *phare)
+	}
+
+	m := phare.Status.KindMigration
+	if m != nil && m.State == pharev1beta1.KindMigrationFailed && m.From == staleKind && m.To == targetKind &&
+		m.ObservedGeneration == phare.Generation {
+		// Keep serving from the stale workload until the spec changes.
+		return ctrl.Result{}, nil
+	}
+	if m == nil || m.State != pharev1beta1.KindMigrationProgressing || m.From != staleKind || m.To != targetKind {
+		m = &pharev1beta1.KindMigrationStatus{
+			From:      staleKind,
+			To:        targetKind,
+			State:     pharev1beta1.KindMigrationProgressing,
+			StartedAt: metav1.Now(),
+		}
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "KindMigrationStarted", "Migrating workload from %s to %s", staleKind, targetKind)
+	}
+	m.ObservedGeneration = phare.Generation
+	phare.Status.KindMigration = m
+
+	if err := r.reconcileWorkload(ctx, *phare); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	available, err := r.workloadAvailable(ctx, phare)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if available {
+		if err := r.deleteIfExists(ctx, stale, phare.Name, phare.Namespace, phare); err != nil {
+			return ctrl.Result{}, err
+		}
+		phare.Status.KindMigration = nil
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "KindMigrationCompleted", "Migrated workload from %s to %s", staleKind, targetKind)
+		return ctrl.Result{}, nil
+	}
+
+	remaining := time.Until(m.StartedAt.Add(kindMigrationTimeout(phare)))
+	if remaining <= 0 {
+		if err := r.deleteIfExists(ctx, newWorkloadObject(targetKind), phare.Name, phare.Namespace, phare); err != nil {
+			return ctrl.Result{}, err
+		}
+		m.State = pharev1beta1.KindMigrationFailed
+		r.Recorder.Eventf(phare, corev1.EventTypeWarning, "KindMigrationFailed",
+			"%s did not become available within %s; rolled back to %s", targetKind, kindMigrationTimeout(phare), staleKind)
+		return ctrl.Result{}, nil
+	}
+
+	if remaining > kindMigrationPollInterval {
+		remaining = kindMigrationPollInterval
+	}
+	return ctrl.Result{RequeueAfter: remaining}, nil
+}
+
+// workloadAvailable reports whether the workload named in the spec has rolled out
+// and has at least the desired number of available replicas.
+func (r *PhareReconciler) workloadAvailable(ctx context.Context, phare *pharev1beta1.Phare) (bool, error) {
+	if isBlueGreen(phare) {
+		st := phare.Status.BlueGreen
+		if st == nil || st.ActiveColor == "" || st.PreviewHash != "" {
+			return false, nil
+		}
+		return r.colorAvailable(ctx, phare, st.ActiveColor, st.ActiveHash)
+	}
+
+	want := *workloadReplicas(phare)
+	key := client.ObjectKey{Name: phare.Name, Namespace: phare.Namespace}
+
+	switch phare.Spec.MicroService.Kind {
+	case "Deployment":
+		d := &appsv1.Deployment{}
+		if err := r.Get(ctx, key, d); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		return d.Status.ObservedGeneration >= d.Generation &&
+			d.Status.UpdatedReplicas >= want &&
+			d.Status.AvailableReplicas >= want, nil
+	case "StatefulSet":
+		ss := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, key, ss); err != nil {
+			return false, client.IgnoreNotFound(err)
+		}
+		return ss.Status.ObservedGeneration >= ss.Generation &&
+			ss.Status.UpdatedReplicas >= want &&
+			ss.Status.AvailableReplicas >= want, nil
+	}
+	return false, nil
+}
+
+func newWorkloadObject(kind string) client.Object {
+	if kind == "StatefulSet" {
+		return &appsv1.StatefulSet{}
+	}
+	return &appsv1.Deployment{}
+}
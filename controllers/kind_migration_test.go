@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func migratingPhare(t *testing.T) (*pharev1beta1.Phare, *appsv1.StatefulSet) {
+	t.Helper()
+	old := basePhare("demo", "default")
+	old.Spec.MicroService.Kind = "StatefulSet"
+	old.Spec.MicroService.ReplicaCount = 2
+
+	builder := &PhareReconciler{Scheme: testScheme(t)}
+	existing := builder.newStatefulSet(old)
+	if existing == nil {
+		t.Fatalf("expected existing statefulset")
+	}
+
+	updated := old.DeepCopy()
+	updated.Spec.MicroService.Kind = "Deployment"
+	updated.Spec.MicroService.KindMigration = &pharev1beta1.KindMigrationSpec{
+		Strategy: pharev1beta1.KindMigrationCreateBeforeDelete,
+	}
+	return updated, existing
+}
+
+func TestKindMigrationKeepsOldWorkloadUntilNewIsAvailable(t *testing.T) {
+	scheme := testScheme(t)
+	phare, existing := migratingPhare(t)
+	r := newTestReconciler(t, scheme, phare, existing)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: phare.Name, Namespace: phare.Namespace}}
+	ctx := context.Background()
+
+	result, err := r.Reconcile(ctx, req)
+	if err != nil {
+		t.Fatalf("first reconcile: %v", err)
+	}
+	if result.RequeueAfter == 0 {
+		t.Fatalf("expected requeue while waiting for the new workload")
+	}
+	if err := r.Get(ctx, req.NamespacedName, &appsv1.StatefulSet{}); err != nil {
+		t.Fatalf("expected old statefulset to be kept during migration: %v", err)
+	}
+	deploy := &appsv1.Deployment{}
+	if err := r.Get(ctx, req.NamespacedName, deploy); err != nil {
+		t.Fatalf("expected new deployment to be created: %v", err)
+	}
+
+	current := &pharev1beta1.Phare{}
+	if err := r.Get(ctx, req.NamespacedName, current); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	if current.Status.Phase != pharev1beta1.PharePhaseReconciling {
+		t.Fatalf("expected phase Reconciling, got %q", current.Status.Phase)
+	}
+	if m := current.Status.KindMigration; m == nil || m.From != "StatefulSet" || m.To != "Deployment" {
+		t.Fatalf("unexpected migration status: %#v", m)
+	}
+
+	deploy.Status.UpdatedReplicas = 2
+	deploy.Status.AvailableReplicas = 2
+	if err := r.Status().Update(ctx, deploy); err != nil {
+		t.Fatalf("update deployment status: %v", err)
+	}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("second reconcile: %v", err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, &appsv1.StatefulSet{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected old statefulset to be deleted once the deployment is available, got %v", err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, current); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	if current.Status.KindMigration != nil {
+		t.Fatalf("expected migration status to be cleared, got %#v", current.Status.KindMigration)
+	}
+	if current.Status.Phase != pharev1beta1.PharePhaseActive {
+		t.Fatalf("expected phase Active, got %q", current.Status.Phase)
+	}
+}
+
+func TestKindMigrationRollsBackOnTimeout(t *testing.T) {
+	scheme := testScheme(t)
+	phare, existing := migratingPhare(t)
+	phare.Status.KindMigration = &pharev1beta1.KindMigrationStatus{
+		From:      "StatefulSet",
+		To:        "Deployment",
+		State:     pharev1beta1.KindMigrationProgressing,
+		StartedAt: metav1.NewTime(time.Now().Add(-time.Hour)),
+	}
+	r := newTestReconciler(t, scheme, phare, existing)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: phare.Name, Namespace: phare.Namespace}}
+	ctx := context.Background()
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected unavailable deployment to be removed, got %v", err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, &appsv1.StatefulSet{}); err != nil {
+		t.Fatalf("expected old statefulset to be kept: %v", err)
+	}
+
+	current := &pharev1beta1.Phare{}
+	if err := r.Get(ctx, req.NamespacedName, current); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	if m := current.Status.KindMigration; m == nil || m.State != pharev1beta1.KindMigrationFailed {
+		t.Fatalf("expected failed migration status, got %#v", m)
+	}
+	if current.Status.Phase != pharev1beta1.PharePhaseFailed {
+		t.Fatalf("expected phase Failed, got %q", current.Status.Phase)
+	}
+
+	// The same generation must not retry the migration.
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile after rollback: %v", err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected no retry for the same generation, got %v", err)
+	}
+}
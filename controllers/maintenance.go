@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	"github.com/localcorp/phare-controller/pkg/cron"
+)
+
+// emergencyRolloutAnnotation rolls out pod template changes regardless of the
+// maintenance windows and freezes. Its value is recorded as the reason.
+const emergencyRolloutAnnotation = "phare.localcorp.internal/emergency-rollout"
+
+const freezeDateLayout = "2006-01-02"
+
+// rolloutHold explains why the maintenance windows hold a rollout.
+type rolloutHold struct {
+	reason  string
+	message string
+	// until is when the hold is reevaluated; zero if no window opens.
+	until time.Time
+}
+
+// deferRollout reports whether the pod template change of the workload is held
+// by the maintenance windows, and sets the RolloutDeferred condition
+// accordingly. New workloads are created right away.
+func (r *PhareReconciler) deferRollout(ctx context.Context, phare *pharev1beta1.Phare) (bool, ctrl.Result, error) {
+	hold, err := r.maintenanceHold(ctx, phare, time.Now())
+	if err != nil || hold == nil {
+		apimeta.RemoveStatusCondition(&phare.Status.Conditions, pharev1beta1.ConditionRolloutDeferred)
+		return false, ctrl.Result{}, err
+	}
+	_, diff, running, err := r.rolloutPreview(ctx, phare)
+	if err != nil || !running || diff == "" {
+		apimeta.RemoveStatusCondition(&phare.Status.Conditions, pharev1beta1.ConditionRolloutDeferred)
+		return false, ctrl.Result{}, err
+	}
+	if reason := phare.Annotations[emergencyRolloutAnnotation]; reason != "" {
+		r.Recorder.Eventf(phare, corev1.EventTypeWarning, "EmergencyRollout", "Rolling out despite the maintenance windows (%s): %s", hold.message, reason)
+		apimeta.RemoveStatusCondition(&phare.Status.Conditions, pharev1beta1.ConditionRolloutDeferred)
+		return false, ctrl.Result{}, nil
+	}
+
+	if c := apimeta.FindStatusCondition(phare.Status.Conditions, pharev1beta1.ConditionRolloutDeferred); c == nil || c.Message != hold.message {
+		r.Recorder.Event(phare, corev1.EventTypeNormal, "RolloutDeferred", hold.message)
+	}
+	apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+		Type:    pharev1beta1.ConditionRolloutDeferred,
+		Status:  metav1.ConditionTrue,
+		Reason:  hold.reason,
+		Message: hold.message,
+	})
+	if hold.until.IsZero() {
+		return true, ctrl.Result{}, nil
+	}
+	wait := time.Until(hold.until)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return true, ctrl.Result{RequeueAfter: wait}, nil
+}
+
+// rolloutDeferred reports whether deferRollout held the pod template change.
+func rolloutDeferred(phare *pharev1beta1.Phare) bool {
+	return apimeta.IsStatusConditionTrue(phare.Status.Conditions, pharev1beta1.ConditionRolloutDeferred)
+}
+
+// podTemplateHeld reports whether the running pod template is kept, either
+// until it is approved or until a maintenance window opens. Replicas and the
+// rest of the workload are still reconciled.
+func podTemplateHeld(phare *pharev1beta1.Phare) bool {
+	return approvalPending(phare) || rolloutDeferred(phare)
+}
+
+// maintenanceHold returns why the maintenance specs of the Phare hold a rollout
+// at now, or nil if they allow it. With several PhareMaintenance objects the
+// hold lasting longest is reported.
+func (r *PhareReconciler) maintenanceHold(ctx context.Context, phare *pharev1beta1.Phare, now time.Time) (*rolloutHold, error) {
+	specs := []pharev1beta1.MaintenanceSpec{}
+	if phare.Spec.Maintenance != nil {
+		specs = append(specs, *phare.Spec.Maintenance)
+	} else {
+		list := &pharev1beta1.PhareMaintenanceList{}
+		if err := r.List(ctx, list, client.InNamespace(phare.Namespace)); err != nil {
+			return nil, err
+		}
+		for _, m := range list.Items {
+			specs = append(specs, m.Spec)
+		}
+	}
+
+	var longest *rolloutHold
+	for _, spec := range specs {
+		hold, err := maintenanceHold(spec, now)
+		if err != nil {
+			return nil, err
+		}
+		if hold == nil {
+			continue
+		}
+		// A zero until holds until the spec changes, longer than any other.
+		if longest == nil || (!longest.until.IsZero() && (hold.until.IsZero() || hold.until.After(longest.until))) {
+			longest = hold
+		}
+	}
+	return longest, nil
+}
+
+// maintenanceHold returns why spec holds a rollout at now, or nil if it allows
+// one. Freezes take precedence over windows.
+func maintenanceHold(spec pharev1beta1.MaintenanceSpec, now time.Time) (*rolloutHold, error) {
+	loc, err := time.LoadLocation(spec.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maintenance time zone %q: %w", spec.TimeZone, err)
+	}
+	local := now.In(loc)
+
+	for _, freeze := range spec.Freezes {
+		start, err := time.ParseInLocation(freezeDateLayout, freeze.Start, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid freeze start %q: %w", freeze.Start, err)
+		}
+		end, err := time.ParseInLocation(freezeDateLayout, freeze.End, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid freeze end %q: %w", freeze.End, err)
+		}
+		end = end.AddDate(0, 0, 1)
+		if local.Before(start) || !local.Before(end) {
+			continue
+		}
+		message := fmt.Sprintf("Rollouts are frozen until %s", end.Format(time.RFC3339))
+		if freeze.Reason != "" {
+			message += ": " + freeze.Reason
+		}
+		return &rolloutHold{reason: pharev1beta1.ReasonFrozen, message: message, until: end}, nil
+	}
+
+	if len(spec.Windows) == 0 {
+		return nil, nil
+	}
+	var next time.Time
+	for _, window := range spec.Windows {
+		schedule, err := cron.Parse(window.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window: %w", err)
+		}
+		// The window is open if it opened within the last Duration.
+		if opened := schedule.Next(local.Add(-window.Duration.Duration)); !opened.IsZero() && !opened.After(local) {
+			return nil, nil
+		}
+		if opens := schedule.Next(local); !opens.IsZero() && (next.IsZero() || opens.Before(next)) {
+			next = opens
+		}
+	}
+	message := "Outside the maintenance windows"
+	if !next.IsZero() {
+		message += "; the next window opens at " + next.Format(time.RFC3339)
+	}
+	return &rolloutHold{reason: pharev1beta1.ReasonOutsideMaintenanceWindow, message: message, until: next}, nil
+}
+
+// maintenanceToPhares maps a PhareMaintenance to the Phares of its namespace
+// that it applies to.
+func (r *PhareReconciler) maintenanceToPhares(ctx context.Context, obj client.Object) []reconcile.Request {
+	phares := &pharev1beta1.PhareList{}
+	if err := r.List(ctx, phares, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "Failed to list Phares for PhareMaintenance", "PhareMaintenance.Namespace", obj.GetNamespace(), "PhareMaintenance.Name", obj.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, phare := range phares.Items {
+		if phare.Spec.Maintenance == nil {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&phare)})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMaintenanceHold(t *testing.T) {
+	weekdayMornings := []pharev1beta1.MaintenanceWindow{{
+		Schedule: "0 9 * * mon-fri",
+		Duration: metav1.Duration{Duration: 2 * time.Hour},
+	}}
+	// Wednesday 2024-01-31.
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.January, 31, hour, minute, 0, 0, time.UTC)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		spec      pharev1beta1.MaintenanceSpec
+		now       time.Time
+		wantHold  bool
+		wantUntil time.Time
+	}{
+		{name: "no windows", spec: pharev1beta1.MaintenanceSpec{}, now: at(3, 0)},
+		{name: "window open", spec: pharev1beta1.MaintenanceSpec{Windows: weekdayMornings}, now: at(10, 59)},
+		{name: "window closed", spec: pharev1beta1.MaintenanceSpec{Windows: weekdayMornings}, now: at(11, 0), wantHold: true,
+			wantUntil: time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC)},
+		{name: "window in time zone", spec: pharev1beta1.MaintenanceSpec{Windows: weekdayMornings, TimeZone: "Asia/Tokyo"}, now: at(1, 0)},
+		{name: "frozen", now: at(10, 0), wantHold: true,
+			spec: pharev1beta1.MaintenanceSpec{
+				Windows: weekdayMornings,
+				Freezes: []pharev1beta1.FreezePeriod{{Start: "2024-01-30", End: "2024-01-31"}},
+			},
+			wantUntil: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "freeze over", now: at(10, 0),
+			spec: pharev1beta1.MaintenanceSpec{Freezes: []pharev1beta1.FreezePeriod{{Start: "2024-01-29", End: "2024-01-30"}}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			hold, err := maintenanceHold(tc.spec, tc.now)
+			if err != nil {
+				t.Fatalf("maintenanceHold: %v", err)
+			}
+			if (hold != nil) != tc.wantHold {
+				t.Fatalf("expected hold %v, got %+v", tc.wantHold, hold)
+			}
+			if hold != nil && !hold.until.Equal(tc.wantUntil) {
+				t.Fatalf("expected hold until %v, got %v", tc.wantUntil, hold.until)
+			}
+		})
+	}
+
+	if _, err := maintenanceHold(pharev1beta1.MaintenanceSpec{TimeZone: "Nowhere/Special"}, at(0, 0)); err == nil {
+		t.Fatalf("expected an invalid time zone to fail")
+	}
+}
+
+// frozenToday freezes rollouts for the current day and the next.
+func frozenToday() *pharev1beta1.MaintenanceSpec {
+	now := time.Now().UTC()
+	return &pharev1beta1.MaintenanceSpec{
+		Freezes: []pharev1beta1.FreezePeriod{{
+			Start:  now.Format(freezeDateLayout),
+			End:    now.AddDate(0, 0, 1).Format(freezeDateLayout),
+			Reason: "release freeze",
+		}},
+	}
+}
+
+func TestMaintenanceDefersPodTemplateChange(t *testing.T) {
+	phare := basePhare("demo", "default")
+	phare.Spec.Maintenance = frozenToday()
+	f := newReconcileFixture(t, phare)
+
+	f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:latest" {
+		t.Fatalf("expected the workload to be created during a freeze, got %q", img)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.MicroService.Image.Tag = "v2"
+		p.Spec.MicroService.ReplicaCount = 3
+	})
+	got := f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:latest" {
+		t.Fatalf("expected the image change to be deferred, got %q", img)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: "demo", Namespace: "default"}, deployment); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if *deployment.Spec.Replicas != 3 {
+		t.Fatalf("expected the replica change to be applied, got %d", *deployment.Spec.Replicas)
+	}
+	c := apimeta.FindStatusCondition(got.Status.Conditions, pharev1beta1.ConditionRolloutDeferred)
+	if c == nil || c.Status != metav1.ConditionTrue || c.Reason != pharev1beta1.ReasonFrozen || !strings.Contains(c.Message, "release freeze") {
+		t.Fatalf("expected a RolloutDeferred condition, got %+v", c)
+	}
+	if got.Status.Phase != pharev1beta1.PharePhaseReconciling {
+		t.Fatalf("expected phase Reconciling, got %s", got.Status.Phase)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Annotations = map[string]string{emergencyRolloutAnnotation: "INC-42"}
+	})
+	got = f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:v2" {
+		t.Fatalf("expected the emergency override to roll out, got %q", img)
+	}
+	if apimeta.FindStatusCondition(got.Status.Conditions, pharev1beta1.ConditionRolloutDeferred) != nil {
+		t.Fatalf("expected RolloutDeferred to be cleared")
+	}
+}
+
+func TestNamespaceMaintenanceApplies(t *testing.T) {
+	f := newReconcileFixture(t, basePhare("demo", "default"))
+	f.reconcile()
+
+	maintenance := &pharev1beta1.PhareMaintenance{
+		ObjectMeta: metav1.ObjectMeta{Name: "freeze", Namespace: "default"},
+		Spec:       *frozenToday(),
+	}
+	if err := f.r.Create(f.ctx, maintenance); err != nil {
+		t.Fatalf("create maintenance: %v", err)
+	}
+	if reqs := f.r.maintenanceToPhares(f.ctx, maintenance); len(reqs) != 1 || reqs[0].Name != "demo" {
+		t.Fatalf("expected the maintenance to requeue demo, got %v", reqs)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.MicroService.Image.Tag = "v2" })
+	f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:latest" {
+		t.Fatalf("expected the namespace freeze to defer the change, got %q", img)
+	}
+
+	// A Phare schedule replaces the ones of the namespace.
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.Maintenance = &pharev1beta1.MaintenanceSpec{} })
+	f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:v2" {
+		t.Fatalf("expected the Phare schedule to allow the change, got %q", img)
+	}
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+)
+
+var (
+	subReconcilerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "phare_subreconciler_duration_seconds",
+		Help:    "Duration of the sub-reconcilers of a Phare reconcile.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"subreconciler"})
+
+	resourceOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "phare_resource_operations_total",
+		Help: "Objects created, updated, patched and deleted by the controller, by kind.",
+	}, []string{"kind", "operation"})
+
+	driftDetections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "phare_drift_detections_total",
+		Help: "Objects changed outside the controller since it last wrote them, found when writing them again, by kind.",
+	}, []string{"kind"})
+
+	pharePhase = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "phare_status_phase",
+		Help: "Phase of a Phare: 1 for its current phase, 0 for the others.",
+	}, []string{"namespace", "name", "phase"})
+
+	phareReady = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "phare_ready",
+		Help: "Whether the Ready condition of a Phare is True.",
+	}, []string{"namespace", "name"})
+)
+
+// pharePhases are the phases reported by phare_status_phase.
+var pharePhases = []pharev1beta1.PharePhase{
+	pharev1beta1.PharePhaseReconciling,
+	pharev1beta1.PharePhaseActive,
+	pharev1beta1.PharePhaseFailed,
+	pharev1beta1.PharePhasePaused,
+	pharev1beta1.PharePhaseSuspended,
+	pharev1beta1.PharePhaseRolledBack,
+}
+
+func init() {
+	metrics.Registry.MustRegister(subReconcilerDuration, resourceOperations, driftDetections, pharePhase, phareReady)
+}
+
+// timeSubReconciler runs fn and records its duration under name.
+func timeSubReconciler(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	subReconcilerDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// recordPhareMetrics sets the phase and ready gauges of phare.
+func recordPhareMetrics(phare *pharev1beta1.Phare) {
+	for _, phase := range pharePhases {
+		value := 0.0
+		if phare.Status.Phase == phase {
+			value = 1
+		}
+		pharePhase.WithLabelValues(phare.Namespace, phare.Name, string(phase)).Set(value)
+	}
+	ready := 0.0
+	if apimeta.IsStatusConditionTrue(phare.Status.Conditions, pharev1beta1.ConditionReady) {
+		ready = 1
+	}
+	phareReady.WithLabelValues(phare.Namespace, phare.Name).Set(ready)
+}
+
+// forgetPhareMetrics deletes the gauges of a deleted Phare.
+func forgetPhareMetrics(key types.NamespacedName) {
+	labels := prometheus.Labels{"namespace": key.Namespace, "name": key.Name}
+	pharePhase.DeletePartialMatch(labels)
+	phareReady.Delete(labels)
+}
+
+// metricsClient counts the writes of the client it wraps, and detects drift:
+// an object the controller updates or patches again whose generation, or
+// resource version for kinds without one, is newer than its last write.
+// Only Phares and the objects they control are tracked, and they are
+// forgotten with their Phare.
+type metricsClient struct {
+	client.Client
+
+	mu sync.Mutex
+	// written is the version of the objects after the last write of the
+	// controller.
+	written map[writtenKey]writtenVersion
+}
+
+type writtenKey struct {
+	gvk schema.GroupVersionKind
+	types.NamespacedName
+}
+
+type writtenVersion struct {
+	// phare is the Phare controlling the object, or the object itself.
+	phare           types.NamespacedName
+	generation      int64
+	resourceVersion string
+}
+
+// NewMetricsClient wraps c to report the phare_resource_operations_total and
+// phare_drift_detections_total metrics. Status writes are not counted.
+func NewMetricsClient(c client.Client) client.Client {
+	return &metricsClient{Client: c, written: map[writtenKey]writtenVersion{}}
+}
+
+func (c *metricsClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if err := c.Client.Create(ctx, obj, opts...); err != nil {
+		return err
+	}
+	c.recordWrite(obj, "create")
+	return nil
+}
+
+func (c *metricsClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.detectDrift(obj)
+	if err := c.Client.Update(ctx, obj, opts...); err != nil {
+		return err
+	}
+	c.recordWrite(obj, "update")
+	return nil
+}
+
+func (c *metricsClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.detectDrift(obj)
+	if err := c.Client.Patch(ctx, obj, patch, opts...); err != nil {
+		return err
+	}
+	c.recordWrite(obj, "patch")
+	return nil
+}
+
+func (c *metricsClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if err := c.Client.Delete(ctx, obj, opts...); err != nil {
+		return err
+	}
+	gvk, key := c.key(obj)
+	resourceOperations.WithLabelValues(gvk.Kind, "delete").Inc()
+	c.mu.Lock()
+	delete(c.written, key)
+	c.mu.Unlock()
+	return nil
+}
+
+// detectDrift counts a drift when obj, as read from the cluster, is newer
+// than the version the controller last wrote. An older version is a stale
+// read of the cache, not a drift.
+func (c *metricsClient) detectDrift(obj client.Object) {
+	gvk, key := c.key(obj)
+	c.mu.Lock()
+	last, ok := c.written[key]
+	c.mu.Unlock()
+	if ok && newerThan(obj, last) {
+		driftDetections.WithLabelValues(gvk.Kind).Inc()
+	}
+}
+
+func (c *metricsClient) recordWrite(obj client.Object, operation string) {
+	gvk, key := c.key(obj)
+	resourceOperations.WithLabelValues(gvk.Kind, operation).Inc()
+	phare, ok := owningPhare(obj, gvk)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	c.written[key] = writtenVersion{phare: phare, generation: obj.GetGeneration(), resourceVersion: obj.GetResourceVersion()}
+	c.mu.Unlock()
+}
+
+// forgetPhare drops the versions of a deleted Phare and of the objects it
+// controlled, which are garbage collected without the controller.
+func (c *metricsClient) forgetPhare(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, v := range c.written {
+		if v.phare == key {
+			delete(c.written, k)
+		}
+	}
+}
+
+// forgetPhareWrites drops what c recorded for a deleted Phare, when c
+// records writes.
+func forgetPhareWrites(c client.Client, key types.NamespacedName) {
+	if mc, ok := c.(*metricsClient); ok {
+		mc.forgetPhare(key)
+	}
+}
+
+func (c *metricsClient) key(obj client.Object) (schema.GroupVersionKind, writtenKey) {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		gvk = schema.GroupVersionKind{Kind: "Unknown"}
+	}
+	return gvk, writtenKey{gvk: gvk, NamespacedName: client.ObjectKeyFromObject(obj)}
+}
+
+// owningPhare returns obj if it is a Phare, or the Phare controlling it.
+func owningPhare(obj client.Object, gvk schema.GroupVersionKind) (types.NamespacedName, bool) {
+	if gvk.GroupKind() == pharev1beta1.GroupVersion.WithKind("Phare").GroupKind() {
+		return client.ObjectKeyFromObject(obj), true
+	}
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil || owner.Kind != "Phare" || !strings.HasPrefix(owner.APIVersion, pharev1beta1.GroupVersion.Group+"/") {
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: obj.GetNamespace(), Name: owner.Name}, true
+}
+
+// newerThan reports whether obj is newer than last: a higher generation,
+// which only changes with the spec, or a higher resource version for kinds
+// without a generation. Resource versions that are not numbers are only
+// compared for equality.
+func newerThan(obj client.Object, last writtenVersion) bool {
+	if obj.GetGeneration() != 0 && last.generation != 0 {
+		return obj.GetGeneration() > last.generation
+	}
+	observed, err1 := strconv.ParseUint(obj.GetResourceVersion(), 10, 64)
+	written, err2 := strconv.ParseUint(last.resourceVersion, 10, 64)
+	if err1 != nil || err2 != nil {
+		return obj.GetResourceVersion() != "" && obj.GetResourceVersion() != last.resourceVersion
+	}
+	return observed > written
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+)
+
+func TestMetricsCountWritesDriftAndPhase(t *testing.T) {
+	phare := basePhare("metrics", "default")
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{Config: pharev1beta1.ConfigSpec{"app.conf": "a"}}
+	f := newReconcileFixture(t, phare)
+	direct := f.r.Client
+	f.r.Client = NewMetricsClient(direct)
+
+	createdConfigMaps := testutil.ToFloat64(resourceOperations.WithLabelValues("ConfigMap", "create"))
+	drifts := testutil.ToFloat64(driftDetections.WithLabelValues("ConfigMap"))
+	got := f.reconcile()
+	if n := testutil.ToFloat64(resourceOperations.WithLabelValues("ConfigMap", "create")) - createdConfigMaps; n != 1 {
+		t.Fatalf("expected 1 ConfigMap create, got %v", n)
+	}
+	if testutil.CollectAndCount(subReconcilerDuration) == 0 {
+		t.Fatalf("expected the sub-reconciler durations to be recorded")
+	}
+	if v := testutil.ToFloat64(pharePhase.WithLabelValues("default", "metrics", string(got.Status.Phase))); v != 1 {
+		t.Fatalf("expected the %s phase gauge to be 1, got %v", got.Status.Phase, v)
+	}
+
+	// Reconciling again writes nothing the controller did not write itself.
+	f.reconcile()
+	if n := testutil.ToFloat64(driftDetections.WithLabelValues("ConfigMap")) - drifts; n != 0 {
+		t.Fatalf("expected no drift, got %v", n)
+	}
+
+	// A stale read of the cache, older than the last write, is not drift.
+	metrics := f.r.Client.(*metricsClient)
+	stale := &corev1.ConfigMap{}
+	if err := direct.Get(f.ctx, client.ObjectKey{Name: "metrics-config", Namespace: "default"}, stale); err != nil {
+		t.Fatalf("get configmap: %v", err)
+	}
+	stale.ResourceVersion = "1"
+	metrics.detectDrift(stale)
+	if n := testutil.ToFloat64(driftDetections.WithLabelValues("ConfigMap")) - drifts; n != 0 {
+		t.Fatalf("expected a stale read not to be drift, got %v", n)
+	}
+
+	// An edit made outside the controller is reverted and counted as drift.
+	cm := &corev1.ConfigMap{}
+	if err := direct.Get(f.ctx, client.ObjectKey{Name: "metrics-config", Namespace: "default"}, cm); err != nil {
+		t.Fatalf("get configmap: %v", err)
+	}
+	cm.Data["app.conf"] = "edited"
+	if err := direct.Update(f.ctx, cm); err != nil {
+		t.Fatalf("update configmap: %v", err)
+	}
+	f.reconcile()
+	if n := testutil.ToFloat64(driftDetections.WithLabelValues("ConfigMap")) - drifts; n != 1 {
+		t.Fatalf("expected 1 drift, got %v", n)
+	}
+
+	if len(metrics.written) == 0 {
+		t.Fatalf("expected the writes to the children to be recorded")
+	}
+	if err := direct.Delete(f.ctx, got); err != nil {
+		t.Fatalf("delete phare: %v", err)
+	}
+	if _, err := f.r.Reconcile(f.ctx, f.req); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	for _, phase := range pharePhases {
+		if pharePhase.DeleteLabelValues("default", "metrics", string(phase)) {
+			t.Fatalf("expected the gauges of the deleted Phare to be removed")
+		}
+	}
+	// Its children are garbage collected without the controller.
+	if len(metrics.written) != 0 {
+		t.Fatalf("expected the writes of the deleted Phare to be forgotten, got %v", metrics.written)
+	}
+}
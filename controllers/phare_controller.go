@@ -18,39 +18,76 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
 	"github.com/go-logr/logr"
 	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	"github.com/localcorp/phare-controller/pkg/analysis"
+	"github.com/localcorp/phare-controller/pkg/gitsource"
 )
 
 // PhareReconciler reconciles a Phare object
 type PhareReconciler struct {
 	client.Client
-	Log      logr.Logger
-	Scheme   *runtime.Scheme
-	Recorder record.EventRecorder
+	// APIReader reads directly from the API server. It is used for rare lookups
+	// of kinds the controller does not watch; the cached Client is used if nil.
+	APIReader client.Reader
+	Log       logr.Logger
+	Scheme    *runtime.Scheme
+	Recorder  record.EventRecorder
+	// Analysis runs canary analysis queries; a Prometheus client is used if nil.
+	Analysis analysis.Querier
+	// PrometheusAddress is used by canary analyses that do not set an address.
+	PrometheusAddress string
+	// ClusterDomain is the DNS domain of Service addresses; cluster.local if empty.
+	ClusterDomain string
+	// ClusterName is available to templates as {{ .Cluster.Name }}.
+	ClusterName string
+	// EncryptionKeys is the Secret holding the keys, by key id, that decrypt
+	// sealed spec.toolchain.secrets values.
+	EncryptionKeys types.NamespacedName
+	// GitFetcher fetches spec.toolchain.configFrom.git; a gitsource.Git is
+	// used if nil.
+	GitFetcher gitsource.Fetcher
+
+	gitConfig gitConfigCache
 }
 
 //+kubebuilder:rbac:groups=phare.localcorp.internal,resources=phares,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=phare.localcorp.internal,resources=phares/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=phare.localcorp.internal,resources=phares/finalizers,verbs=update
+//+kubebuilder:rbac:groups=phare.localcorp.internal,resources=phareapprovals,verbs=get;list;watch
+//+kubebuilder:rbac:groups=phare.localcorp.internal,resources=pharemaintenances,verbs=get;list;watch
 //+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;patch
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;patch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.gke.io,resources=gcpbackendpolicies,verbs=get;list;watch;create;update;patch;delete
@@ -65,52 +102,231 @@ func (r *PhareReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		return ctrl.Result{}, err
 	}
 	if !found {
+		r.gitConfig.set(req.NamespacedName, nil)
+		forgetPhareMetrics(req.NamespacedName)
+		forgetPhareWrites(r.Client, req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
 
-	if err := r.reconcileResources(ctx, req, phare); err != nil {
+	observed := *phare.Status.DeepCopy()
+	if isPaused(&phare) {
+		r.Log.Info("Reconciliation is paused", "Phare.Namespace", phare.Namespace, "Phare.Name", phare.Name)
+		return ctrl.Result{}, r.updateStatus(ctx, &phare, observed, pharev1beta1.PharePhasePaused, "Reconciliation is paused")
+	}
+
+	result, err := r.reconcileResources(ctx, req, &phare)
+	if err != nil {
 		// Best-effort: record Failed status. The original error is returned
 		// regardless so the controller requeues even if the status write fails.
-		r.updateStatus(ctx, &phare, pharev1beta1.PharePhaseFailed, err.Error()) //nolint:errcheck
-		return ctrl.Result{}, err
+		r.updateStatus(ctx, &phare, observed, pharev1beta1.PharePhaseFailed, err.Error()) //nolint:errcheck
+		return result, err
+	}
+
+	if err := r.setReadyCondition(ctx, &phare); err != nil {
+		r.updateStatus(ctx, &phare, observed, pharev1beta1.PharePhaseFailed, err.Error()) //nolint:errcheck
+		return result, err
 	}
 
 	// Propagate status-write failures on the success path so the controller
 	// requeues instead of silently leaving stale status.
-	return ctrl.Result{}, r.updateStatus(ctx, &phare, pharev1beta1.PharePhaseActive, "Successfully reconciled Phare resource")
+	phase, message := reconciledPhase(&phare)
+	result = mergeResults(mergeResults(result, scalingRequeue(&phare)), r.configFromRequeue(&phare))
+	return result, r.updateStatus(ctx, &phare, observed, phase, message)
 }
 
-// reconcileResources runs every sub-reconciler in dependency order.
-func (r *PhareReconciler) reconcileResources(ctx context.Context, req ctrl.Request, phare pharev1beta1.Phare) error {
-	if err := r.reconcileConfigMap(ctx, phare); err != nil {
-		return err
+// reconcileResources runs every sub-reconciler in dependency order. Sub-reconcilers
+// may record progress in phare.Status; it is persisted by the caller.
+func (r *PhareReconciler) reconcileResources(ctx context.Context, req ctrl.Request, phare *pharev1beta1.Phare) (ctrl.Result, error) {
+	if err := r.resolveRevision(ctx, phare); err != nil {
+		return ctrl.Result{}, err
 	}
-	if err := r.reconcileService(ctx, req, phare); err != nil {
-		return err
+	if err := r.resolveReplicas(phare, time.Now()); err != nil {
+		return ctrl.Result{}, err
 	}
-	if err := r.handleHTTPRoute(ctx, req, phare); err != nil {
-		return err
+	if err := r.resolvePhareEnv(ctx, phare); err != nil {
+		return ctrl.Result{}, err
 	}
-	if err := r.handleGCPBackendPolicy(ctx, req, phare); err != nil {
-		return err
+	if err := r.resolveConfigFrom(ctx, phare); err != nil {
+		return ctrl.Result{}, err
+	}
+	err := timeSubReconciler("configmap", func() error {
+		if err := r.renderTemplates(ctx, phare); err != nil {
+			return err
+		}
+		return r.reconcileConfigMap(ctx, phare)
+	})
+	if err := r.recordTemplateRender(phare, err); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileSecrets(ctx, phare); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := timeSubReconciler("service", func() error { return r.reconcileService(ctx, req, *phare) }); err != nil {
+		return ctrl.Result{}, err
+	}
+	held, err := r.awaitApproval(ctx, phare)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	var canaryResult ctrl.Result
+	if !held {
+		// A held canary keeps its current candidate and weight. Approving
+		// through the annotation or a PhareApproval requeues the Phare.
+		if canaryResult, err = r.reconcileCanary(ctx, phare); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if err := timeSubReconciler("httproute", func() error { return r.handleHTTPRoute(ctx, req, *phare) }); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := timeSubReconciler("policies", func() error {
+		if err := r.handleGCPBackendPolicy(ctx, req, *phare); err != nil {
+			return err
+		}
+		return r.handleHealthCheckPolicy(ctx, req, *phare)
+	}); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.recordSuspension(ctx, phare); err != nil {
+		return ctrl.Result{}, err
+	}
+	waiting, err := r.awaitDependencies(ctx, phare)
+	if err != nil || waiting {
+		// Dependencies requeue the Phare through the dependsOn index once ready.
+		return canaryResult, err
+	}
+	deferred, deferResult, err := r.deferRollout(ctx, phare)
+	if err != nil {
+		return canaryResult, err
+	}
+	if held || deferred {
+		// Apply the workload changes the approval and the maintenance windows
+		// allow, e.g. replicas; hooks and rollout checks wait for the held pod
+		// template.
+		result, err := r.timeWorkload(ctx, phare)
+		if err != nil {
+			return result, err
+		}
+		r.finishResume(phare)
+		return mergeResults(mergeResults(result, canaryResult), deferResult), nil
 	}
-	if err := r.handleHealthCheckPolicy(ctx, req, phare); err != nil {
+	ready, err := r.runPreDeployHook(ctx, phare)
+	if err != nil || !ready {
+		// The hook Job's status change requeues the Phare through Owns.
+		return canaryResult, err
+	}
+	result, err := r.timeWorkload(ctx, phare)
+	if err != nil {
+		return result, err
+	}
+	result = mergeResults(result, canaryResult)
+	r.finishResume(phare)
+	rolloutResult, err := r.checkRollout(ctx, phare)
+	if err != nil {
+		return result, err
+	}
+	result = mergeResults(result, rolloutResult)
+	hookResult, err := r.runPostDeployHook(ctx, phare)
+	if err != nil {
+		return result, err
+	}
+	return mergeResults(result, hookResult), nil
+}
+
+// timeWorkload runs reconcileMicroService under the workload sub-reconciler
+// duration metric.
+func (r *PhareReconciler) timeWorkload(ctx context.Context, phare *pharev1beta1.Phare) (ctrl.Result, error) {
+	var result ctrl.Result
+	err := timeSubReconciler("workload", func() error {
+		var err error
+		result, err = r.reconcileMicroService(ctx, phare)
 		return err
+	})
+	return result, err
+}
+
+// mergeResults combines the results of two reconcile steps, requeueing at the
+// earliest requested time.
+func mergeResults(a, b ctrl.Result) ctrl.Result {
+	if b.RequeueAfter > 0 && (a.RequeueAfter == 0 || b.RequeueAfter < a.RequeueAfter) {
+		a.RequeueAfter = b.RequeueAfter
 	}
-	return r.reconcileMicroService(ctx, phare)
+	a.Requeue = a.Requeue || b.Requeue
+	return a
 }
 
-// updateStatus writes phase/message to the Phare status subresource, skipping the
-// write when the status is already up-to-date. The returned error should be
-// propagated on success paths so the controller requeues on status write failure.
-// On error paths it is safe to discard the return value because the original
-// reconcile error already causes a requeue.
-func (r *PhareReconciler) updateStatus(ctx context.Context, phare *pharev1beta1.Phare, phase pharev1beta1.PharePhase, message string) error {
-	if phare.Status.Phase == phase && phare.Status.Message == message {
-		return nil
+// reconciledPhase derives the phase and message reported after a reconcile pass
+// that returned no error.
+func reconciledPhase(phare *pharev1beta1.Phare) (pharev1beta1.PharePhase, string) {
+	if m := phare.Status.KindMigration; m != nil {
+		switch m.State {
+		case pharev1beta1.KindMigrationProgressing:
+			return pharev1beta1.PharePhaseReconciling, fmt.Sprintf("Migrating workload from %s to %s", m.From, m.To)
+		case pharev1beta1.KindMigrationFailed:
+			return pharev1beta1.PharePhaseFailed, fmt.Sprintf("%s did not become available in time; keeping %s", m.To, m.From)
+		}
+	}
+	if phare.Spec.Suspend {
+		return pharev1beta1.PharePhaseSuspended, "Workload is scaled to zero"
+	}
+	if rb := phare.Status.RolledBack; rb != nil {
+		return pharev1beta1.PharePhaseRolledBack, fmt.Sprintf("Running rolled-back revision %d: %s", rb.Revision, rb.Reason)
+	}
+	if c := apimeta.FindStatusCondition(phare.Status.Conditions, pharev1beta1.ConditionRolloutFailed); c != nil && c.Status == metav1.ConditionTrue {
+		return pharev1beta1.PharePhaseFailed, c.Message
+	}
+	for _, conditionType := range []string{pharev1beta1.ConditionDependenciesNotReady, pharev1beta1.ConditionApprovalPending, pharev1beta1.ConditionRolloutDeferred} {
+		if c := apimeta.FindStatusCondition(phare.Status.Conditions, conditionType); c != nil && c.Status == metav1.ConditionTrue {
+			return pharev1beta1.PharePhaseReconciling, c.Message
+		}
 	}
+	if st := phare.Status.BlueGreen; st != nil {
+		switch st.State {
+		case pharev1beta1.BlueGreenDeploying:
+			return pharev1beta1.PharePhaseReconciling, fmt.Sprintf("Deploying pod template %s to %s", st.PreviewHash, idleColor(phare))
+		case pharev1beta1.BlueGreenAwaitingApproval:
+			return pharev1beta1.PharePhaseReconciling, fmt.Sprintf("Waiting for approval to switch to %s (pod template %s)", idleColor(phare), st.PreviewHash)
+		}
+	}
+	if st := phare.Status.Canary; st != nil {
+		switch st.State {
+		case pharev1beta1.CanaryPromoting:
+			return pharev1beta1.PharePhaseReconciling, fmt.Sprintf("Promoting canary %s", imageRef(st.Image))
+		case pharev1beta1.CanaryAborted:
+			if st.AnalysisFailure != "" {
+				return pharev1beta1.PharePhaseActive, fmt.Sprintf("Canary %s aborted by analysis: %s", imageRef(st.Image), st.AnalysisFailure)
+			}
+			return pharev1beta1.PharePhaseActive, fmt.Sprintf("Canary %s aborted; all traffic is on the stable workload", imageRef(st.Image))
+		default:
+			return pharev1beta1.PharePhaseActive, fmt.Sprintf("Canary %s at %d%% of traffic", imageRef(st.Image), st.Weight)
+		}
+	}
+	for _, conditionType := range []string{pharev1beta1.ConditionPreDeployHookComplete, pharev1beta1.ConditionPostDeployHookComplete} {
+		c := apimeta.FindStatusCondition(phare.Status.Conditions, conditionType)
+		if c == nil || c.Status == metav1.ConditionTrue {
+			continue
+		}
+		if c.Reason == pharev1beta1.ReasonHookFailed {
+			return pharev1beta1.PharePhaseFailed, c.Message
+		}
+		return pharev1beta1.PharePhaseReconciling, c.Message
+	}
+	return pharev1beta1.PharePhaseActive, "Successfully reconciled Phare resource"
+}
+
+// updateStatus writes phase/message to the Phare status subresource, skipping the
+// write when the status is unchanged from observed (the status read at the start
+// of the reconcile). The returned error should be propagated on success paths so
+// the controller requeues on status write failure. On error paths it is safe to
+// discard the return value because the original reconcile error already causes
+// a requeue.
+func (r *PhareReconciler) updateStatus(ctx context.Context, phare *pharev1beta1.Phare, observed pharev1beta1.PhareStatus, phase pharev1beta1.PharePhase, message string) error {
 	phare.Status.Phase = phase
 	phare.Status.Message = message
+	recordPhareMetrics(phare)
+	if equality.Semantic.DeepEqual(phare.Status, observed) {
+		return nil
+	}
 	if err := r.Status().Update(ctx, phare); err != nil {
 		r.Log.Error(err, "Failed to update Phare status")
 		return err
@@ -149,15 +365,33 @@ func (r *PhareReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		UpdateFunc: statefulSetUpdatePredicate(),
 	}
 
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &pharev1beta1.Phare{}, dependsOnIndex, dependsOnIndexValues); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &pharev1beta1.Phare{}, phareEnvIndex, phareEnvIndexValues); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &pharev1beta1.Phare{}, referencedConfigIndex, referencedConfigIndexValues); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&pharev1beta1.Phare{}).
 		Owns(&appsv1.Deployment{}, builder.WithPredicates(labelFilter)).
 		Owns(&appsv1.StatefulSet{}, builder.WithPredicates(labelFilter, statefulSetPredicate)). // Apply the predicate here
 		Owns(&corev1.Service{}, builder.WithPredicates(labelFilter)).
 		Owns(&corev1.ConfigMap{}, builder.WithPredicates(labelFilter)).
+		Owns(&corev1.Secret{}, builder.WithPredicates(labelFilter)).
 		Owns(&gatewayv1beta1.HTTPRoute{}, builder.WithPredicates(labelFilter)).
+		Owns(&batchv1.Job{}, builder.WithPredicates(labelFilter)).
 		Owns(gcpBackendPolicy, builder.WithPredicates(labelFilter)).
 		Owns(healthCheckPolicy, builder.WithPredicates(labelFilter)).
+		Watches(&pharev1beta1.Phare{}, handler.EnqueueRequestsFromMapFunc(r.dependentsOf)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.referencingPhares("ConfigMap"))).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.referencingPhares("Secret"))).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.encryptionKeysToPhares)).
+		Watches(&pharev1beta1.PhareApproval{}, handler.EnqueueRequestsFromMapFunc(approvalToPhare)).
+		Watches(&pharev1beta1.PhareMaintenance{}, handler.EnqueueRequestsFromMapFunc(r.maintenanceToPhares)).
 		Complete(r)
 }
 
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+)
+
+// phareEnvIndex indexes Phares by the namespace/name of the Phares their
+// spec.microservice.phareEnv refers to.
+const phareEnvIndex = "spec.microservice.phareEnv"
+
+const defaultClusterDomain = "cluster.local"
+
+// resolvePhareEnv appends spec.microservice.phareEnv, resolved to addresses,
+// to spec.microservice.env in memory, before the workload is built.
+func (r *PhareReconciler) resolvePhareEnv(ctx context.Context, phare *pharev1beta1.Phare) error {
+	if len(phare.Spec.MicroService.PhareEnv) == 0 {
+		return nil
+	}
+	env := make([]corev1.EnvVar, 0, len(phare.Spec.MicroService.Env)+len(phare.Spec.MicroService.PhareEnv))
+	env = append(env, phare.Spec.MicroService.Env...)
+	for _, v := range phare.Spec.MicroService.PhareEnv {
+		address, err := r.phareAddress(ctx, phare, v.PhareRef)
+		if err != nil {
+			return fmt.Errorf("failed to resolve env %s: %w", v.Name, err)
+		}
+		env = append(env, corev1.EnvVar{Name: v.Name, Value: address})
+	}
+	phare.Spec.MicroService.Env = env
+	return nil
+}
+
+// phareAddress resolves ref to the Service address or HTTPRoute hostname of
+// the referenced Phare.
+func (r *PhareReconciler) phareAddress(ctx context.Context, phare *pharev1beta1.Phare, ref pharev1beta1.PhareAddressRef) (string, error) {
+	key := phareRefKey(phare, ref)
+	target := &pharev1beta1.Phare{}
+	if err := r.Get(ctx, key, target); err != nil {
+		return "", fmt.Errorf("failed to get Phare %s: %w", key, err)
+	}
+
+	var address string
+	if ref.HTTPRoute {
+		tc := target.Spec.ToolChain
+		if tc == nil || tc.HTTPRoute == nil || len(tc.HTTPRoute.Hostnames) == 0 {
+			return "", fmt.Errorf("phare %s has no HTTPRoute hostname", key)
+		}
+		renderer, err := r.templateRenderer(ctx, target)
+		if err != nil {
+			return "", err
+		}
+		if address, err = renderer.RenderField("spec.toolchain.httpRoute.hostnames[0]", "", string(tc.HTTPRoute.Hostnames[0])); err != nil {
+			return "", fmt.Errorf("phare %s: %w", key, err)
+		}
+	} else {
+		if target.Spec.Service == nil {
+			return "", fmt.Errorf("phare %s has no Service", key)
+		}
+		port, err := servicePort(target.Spec.Service.Ports, ref.Port)
+		if err != nil {
+			return "", fmt.Errorf("phare %s: %w", key, err)
+		}
+		address = fmt.Sprintf("%s.%s.svc.%s:%d", target.Name, target.Namespace, r.clusterDomain(), port)
+	}
+	if ref.Scheme != "" {
+		address = ref.Scheme + "://" + address
+	}
+	return address, nil
+}
+
+// servicePort returns the number of the port selected by name or number, or
+// of the first port if selector is nil.
+func servicePort(ports []corev1.ServicePort, selector *intstr.IntOrString) (int32, error) {
+	if len(ports) == 0 {
+		return 0, fmt.Errorf("service has no ports")
+	}
+	if selector == nil {
+		return ports[0].Port, nil
+	}
+	for _, p := range ports {
+		if (selector.Type == intstr.String && p.Name == selector.StrVal) ||
+			(selector.Type == intstr.Int && p.Port == selector.IntVal) {
+			return p.Port, nil
+		}
+	}
+	return 0, fmt.Errorf("service has no port %s", selector.String())
+}
+
+func (r *PhareReconciler) clusterDomain() string {
+	if r.ClusterDomain != "" {
+		return r.ClusterDomain
+	}
+	return defaultClusterDomain
+}
+
+func phareRefKey(phare *pharev1beta1.Phare, ref pharev1beta1.PhareAddressRef) client.ObjectKey {
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = phare.Namespace
+	}
+	return client.ObjectKey{Name: ref.Name, Namespace: namespace}
+}
+
+// phareEnvIndexValues extracts the phareEnvIndex values of a Phare.
+func phareEnvIndexValues(obj client.Object) []string {
+	phare, ok := obj.(*pharev1beta1.Phare)
+	if !ok {
+		return nil
+	}
+	values := make([]string, 0, len(phare.Spec.MicroService.PhareEnv))
+	for _, v := range phare.Spec.MicroService.PhareEnv {
+		values = append(values, phareRefKey(phare, v.PhareRef).String())
+	}
+	return values
+}
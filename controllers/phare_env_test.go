@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"testing"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+func deploymentEnv(t *testing.T, f *reconcileFixture, name string) map[string]string {
+	t.Helper()
+	deploy := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: name, Namespace: "default"}, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	env := map[string]string{}
+	for _, v := range deploy.Spec.Template.Spec.Containers[0].Env {
+		env[v.Name] = v.Value
+	}
+	return env
+}
+
+func TestPhareEnvResolvesServiceAddress(t *testing.T) {
+	web := basePhare("web", "default")
+	web.Spec.MicroService.PhareEnv = []pharev1beta1.PhareEnvVar{
+		{Name: "API_ADDR", PhareRef: pharev1beta1.PhareAddressRef{Name: "api"}},
+		{Name: "API_METRICS", PhareRef: pharev1beta1.PhareAddressRef{Name: "api", Port: &intstr.IntOrString{Type: intstr.String, StrVal: "metrics"}, Scheme: "http"}},
+	}
+	f := newReconcileFixture(t, web)
+
+	api := basePhare("api", "default")
+	api.Spec.Service = &corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 8080}, {Name: "metrics", Port: 9090}}}
+	if err := f.r.Create(f.ctx, api); err != nil {
+		t.Fatalf("create api phare: %v", err)
+	}
+
+	f.reconcile()
+	env := deploymentEnv(t, f, "web")
+	if env["API_ADDR"] != "api.default.svc.cluster.local:8080" {
+		t.Fatalf("expected the first Service port, got %q", env["API_ADDR"])
+	}
+	if env["API_METRICS"] != "http://api.default.svc.cluster.local:9090" {
+		t.Fatalf("expected the named Service port, got %q", env["API_METRICS"])
+	}
+	if reqs := f.r.dependentsOf(f.ctx, api); len(reqs) != 1 || reqs[0].Name != "web" {
+		t.Fatalf("expected api to requeue web, got %v", reqs)
+	}
+
+	api.Spec.Service.Ports[0].Port = 8081
+	if err := f.r.Update(f.ctx, api); err != nil {
+		t.Fatalf("update api phare: %v", err)
+	}
+	f.reconcile()
+	if env := deploymentEnv(t, f, "web"); env["API_ADDR"] != "api.default.svc.cluster.local:8081" {
+		t.Fatalf("expected the changed port to be rolled out, got %q", env["API_ADDR"])
+	}
+}
+
+func TestPhareEnvResolvesHTTPRouteHostname(t *testing.T) {
+	web := basePhare("web", "default")
+	web.Spec.MicroService.PhareEnv = []pharev1beta1.PhareEnvVar{
+		{Name: "API_URL", PhareRef: pharev1beta1.PhareAddressRef{Name: "api", Namespace: "default", HTTPRoute: true, Scheme: "https"}},
+	}
+	f := newReconcileFixture(t, web)
+
+	api := basePhare("api", "default")
+	api.Spec.ToolChain = &pharev1beta1.ToolChainSpec{HTTPRoute: &pharev1beta1.HTTPRouteSpec{Hostnames: []gatewayv1beta1.Hostname{"api.example.com"}}}
+	if err := f.r.Create(f.ctx, api); err != nil {
+		t.Fatalf("create api phare: %v", err)
+	}
+
+	f.reconcile()
+	if env := deploymentEnv(t, f, "web"); env["API_URL"] != "https://api.example.com" {
+		t.Fatalf("expected the HTTPRoute hostname, got %q", env["API_URL"])
+	}
+}
+
+func TestPhareEnvMissingTargetFails(t *testing.T) {
+	web := basePhare("web", "default")
+	web.Spec.MicroService.PhareEnv = []pharev1beta1.PhareEnvVar{
+		{Name: "API_ADDR", PhareRef: pharev1beta1.PhareAddressRef{Name: "api"}},
+	}
+	f := newReconcileFixture(t, web)
+
+	if _, err := f.r.Reconcile(f.ctx, f.req); err == nil {
+		t.Fatalf("expected an error while the referenced Phare is missing")
+	}
+	got := &pharev1beta1.Phare{}
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, got); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	if got.Status.Phase != pharev1beta1.PharePhaseFailed {
+		t.Fatalf("expected phase Failed, got %s", got.Status.Phase)
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "web", Namespace: "default"}, &appsv1.Deployment{}); err == nil {
+		t.Fatalf("expected no workload without the referenced Phare")
+	}
+}
@@ -4,11 +4,9 @@ import (
 	"context"
 	"crypto/sha256"
 	"fmt"
-	"sort"
 	"strings"
 
 	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
-	tpl "github.com/localcorp/phare-controller/pkg/go-templates"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -18,9 +16,77 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// reconcileConfigMap creates, updates, or deletes the managed ConfigMap.
-func (r *PhareReconciler) reconcileConfigMap(ctx context.Context, phare pharev1beta1.Phare) error {
-	// 1. Check if ToolChain and Config are non-nil.
+// reconcileConfigMap creates, updates, or deletes the managed ConfigMaps of
+// the config bundles and records the ones the pod template mounts in
+// status.configMapName and status.configBundles.
+func (r *PhareReconciler) reconcileConfigMap(ctx context.Context, phare *pharev1beta1.Phare) error {
+	// 1. Generate the desired ConfigMaps. A template that fails to render
+	// fails them all, so that a partially rendered config never replaces the
+	// current one.
+	bundles := configBundles(phare)
+	if err := validateConfigBundles(phare, bundles); err != nil {
+		return err
+	}
+	if err := validateConfigSharding(phare, bundles); err != nil {
+		return err
+	}
+	desired := make([]*corev1.ConfigMap, 0, len(bundles))
+	for _, b := range bundles {
+		configMap, err := r.generateConfigMap(ctx, *phare, b)
+		if err != nil {
+			return err
+		}
+		desired = append(desired, configMap)
+	}
+	// Config files that fail to parse or to validate against their schema
+	// leave the current ConfigMaps untouched as well.
+	if err := r.recordConfigValidation(phare, r.validateConfig(ctx, phare, bundles, desired)); err != nil {
+		return err
+	}
+
+	// ConfigMaps over the size limit, or files over the size of a shard,
+	// are not applied either.
+	split, err := splitConfigMaps(phare, desired)
+	if err := r.recordConfigSize(phare, err); err != nil {
+		return err
+	}
+
+	// 2. Apply them.
+	phare.Status.ConfigMapName = ""
+	phare.Status.ConfigMapShards = nil
+	phare.Status.ConfigBundles = nil
+	current := map[string]bool{}
+	for i, b := range bundles {
+		var names []string
+		for _, configMap := range split[i] {
+			var err error
+			name := configMap.Name
+			if phare.Spec.ToolChain.ImmutableConfig != nil {
+				name, err = r.applyImmutableConfigMap(ctx, phare, configMap)
+			} else {
+				err = r.applyConfigMap(ctx, phare, configMap)
+			}
+			if err != nil {
+				return err
+			}
+			current[name] = true
+			names = append(names, name)
+		}
+		st := pharev1beta1.ConfigBundleStatus{Name: b.name}
+		if phare.Spec.ToolChain.ConfigSharding != nil {
+			st.ConfigMapShards = names
+		} else {
+			st.ConfigMapName = names[0]
+		}
+		if b.name == "" {
+			phare.Status.ConfigMapName = st.ConfigMapName
+			phare.Status.ConfigMapShards = st.ConfigMapShards
+		} else {
+			phare.Status.ConfigBundles = append(phare.Status.ConfigBundles, st)
+		}
+	}
+
+	// 3. Delete <name>-config once spec.toolchain.config is removed.
 	if phare.Spec.ToolChain == nil || phare.Spec.ToolChain.Config == nil {
 		existingConfigMap := &corev1.ConfigMap{}
 		err := r.Get(ctx, client.ObjectKey{Name: phare.Name + "-config", Namespace: phare.Namespace}, existingConfigMap)
@@ -33,18 +99,17 @@ func (r *PhareReconciler) reconcileConfigMap(ctx context.Context, phare pharev1b
 			if deleteErr := r.Delete(ctx, existingConfigMap); deleteErr != nil && !errors.IsNotFound(deleteErr) {
 				return deleteErr
 			}
-			r.Recorder.Eventf(&phare, corev1.EventTypeNormal, "DeletedResource", "Deleted ConfigMap %s", existingConfigMap.Name)
+			r.Recorder.Eventf(phare, corev1.EventTypeNormal, "DeletedResource", "Deleted ConfigMap %s", existingConfigMap.Name)
 		}
-		return nil
 	}
 
-	// 2. Generate the desired ConfigMap as ToolChain and Config are non-nil.
-	desiredConfigMap := r.generateConfigMap(phare)
-	if desiredConfigMap == nil {
-		return fmt.Errorf("failed to build desired ConfigMap for %s/%s", phare.Namespace, phare.Name)
-	}
+	// Previous immutable ConfigMaps, and those of removed bundles, are pruned
+	// once no pod mounts them.
+	return r.pruneConfigMaps(ctx, phare, current)
+}
 
-	// 3. Check the existence and state of the current ConfigMap.
+// applyConfigMap creates or updates the mutable ConfigMap desired.
+func (r *PhareReconciler) applyConfigMap(ctx context.Context, phare *pharev1beta1.Phare, desiredConfigMap *corev1.ConfigMap) error {
 	existingConfigMap := &corev1.ConfigMap{}
 	err := r.Get(ctx, client.ObjectKey{Name: desiredConfigMap.Name, Namespace: phare.Namespace}, existingConfigMap)
 
@@ -53,61 +118,65 @@ func (r *PhareReconciler) reconcileConfigMap(ctx context.Context, phare pharev1b
 		if err = r.Create(ctx, desiredConfigMap); err != nil {
 			return err
 		}
-		r.Recorder.Eventf(&phare, corev1.EventTypeNormal, "CreatedResource", "Created ConfigMap %s", desiredConfigMap.Name)
-	} else if err == nil && !isDataEqual(existingConfigMap.Data, desiredConfigMap.Data) {
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "CreatedResource", "Created ConfigMap %s", desiredConfigMap.Name)
+	} else if err == nil && (!isDataEqual(existingConfigMap.Data, desiredConfigMap.Data) ||
+		!stringMapsEqualNilEmpty(existingConfigMap.Labels, desiredConfigMap.Labels) ||
+		!stringMapsEqualNilEmpty(existingConfigMap.Annotations, desiredConfigMap.Annotations)) {
 		// ConfigMap exists and differs from desired, update it.
 		existingConfigMap.Data = desiredConfigMap.Data
+		existingConfigMap.Labels = copyStringMapPreserveNil(desiredConfigMap.Labels)
+		existingConfigMap.Annotations = copyStringMapPreserveNil(desiredConfigMap.Annotations)
 		if updateErr := r.Update(ctx, existingConfigMap); updateErr != nil {
 			return updateErr
 		}
-		r.Recorder.Eventf(&phare, corev1.EventTypeNormal, "UpdatedResource", "Updated ConfigMap %s", desiredConfigMap.Name)
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "UpdatedResource", "Updated ConfigMap %s", desiredConfigMap.Name)
 	} else if err != nil {
 		// Some other error occurred while fetching the ConfigMap.
 		return err
 	}
-
 	return nil
 }
 
-// generateConfigMap builds the desired ConfigMap from the Phare spec.
-func (r *PhareReconciler) generateConfigMap(phare pharev1beta1.Phare) *corev1.ConfigMap {
-
-	metadataLabels := map[string]string{
-		"app":                          phare.Name,
-		"app.kubernetes.io/created-by": "phare-controller",
-		// "version":                      phare.Spec.MicroService.Image.Tag, // Use later for rolling updates
-	}
-
+// generateConfigMap builds the desired ConfigMap of a config bundle. Errors
+// rendering a config value are *tpl.RenderError.
+func (r *PhareReconciler) generateConfigMap(ctx context.Context, phare pharev1beta1.Phare, bundle configBundle) (*corev1.ConfigMap, error) {
 	configMap := &corev1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
 			Kind:       "ConfigMap",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      phare.Name + "-config",
-			Namespace: phare.Namespace,
-			Labels:    metadataLabels,
+			Name:        bundle.configMapName(&phare),
+			Namespace:   phare.Namespace,
+			Labels:      childLabels(&phare, pharev1beta1.PropagationTargetConfigMap),
+			Annotations: childAnnotations(&phare, pharev1beta1.PropagationTargetConfigMap),
 		},
-		Data: copyStringMap(phare.Spec.ToolChain.Config),
+		Data: make(map[string]string, len(bundle.data)),
+	}
+	if bundle.name != "" {
+		configMap.Labels[configBundleLabel] = bundle.name
 	}
 
 	// Go-templates support
-	for key, tmplValue := range phare.Spec.ToolChain.Config {
-		processedValue, err := tpl.ProcessTemplate(tmplValue, phare.ObjectMeta)
+	renderer, err := r.templateRenderer(ctx, &phare)
+	if err != nil {
+		return nil, err
+	}
+	renderer = renderer.WithIncludes(bundle.data)
+	for _, key := range sortedKeys(bundle.data) {
+		value, err := renderer.RenderField(bundle.path, key, bundle.data[key])
 		if err != nil {
-			r.Log.Error(err, "Error processing ConfigMap template", "ConfigMap.Name", configMap.Name, "Config.Key", key)
-			continue
+			return nil, err
 		}
-		configMap.Data[key] = processedValue
+		configMap.Data[key] = value
 	}
 
 	// Set Phare CR as the owner of this ConfigMap
 	if err := ctrl.SetControllerReference(&phare, configMap, r.Scheme); err != nil {
-		r.Log.Error(err, "Failed to set controller reference for ConfigMap", "ConfigMap.Namespace", configMap.Namespace, "ConfigMap.Name", configMap.Name)
-		return nil
+		return nil, fmt.Errorf("failed to set controller reference for ConfigMap %s/%s: %w", configMap.Namespace, configMap.Name, err)
 	}
 
-	return configMap
+	return configMap, nil
 }
 
 // Utility function to compare map data
@@ -124,40 +193,67 @@ func isDataEqual(map1, map2 map[string]string) bool {
 	return true
 }
 
-func copyStringMap(in map[string]string) map[string]string {
-	if len(in) == 0 {
-		return map[string]string{}
+// setConfigChecksum injects the ConfigMap hash annotations using the reconcile
+// context so that pod templates are rolled when config changes. Immutable
+// ConfigMaps carry the hash in their name, which rolls the pods by itself.
+// Sharded config is hashed as a whole, so that sharding it does not roll the
+// pods. The ConfigMaps and Secrets referenced by the pod spec, and
+// spec.toolchain.secrets, are hashed as well.
+func (r *PhareReconciler) setConfigChecksum(ctx context.Context, phare *pharev1beta1.Phare, template *corev1.PodTemplateSpec) error {
+	if err := r.setReferencedConfigChecksum(ctx, phare, template); err != nil {
+		return err
 	}
-	out := make(map[string]string, len(in))
-	for k, v := range in {
-		out[k] = v
+	setSecretsChecksum(phare, template)
+	if phare.Spec.ToolChain == nil || phare.Spec.ToolChain.ImmutableConfig != nil {
+		return nil
 	}
-	return out
+	for _, b := range configBundles(phare) {
+		if len(b.data) == 0 {
+			continue
+		}
+		name := b.configMapName(phare)
+		var hash string
+		var err error
+		if shards := b.currentShards(phare); len(shards) > 0 {
+			hash, err = r.hashConfigShards(ctx, shards, phare.Namespace)
+		} else {
+			hash, err = r.hashConfigMapData(ctx, name, phare.Namespace)
+		}
+		if err != nil {
+			return fmt.Errorf("hash configmap %s: %w", name, err)
+		}
+		if template.Annotations == nil {
+			template.Annotations = make(map[string]string)
+		}
+		if b.name == "" {
+			template.Annotations["checksum/config-files"] = hash
+		} else {
+			template.Annotations["checksum/config-"+b.name] = hash
+		}
+	}
+	return nil
 }
 
 // hashConfigMapData returns a deterministic SHA-256 hash of ConfigMap data.
 // It returns an error if the ConfigMap does not exist.
-// Data is encoded as "key=value\n" pairs to avoid ambiguous concatenation.
-// Note: changing this encoding can cause a one-time checksum change and rollout.
 func (r *PhareReconciler) hashConfigMapData(ctx context.Context, configMapName string, namespace string) (string, error) {
 	cm := &corev1.ConfigMap{}
 	if err := r.Get(ctx, types.NamespacedName{Name: configMapName, Namespace: namespace}, cm); err != nil {
 		return "", err
 	}
+	return configDataHash(cm.Data), nil
+}
 
-	keys := make([]string, 0, len(cm.Data))
-	for k := range cm.Data {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
+// configDataHash returns a deterministic SHA-256 hash of ConfigMap data.
+// Data is encoded as "key=value\n" pairs to avoid ambiguous concatenation.
+// Note: changing this encoding can cause a one-time checksum change and rollout.
+func configDataHash(data map[string]string) string {
 	var sb strings.Builder
-	for _, k := range keys {
+	for _, k := range sortedKeys(data) {
 		sb.WriteString(k)
 		sb.WriteByte('=')
-		sb.WriteString(cm.Data[k])
+		sb.WriteString(data[k])
 		sb.WriteByte('\n')
 	}
-
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(sb.String()))), nil
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(sb.String())))
 }
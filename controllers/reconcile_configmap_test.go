@@ -35,7 +35,10 @@ func TestGenerateConfigMapDoesNotMutateSpecConfig(t *testing.T) {
 		},
 	}
 
-	cm := r.generateConfigMap(phare)
+	cm, err := r.generateConfigMap(context.Background(), phare, configBundles(&phare)[0])
+	if err != nil {
+		t.Fatalf("generate configmap: %v", err)
+	}
 	if cm.Data["templated"] != "/app/ready" {
 		t.Fatalf("expected templated value to be rendered, got %q", cm.Data["templated"])
 	}
@@ -66,7 +69,7 @@ func TestReconcileConfigMapDeleteSucceeds(t *testing.T) {
 	}
 
 	// reconcileConfigMap should delete the ConfigMap and return no error.
-	if err := r.reconcileConfigMap(context.Background(), *phare); err != nil {
+	if err := r.reconcileConfigMap(context.Background(), phare); err != nil {
 		t.Fatalf("expected no error on ConfigMap deletion, got: %v", err)
 	}
 
@@ -8,13 +8,11 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/utils/pointer"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/google/go-cmp/cmp"
 	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
-	tpl "github.com/localcorp/phare-controller/pkg/go-templates"
 )
 
 // configVolumeMountPath is the container path where the managed ConfigMap is mounted.
@@ -26,32 +24,42 @@ func (r *PhareReconciler) reconcileDeployment(ctx context.Context, phare pharev1
 		return fmt.Errorf("failed to build desired Deployment for %s/%s", phare.Namespace, phare.Name)
 	}
 
-	// Inject ConfigMap hash annotation using the reconcile context so that pod
-	// templates are rolled when config changes.
-	if phare.Spec.ToolChain != nil && len(phare.Spec.ToolChain.Config) > 0 {
-		hash, err := r.hashConfigMapData(ctx, phare.Name+"-config", phare.Namespace)
-		if err != nil {
-			return fmt.Errorf("hash configmap %s: %w", phare.Name+"-config", err)
-		}
-		if desiredDeployment.Spec.Template.Annotations == nil {
-			desiredDeployment.Spec.Template.Annotations = make(map[string]string)
-		}
-		desiredDeployment.Spec.Template.Annotations["checksum/config-files"] = hash
+	if err := r.setConfigChecksum(ctx, &phare, &desiredDeployment.Spec.Template); err != nil {
+		return err
 	}
 
 	existingDeployment := &appsv1.Deployment{}
 	err := r.Get(ctx, client.ObjectKey{Name: desiredDeployment.Name, Namespace: phare.Namespace}, existingDeployment)
 
 	if err != nil && errors.IsNotFound(err) {
+		// Let the new Deployment adopt ReplicaSets orphaned by a selector migration.
+		if err := r.labelOrphansForAdoption(ctx, &phare, &appsv1.ReplicaSetList{}); err != nil {
+			return err
+		}
 		if createErr := r.Create(ctx, desiredDeployment); createErr != nil {
 			return createErr
 		}
 	} else if err == nil {
+		if !existingDeployment.DeletionTimestamp.IsZero() {
+			// The delete event requeues the Phare once the old object is gone.
+			r.Log.Info("Waiting for Deployment deletion to finish", "Deployment.Namespace", existingDeployment.Namespace, "Deployment.Name", existingDeployment.Name)
+			return nil
+		}
+		// The selector is immutable; recreate workloads still using the legacy one.
+		if metav1.IsControlledBy(existingDeployment, &phare) && !hasStableSelector(existingDeployment.Spec.Selector, &phare) {
+			return r.orphanWorkload(ctx, &phare, existingDeployment, "Deployment")
+		}
+
 		// Keep a copy so we can generate a patch only when something changed.
 		originalDeployment := existingDeployment.DeepCopy()
 
 		// Merge the desired values into the current object.
 		r.mergeDeployments(desiredDeployment, existingDeployment)
+		if podTemplateHeld(&phare) {
+			// Keep the running pod template until it is approved and a
+			// maintenance window opens.
+			existingDeployment.Spec.Template = originalDeployment.Spec.Template
+		}
 
 		// Compare old and new objects before patching.
 		diff := cmp.Diff(originalDeployment, existingDeployment, podTemplateCompareOptions())
@@ -76,6 +84,9 @@ func (r *PhareReconciler) reconcileDeployment(ctx context.Context, phare pharev1
 // mergeDeployments applies controller-managed fields while keeping injected sidecars
 // and related volumes that are still in use.
 func (r *PhareReconciler) mergeDeployments(desiredDeployment, existingDeployment *appsv1.Deployment) {
+	// Other controllers annotate workloads (e.g. deployment.kubernetes.io/revision),
+	// so controller-managed metadata is merged rather than replaced.
+	mergeManagedMetadata(&existingDeployment.ObjectMeta, desiredDeployment.ObjectMeta)
 	existingDeployment.Spec.Replicas = desiredDeployment.Spec.Replicas
 	existingDeployment.Spec.Template.Labels = copyStringMapPreserveNil(desiredDeployment.Spec.Template.Labels)
 	existingDeployment.Spec.Template.Annotations = copyStringMapPreserveNil(desiredDeployment.Spec.Template.Annotations)
@@ -91,24 +102,17 @@ func (r *PhareReconciler) mergeDeployments(desiredDeployment, existingDeployment
 }
 
 func (r *PhareReconciler) newDeployment(phare *pharev1beta1.Phare) *appsv1.Deployment {
-	// Base labels for resources created by this controller.
-	metadataLabels := map[string]string{
-		"app":                          phare.Name,
-		"app.kubernetes.io/created-by": "phare-controller",
-	}
-
-	// Default pod labels and annotations.
-	podLabels := map[string]string{
-		"app": phare.Name,
+	// Spec pod annotations override annotations propagated from the Phare.
+	podAnnotations := childAnnotations(phare, pharev1beta1.PropagationTargetPodTemplate)
+	if podAnnotations == nil {
+		podAnnotations = map[string]string{}
 	}
-	for key, value := range phare.Spec.MicroService.PodLabels {
-		podLabels[key] = value
-	}
-
-	podAnnotations := map[string]string{}
 	for key, value := range phare.Spec.MicroService.PodAnnotations {
 		podAnnotations[key] = value
 	}
+	if restarted := restartedAt(phare); restarted != "" {
+		podAnnotations[restartedAtAnnotation] = restarted
+	}
 
 	containers := []corev1.Container{
 		{
@@ -134,18 +138,19 @@ func (r *PhareReconciler) newDeployment(phare *pharev1beta1.Phare) *appsv1.Deplo
 			Kind:       "Deployment",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      phare.Name,
-			Namespace: phare.Namespace,
-			Labels:    metadataLabels,
+			Name:        phare.Name,
+			Namespace:   phare.Namespace,
+			Labels:      childLabels(phare, pharev1beta1.PropagationTargetDeployment),
+			Annotations: childAnnotations(phare, pharev1beta1.PropagationTargetDeployment),
 		},
 		Spec: appsv1.DeploymentSpec{
 			Selector: &metav1.LabelSelector{
-				MatchLabels: podLabels,
+				MatchLabels: workloadSelectorLabels(phare),
 			},
-			Replicas: &phare.Spec.MicroService.ReplicaCount,
+			Replicas: workloadReplicas(phare),
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels:      podLabels,
+					Labels:      workloadPodLabels(phare),
 					Annotations: podAnnotations,
 				},
 				Spec: corev1.PodSpec{
@@ -165,50 +170,18 @@ func (r *PhareReconciler) newDeployment(phare *pharev1beta1.Phare) *appsv1.Deplo
 		return nil
 	}
 
-	// Add config volume only when toolchain config exists.
-	if phare.Spec.ToolChain != nil && len(phare.Spec.ToolChain.Config) > 0 {
-		addConfigVolumeToSpec(&deployment.Spec.Template, phare.Name+"-config")
-	}
-
 	// Set default file mode for Secret/ConfigMap volumes.
 	for i := range deployment.Spec.Template.Spec.Volumes {
 		UpdateVolume(&deployment.Spec.Template.Spec.Volumes[i], 420)
 	}
 
-	// Render liveness probe templates if present.
-	if err := tpl.ProcessLivenessProbeTemplate(deployment.Spec.Template.Spec.Containers[0].LivenessProbe, phare.ObjectMeta); err != nil {
-		r.Log.Error(err, "Error processing liveness probe template")
-		return nil
-	}
+	// Config volumes set their own file mode.
+	addConfigVolumes(phare, &deployment.Spec.Template)
+	addSecretsVolume(phare, &deployment.Spec.Template)
 
 	return deployment
 }
 
-// addConfigVolumeToSpec mounts the managed ConfigMap into the first container of
-// the given pod template. Hash annotation injection is handled separately by the
-// reconcile functions so they can use the request context.
-func addConfigVolumeToSpec(template *corev1.PodTemplateSpec, configMapName string) {
-	vol := corev1.Volume{
-		Name: "config-volume",
-		VolumeSource: corev1.VolumeSource{
-			ConfigMap: &corev1.ConfigMapVolumeSource{
-				LocalObjectReference: corev1.LocalObjectReference{
-					Name: configMapName,
-				},
-				DefaultMode: pointer.Int32(420),
-				Optional:    pointer.Bool(false),
-			},
-		},
-	}
-	template.Spec.Volumes = append([]corev1.Volume{vol}, template.Spec.Volumes...)
-
-	mount := corev1.VolumeMount{
-		Name:      "config-volume",
-		MountPath: configVolumeMountPath,
-	}
-	template.Spec.Containers[0].VolumeMounts = append([]corev1.VolumeMount{mount}, template.Spec.Containers[0].VolumeMounts...)
-}
-
 // UpdateVolume sets the default mode for Secret and ConfigMap volumes.
 func UpdateVolume(volume *corev1.Volume, defaultMode int32) {
 	if volume.Secret != nil {
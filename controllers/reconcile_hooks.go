@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	preDeployHook  = "pre-deploy"
+	postDeployHook = "post-deploy"
+
+	// hookLabel and hookHashLabel identify hook Jobs and the image/spec they ran for.
+	hookLabel     = "phare.localcorp.internal/hook"
+	hookHashLabel = "phare.localcorp.internal/hook-hash"
+
+	defaultHookHistoryLimit = 3
+
+	// hookPollInterval is how often a post-deploy hook re-checks the rollout.
+	// StatefulSet status changes are filtered out by the watch predicate.
+	hookPollInterval = 10 * time.Second
+)
+
+// runPreDeployHook ensures the pre-deploy Job for the current image and hook spec
+// has succeeded. It returns false while the Job runs or after it failed, in which
+// case the workload must not be rolled.
+func (r *PhareReconciler) runPreDeployHook(ctx context.Context, phare *pharev1beta1.Phare) (bool, error) {
+	var hook *pharev1beta1.HookSpec
+	if phare.Spec.Hooks != nil {
+		hook = phare.Spec.Hooks.PreDeploy
+	}
+	if hook == nil || phare.Spec.Suspend {
+		return true, r.clearHook(ctx, phare, preDeployHook, hook == nil)
+	}
+	done, err := r.runHook(ctx, phare, preDeployHook, hook)
+	if err != nil {
+		return false, err
+	}
+	return done == hookSucceeded, nil
+}
+
+// runPostDeployHook runs the post-deploy Job once the workload is available.
+func (r *PhareReconciler) runPostDeployHook(ctx context.Context, phare *pharev1beta1.Phare) (ctrl.Result, error) {
+	var hook *pharev1beta1.HookSpec
+	if phare.Spec.Hooks != nil {
+		hook = phare.Spec.Hooks.PostDeploy
+	}
+	if hook == nil || phare.Spec.Suspend {
+		return ctrl.Result{}, r.clearHook(ctx, phare, postDeployHook, hook == nil)
+	}
+
+	available, err := r.workloadAvailable(ctx, phare)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !available {
+		apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+			Type:               pharev1beta1.ConditionPostDeployHookComplete,
+			Status:             metav1.ConditionFalse,
+			Reason:             pharev1beta1.ReasonHookWaitingForRollout,
+			Message:            "Waiting for the workload to become available",
+			ObservedGeneration: phare.Generation,
+		})
+		return ctrl.Result{RequeueAfter: hookPollInterval}, nil
+	}
+
+	_, err = r.runHook(ctx, phare, postDeployHook, hook)
+	return ctrl.Result{}, err
+}
+
+type hookState int
+
+const (
+	hookRunning hookState = iota
+	hookSucceeded
+	hookFailed
+)
+
+// runHook creates the hook Job for the current hash if needed, reports its state
+// in the hook condition and garbage-collects Jobs of older hashes.
+func (r *PhareReconciler) runHook(ctx context.Context, phare *pharev1beta1.Phare, hookType string, hook *pharev1beta1.HookSpec) (hookState, error) {
+	hash := hookHash(phare, hook)
+	job, err := r.findHookJob(ctx, phare, hookType, hash)
+	if err != nil {
+		return hookRunning, err
+	}
+	if job == nil {
+		job = r.desiredHookJob(phare, hookType, hook, hash)
+		if job == nil {
+			return hookRunning, fmt.Errorf("failed to build %s hook Job for %s/%s", hookType, phare.Namespace, phare.Name)
+		}
+		if err := r.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+			return hookRunning, err
+		}
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "CreatedResource", "Created %s hook Job %s", hookType, job.Name)
+	}
+
+	state := jobState(job)
+	condition := metav1.Condition{
+		Type:               hookConditionType(hookType),
+		ObservedGeneration: phare.Generation,
+	}
+	switch state {
+	case hookSucceeded:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = pharev1beta1.ReasonHookSucceeded
+		condition.Message = fmt.Sprintf("Job %s succeeded", job.Name)
+	case hookFailed:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = pharev1beta1.ReasonHookFailed
+		condition.Message = fmt.Sprintf("Job %s failed; change the hook or image, or delete the Job to retry", job.Name)
+		if !isHookConditionFailed(phare, condition.Type) {
+			r.Recorder.Eventf(phare, corev1.EventTypeWarning, "HookFailed", "%s hook Job %s failed", hookType, job.Name)
+		}
+	default:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = pharev1beta1.ReasonHookRunning
+		condition.Message = fmt.Sprintf("Waiting for Job %s", job.Name)
+	}
+	apimeta.SetStatusCondition(&phare.Status.Conditions, condition)
+
+	return state, r.pruneHookJobs(ctx, phare, hookType, hash, hookHistoryLimit(phare))
+}
+
+// clearHook removes the hook condition and, when the hook was removed from the
+// spec, every Job it left behind.
+func (r *PhareReconciler) clearHook(ctx context.Context, phare *pharev1beta1.Phare, hookType string, removed bool) error {
+	apimeta.RemoveStatusCondition(&phare.Status.Conditions, hookConditionType(hookType))
+	if !removed {
+		return nil
+	}
+	return r.pruneHookJobs(ctx, phare, hookType, "", 0)
+}
+
+func (r *PhareReconciler) findHookJob(ctx context.Context, phare *pharev1beta1.Phare, hookType, hash string) (*batchv1.Job, error) {
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Name: hookJobName(phare.Name, hookType, hash), Namespace: phare.Namespace}, job)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// pruneHookJobs deletes hook Jobs owned by the Phare beyond the newest keep, never
+// deleting the Job of the current hash.
+func (r *PhareReconciler) pruneHookJobs(ctx context.Context, phare *pharev1beta1.Phare, hookType, currentHash string, keep int) error {
+	jobs := &batchv1.JobList{}
+	if err := r.List(ctx, jobs, client.InNamespace(phare.Namespace), client.MatchingLabels{
+		hookLabel:                    hookType,
+		"app.kubernetes.io/instance": phare.Name,
+	}); err != nil {
+		return err
+	}
+
+	owned := make([]batchv1.Job, 0, len(jobs.Items))
+	for _, job := range jobs.Items {
+		if metav1.IsControlledBy(&job, phare) {
+			owned = append(owned, job)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool {
+		return owned[j].CreationTimestamp.Before(&owned[i].CreationTimestamp)
+	})
+
+	kept := 0
+	for i := range owned {
+		job := &owned[i]
+		if job.Labels[hookHashLabel] == currentHash && currentHash != "" {
+			kept++
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *PhareReconciler) desiredHookJob(phare *pharev1beta1.Phare, hookType string, hook *pharev1beta1.HookSpec, hash string) *batchv1.Job {
+	spec := hook.Job.DeepCopy()
+	image := imageRef(phare.Spec.MicroService.Image)
+	for i := range spec.Template.Spec.Containers {
+		if spec.Template.Spec.Containers[i].Image == "" {
+			spec.Template.Spec.Containers[i].Image = image
+		}
+	}
+	for i := range spec.Template.Spec.InitContainers {
+		if spec.Template.Spec.InitContainers[i].Image == "" {
+			spec.Template.Spec.InitContainers[i].Image = image
+		}
+	}
+	if spec.Template.Spec.RestartPolicy == "" {
+		spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
+	}
+
+	// Hook pods must not carry app=<name>: the Service would route traffic to them.
+	spec.Template.Labels = mergeStringMaps(spec.Template.Labels, map[string]string{hookLabel: hookType})
+
+	labels := standardLabels(phare)
+	labels[hookLabel] = hookType
+	labels[hookHashLabel] = hash
+
+	job := &batchv1.Job{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "batch/v1",
+			Kind:       "Job",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      hookJobName(phare.Name, hookType, hash),
+			Namespace: phare.Namespace,
+			Labels:    labels,
+		},
+		Spec: *spec,
+	}
+	if err := ctrl.SetControllerReference(phare, job, r.Scheme); err != nil {
+		r.Log.Error(err, "Failed to set controller reference for hook Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		return nil
+	}
+	return job
+}
+
+// hookHash identifies a hook run: it changes with the microservice image or the
+// hook spec, so the hook runs again for every new release.
+func hookHash(phare *pharev1beta1.Phare, hook *pharev1beta1.HookSpec) string {
+	data, _ := json.Marshal(struct {
+		Image pharev1beta1.ImageSpec `json:"image"`
+		Job   interface{}            `json:"job"`
+	}{phare.Spec.MicroService.Image, hook.Job})
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:10]
+}
+
+// hookJobName keeps Job names within the 63 characters allowed in the
+// job-name label added to hook pods.
+func hookJobName(phareName, hookType, hash string) string {
+	const maxPrefix = 63 - len("-post-deploy-") - 10
+	if len(phareName) > maxPrefix {
+		phareName = phareName[:maxPrefix]
+	}
+	return fmt.Sprintf("%s-%s-%s", phareName, hookType, hash)
+}
+
+func hookHistoryLimit(phare *pharev1beta1.Phare) int {
+	if phare.Spec.Hooks != nil && phare.Spec.Hooks.HistoryLimit != nil {
+		return int(*phare.Spec.Hooks.HistoryLimit)
+	}
+	return defaultHookHistoryLimit
+}
+
+func hookConditionType(hookType string) string {
+	if hookType == preDeployHook {
+		return pharev1beta1.ConditionPreDeployHookComplete
+	}
+	return pharev1beta1.ConditionPostDeployHookComplete
+}
+
+func isHookConditionFailed(phare *pharev1beta1.Phare, conditionType string) bool {
+	c := apimeta.FindStatusCondition(phare.Status.Conditions, conditionType)
+	return c != nil && c.Reason == pharev1beta1.ReasonHookFailed
+}
+
+func jobState(job *batchv1.Job) hookState {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return hookSucceeded
+		case batchv1.JobFailed:
+			return hookFailed
+		}
+	}
+	return hookRunning
+}
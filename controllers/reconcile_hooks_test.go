@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func hookPhare() *pharev1beta1.Phare {
+	phare := basePhare("demo", "default")
+	phare.Spec.Hooks = &pharev1beta1.HooksSpec{
+		PreDeploy: &pharev1beta1.HookSpec{Job: batchv1.JobSpec{
+			Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "migrate", Command: []string{"migrate", "up"}}},
+			}},
+		}},
+	}
+	return phare
+}
+
+func setJobCondition(t *testing.T, r *PhareReconciler, name string, condition batchv1.JobConditionType) {
+	t.Helper()
+	ctx := context.Background()
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, job); err != nil {
+		t.Fatalf("get hook job: %v", err)
+	}
+	job.Status.Conditions = []batchv1.JobCondition{{Type: condition, Status: corev1.ConditionTrue}}
+	if err := r.Status().Update(ctx, job); err != nil {
+		t.Fatalf("update hook job status: %v", err)
+	}
+}
+
+func TestPreDeployHookBlocksRolloutUntilComplete(t *testing.T) {
+	scheme := testScheme(t)
+	phare := hookPhare()
+	r := newTestReconciler(t, scheme, phare)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: phare.Name, Namespace: phare.Namespace}}
+	ctx := context.Background()
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected no deployment while the hook runs, got %v", err)
+	}
+
+	jobName := hookJobName(phare.Name, preDeployHook, hookHash(phare, phare.Spec.Hooks.PreDeploy))
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: phare.Namespace}, job); err != nil {
+		t.Fatalf("get hook job: %v", err)
+	}
+	if got := job.Spec.Template.Spec.Containers[0].Image; got != "nginx:latest" {
+		t.Fatalf("expected hook to default to the microservice image, got %q", got)
+	}
+	if _, ok := job.Spec.Template.Labels["app"]; ok {
+		t.Fatalf("hook pods must not carry the Service selector label")
+	}
+
+	current := &pharev1beta1.Phare{}
+	if err := r.Get(ctx, req.NamespacedName, current); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	if current.Status.Phase != pharev1beta1.PharePhaseReconciling {
+		t.Fatalf("expected phase Reconciling, got %q", current.Status.Phase)
+	}
+
+	setJobCondition(t, r, jobName, batchv1.JobComplete)
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, &appsv1.Deployment{}); err != nil {
+		t.Fatalf("expected deployment after the hook completed: %v", err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, current); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	if !apimeta.IsStatusConditionTrue(current.Status.Conditions, pharev1beta1.ConditionPreDeployHookComplete) {
+		t.Fatalf("expected %s condition to be True", pharev1beta1.ConditionPreDeployHookComplete)
+	}
+}
+
+func TestPreDeployHookFailureBlocksRollout(t *testing.T) {
+	scheme := testScheme(t)
+	phare := hookPhare()
+	r := newTestReconciler(t, scheme, phare)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: phare.Name, Namespace: phare.Namespace}}
+	ctx := context.Background()
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	setJobCondition(t, r, hookJobName(phare.Name, preDeployHook, hookHash(phare, phare.Spec.Hooks.PreDeploy)), batchv1.JobFailed)
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+
+	if err := r.Get(ctx, req.NamespacedName, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected failed hook to block the rollout, got %v", err)
+	}
+	current := &pharev1beta1.Phare{}
+	if err := r.Get(ctx, req.NamespacedName, current); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	if current.Status.Phase != pharev1beta1.PharePhaseFailed {
+		t.Fatalf("expected phase Failed, got %q", current.Status.Phase)
+	}
+	c := apimeta.FindStatusCondition(current.Status.Conditions, pharev1beta1.ConditionPreDeployHookComplete)
+	if c == nil || c.Reason != pharev1beta1.ReasonHookFailed {
+		t.Fatalf("expected hook condition with reason Failed, got %+v", c)
+	}
+}
+
+func TestPruneHookJobsKeepsHistoryLimit(t *testing.T) {
+	scheme := testScheme(t)
+	phare := hookPhare()
+	phare.UID = "phare-uid"
+	limit := int32(1)
+	phare.Spec.Hooks.HistoryLimit = &limit
+
+	builder := &PhareReconciler{Scheme: scheme}
+	var objs []client.Object
+	objs = append(objs, phare)
+	for i, hash := range []string{"aaaaaaaaaa", "bbbbbbbbbb", "cccccccccc"} {
+		job := builder.desiredHookJob(phare, preDeployHook, phare.Spec.Hooks.PreDeploy, hash)
+		job.CreationTimestamp = metav1.Unix(int64(i*60), 0)
+		objs = append(objs, job)
+	}
+	r := newTestReconciler(t, scheme, objs...)
+	ctx := context.Background()
+
+	if err := r.pruneHookJobs(ctx, phare, preDeployHook, "aaaaaaaaaa", hookHistoryLimit(phare)); err != nil {
+		t.Fatalf("prune hook jobs: %v", err)
+	}
+
+	jobs := &batchv1.JobList{}
+	if err := r.List(ctx, jobs, client.InNamespace(phare.Namespace)); err != nil {
+		t.Fatalf("list jobs: %v", err)
+	}
+	remaining := map[string]bool{}
+	for _, job := range jobs.Items {
+		remaining[job.Labels[hookHashLabel]] = true
+	}
+	if len(remaining) != 2 || !remaining["aaaaaaaaaa"] || !remaining["cccccccccc"] {
+		t.Fatalf("expected current and newest previous hook jobs to remain, got %v", remaining)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"reflect"
-	"strings"
 
 	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
 	corev1 "k8s.io/api/core/v1"
@@ -87,14 +86,6 @@ func (r *PhareReconciler) updateService(ctx context.Context, service *corev1.Ser
 }
 
 func (r *PhareReconciler) desiredService(phare *pharev1beta1.Phare) *corev1.Service {
-
-	// Base labels for resources created by this controller.
-	metadataLabels := map[string]string{
-		"app":                          phare.Name,
-		"app.kubernetes.io/created-by": "phare-controller",
-		// "version":                      phare.Spec.Microservice.Image.Tag // Use later for rolling updates
-	}
-
 	service := &corev1.Service{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
@@ -103,8 +94,8 @@ func (r *PhareReconciler) desiredService(phare *pharev1beta1.Phare) *corev1.Serv
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        phare.Name,
 			Namespace:   phare.Namespace,
-			Annotations: serviceAnnotationsFromPhare(phare.Annotations),
-			Labels:      mergeStringMaps(metadataLabels, phare.Labels),
+			Annotations: childAnnotations(phare, pharev1beta1.PropagationTargetService),
+			Labels:      childLabels(phare, pharev1beta1.PropagationTargetService),
 		},
 		Spec: *phare.Spec.Service,
 	}
@@ -120,6 +111,10 @@ func (r *PhareReconciler) desiredService(phare *pharev1beta1.Phare) *corev1.Serv
 	service.Spec.Selector = map[string]string{
 		"app": phare.Name,
 	}
+	// With the BlueGreen strategy the Service selects the active color.
+	if color := activeColor(phare); color != "" {
+		service.Spec.Selector["app"] = colorName(phare, color)
+	}
 
 	// Set owner reference for the Service to be the Phare object
 	// https://book.kubebuilder.io/reference/using-finalizers.html#finalizer-owners.
@@ -174,31 +169,7 @@ func mergeServiceSpecPreservingImmutable(existing, desired corev1.ServiceSpec, p
 }
 
 func shouldReallocateNodePorts(phare *pharev1beta1.Phare) bool {
-	if phare == nil {
-		return false
-	}
-	v, ok := phare.Annotations[reallocateNodePortAnnotation]
-	if !ok {
-		return false
-	}
-	switch strings.ToLower(strings.TrimSpace(v)) {
-	case "1", "true", "yes", "on":
-		return true
-	default:
-		return false
-	}
-}
-
-func serviceAnnotationsFromPhare(in map[string]string) map[string]string {
-	out := copyStringMapPreserveNil(in)
-	if out == nil {
-		return nil
-	}
-	delete(out, reallocateNodePortAnnotation)
-	if len(out) == 0 {
-		return nil
-	}
-	return out
+	return annotationEnabled(phare, reallocateNodePortAnnotation)
 }
 
 // normalizeServiceSpecForDiff treats omitted optional fields as "keep existing".
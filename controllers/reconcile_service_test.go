@@ -105,15 +105,16 @@ func TestShouldReallocateNodePorts(t *testing.T) {
 }
 
 func TestServiceAnnotationsFromPhare(t *testing.T) {
-	if out := serviceAnnotationsFromPhare(nil); out != nil {
+	phare := basePhare("app", "default")
+	if out := childAnnotations(phare, pharev1beta1.PropagationTargetService); out != nil {
 		t.Fatalf("expected nil input to return nil, got %#v", out)
 	}
 
-	in := map[string]string{
+	phare.Annotations = map[string]string{
 		"owner":                      "team-a",
 		reallocateNodePortAnnotation: "true",
 	}
-	out := serviceAnnotationsFromPhare(in)
+	out := childAnnotations(phare, pharev1beta1.PropagationTargetService)
 	if out == nil {
 		t.Fatalf("expected filtered annotations map")
 	}
@@ -124,8 +125,8 @@ func TestServiceAnnotationsFromPhare(t *testing.T) {
 		t.Fatalf("expected control annotation to be removed, got %#v", out)
 	}
 
-	onlyControl := map[string]string{reallocateNodePortAnnotation: "true"}
-	if out := serviceAnnotationsFromPhare(onlyControl); out != nil {
+	phare.Annotations = map[string]string{reallocateNodePortAnnotation: "true"}
+	if out := childAnnotations(phare, pharev1beta1.PropagationTargetService); out != nil {
 		t.Fatalf("expected nil when only control annotation present, got %#v", out)
 	}
 }
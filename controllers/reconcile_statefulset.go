@@ -14,7 +14,6 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
-	tpl "github.com/localcorp/phare-controller/pkg/go-templates"
 )
 
 func (r *PhareReconciler) reconcileStatefulSet(ctx context.Context, phare pharev1beta1.Phare) error {
@@ -23,27 +22,32 @@ func (r *PhareReconciler) reconcileStatefulSet(ctx context.Context, phare pharev
 		return fmt.Errorf("failed to build desired StatefulSet for %s/%s", phare.Namespace, phare.Name)
 	}
 
-	// Inject ConfigMap hash annotation using the reconcile context so that pod
-	// templates are rolled when config changes.
-	if phare.Spec.ToolChain != nil && len(phare.Spec.ToolChain.Config) > 0 {
-		hash, err := r.hashConfigMapData(ctx, phare.Name+"-config", phare.Namespace)
-		if err != nil {
-			return fmt.Errorf("hash configmap %s: %w", phare.Name+"-config", err)
-		}
-		if desiredStatefulSet.Spec.Template.Annotations == nil {
-			desiredStatefulSet.Spec.Template.Annotations = make(map[string]string)
-		}
-		desiredStatefulSet.Spec.Template.Annotations["checksum/config-files"] = hash
+	if err := r.setConfigChecksum(ctx, &phare, &desiredStatefulSet.Spec.Template); err != nil {
+		return err
 	}
 
 	existingStatefulSet := &appsv1.StatefulSet{}
 	err := r.Get(ctx, client.ObjectKey{Name: desiredStatefulSet.Name, Namespace: phare.Namespace}, existingStatefulSet)
 
 	if err != nil && errors.IsNotFound(err) {
+		// Let the new StatefulSet adopt Pods orphaned by a selector migration.
+		if err := r.labelOrphansForAdoption(ctx, &phare, &corev1.PodList{}); err != nil {
+			return err
+		}
 		if createErr := r.Create(ctx, desiredStatefulSet); createErr != nil {
 			return createErr
 		}
 	} else if err == nil {
+		if !existingStatefulSet.DeletionTimestamp.IsZero() {
+			// The delete event requeues the Phare once the old object is gone.
+			r.Log.Info("Waiting for StatefulSet deletion to finish", "StatefulSet.Namespace", existingStatefulSet.Namespace, "StatefulSet.Name", existingStatefulSet.Name)
+			return nil
+		}
+		// The selector is immutable; recreate workloads still using the legacy one.
+		if metav1.IsControlledBy(existingStatefulSet, &phare) && !hasStableSelector(existingStatefulSet.Spec.Selector, &phare) {
+			return r.orphanWorkload(ctx, &phare, existingStatefulSet, "StatefulSet")
+		}
+
 		// Warn when the user changed VolumeClaimTemplates in the Phare spec: the field
 		// is immutable on StatefulSets and the change cannot be applied without a
 		// delete+recreate. Emit a Warning event so operators are not left guessing.
@@ -58,6 +62,11 @@ func (r *PhareReconciler) reconcileStatefulSet(ctx context.Context, phare pharev
 		// Keep a copy so we can patch only when something changed.
 		originalStatefulSet := existingStatefulSet.DeepCopy()
 		r.mergeStatefulSets(desiredStatefulSet, existingStatefulSet)
+		if podTemplateHeld(&phare) {
+			// Keep the running pod template until it is approved and a
+			// maintenance window opens.
+			existingStatefulSet.Spec.Template = originalStatefulSet.Spec.Template
+		}
 
 		diff := cmp.Diff(originalStatefulSet, existingStatefulSet, podTemplateCompareOptions())
 		if diff != "" {
@@ -78,6 +87,9 @@ func (r *PhareReconciler) reconcileStatefulSet(ctx context.Context, phare pharev
 }
 
 func (r *PhareReconciler) mergeStatefulSets(desiredStatefulSet, existingStatefulSet *appsv1.StatefulSet) {
+	// Other controllers annotate workloads (e.g. deployment.kubernetes.io/revision),
+	// so controller-managed metadata is merged rather than replaced.
+	mergeManagedMetadata(&existingStatefulSet.ObjectMeta, desiredStatefulSet.ObjectMeta)
 	existingStatefulSet.Spec.Replicas = desiredStatefulSet.Spec.Replicas
 	existingStatefulSet.Spec.Template.Labels = copyStringMapPreserveNil(desiredStatefulSet.Spec.Template.Labels)
 	existingStatefulSet.Spec.Template.Annotations = copyStringMapPreserveNil(desiredStatefulSet.Spec.Template.Annotations)
@@ -98,24 +110,17 @@ func vctEqual(a, b []corev1.PersistentVolumeClaim) bool {
 }
 
 func (r *PhareReconciler) newStatefulSet(phare *pharev1beta1.Phare) *appsv1.StatefulSet {
-	// Base labels for resources created by this controller.
-	metadataLabels := map[string]string{
-		"app":                          phare.Name,
-		"app.kubernetes.io/created-by": "phare-controller",
+	// Spec pod annotations override annotations propagated from the Phare.
+	podAnnotations := childAnnotations(phare, pharev1beta1.PropagationTargetPodTemplate)
+	if podAnnotations == nil {
+		podAnnotations = map[string]string{}
 	}
-
-	// Default pod labels and annotations.
-	podLabels := map[string]string{
-		"app": phare.Name,
-	}
-	for key, value := range phare.Spec.MicroService.PodLabels {
-		podLabels[key] = value
-	}
-
-	podAnnotations := map[string]string{}
 	for key, value := range phare.Spec.MicroService.PodAnnotations {
 		podAnnotations[key] = value
 	}
+	if restarted := restartedAt(phare); restarted != "" {
+		podAnnotations[restartedAtAnnotation] = restarted
+	}
 
 	containers := []corev1.Container{
 		{
@@ -141,18 +146,19 @@ func (r *PhareReconciler) newStatefulSet(phare *pharev1beta1.Phare) *appsv1.Stat
 			Kind:       "StatefulSet",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      phare.Name,
-			Namespace: phare.Namespace,
-			Labels:    metadataLabels,
+			Name:        phare.Name,
+			Namespace:   phare.Namespace,
+			Labels:      childLabels(phare, pharev1beta1.PropagationTargetStatefulSet),
+			Annotations: childAnnotations(phare, pharev1beta1.PropagationTargetStatefulSet),
 		},
 		Spec: appsv1.StatefulSetSpec{
 			Selector: &metav1.LabelSelector{
-				MatchLabels: podLabels,
+				MatchLabels: workloadSelectorLabels(phare),
 			},
-			Replicas: &phare.Spec.MicroService.ReplicaCount,
+			Replicas: workloadReplicas(phare),
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels:      podLabels,
+					Labels:      workloadPodLabels(phare),
 					Annotations: podAnnotations,
 				},
 				Spec: corev1.PodSpec{
@@ -173,21 +179,14 @@ func (r *PhareReconciler) newStatefulSet(phare *pharev1beta1.Phare) *appsv1.Stat
 		return nil
 	}
 
-	// Add config volume only when toolchain config exists.
-	if phare.Spec.ToolChain != nil && len(phare.Spec.ToolChain.Config) > 0 {
-		addConfigVolumeToSpec(&statefulSet.Spec.Template, phare.Name+"-config")
-	}
-
 	// Set default file mode for Secret/ConfigMap volumes.
 	for i := range statefulSet.Spec.Template.Spec.Volumes {
 		UpdateVolume(&statefulSet.Spec.Template.Spec.Volumes[i], 420)
 	}
 
-	// Render liveness probe templates if present.
-	if err := tpl.ProcessLivenessProbeTemplate(statefulSet.Spec.Template.Spec.Containers[0].LivenessProbe, phare.ObjectMeta); err != nil {
-		r.Log.Error(err, "Error processing liveness probe template")
-		return nil
-	}
+	// Config volumes set their own file mode.
+	addConfigVolumes(phare, &statefulSet.Spec.Template)
+	addSecretsVolume(phare, &statefulSet.Spec.Template)
 
 	return statefulSet
 }
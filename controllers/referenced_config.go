@@ -0,0 +1,197 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+)
+
+const (
+	// referencedConfigIndex indexes Phares by the ConfigMaps and Secrets their
+	// pods reference, as Kind/name, excluding spec.microservice.ignoredReferences.
+	referencedConfigIndex = "spec.microservice.configReferences"
+
+	// referencedConfigAnnotation is the pod template annotation holding the
+	// combined hash of the referenced ConfigMaps and Secrets.
+	referencedConfigAnnotation = "checksum/referenced-config"
+)
+
+// configReferences returns the ConfigMaps and Secrets referenced by the
+// containers and volumes of phare, as sorted Kind/name keys, without the
+// ignored ones.
+func configReferences(phare *pharev1beta1.Phare) []string {
+	ms := &phare.Spec.MicroService
+	refs := map[string]bool{}
+	add := func(kind, name string) {
+		if name != "" {
+			refs[kind+"/"+name] = true
+		}
+	}
+	addContainer := func(env []corev1.EnvVar, envFrom []corev1.EnvFromSource) {
+		for _, source := range envFrom {
+			if source.ConfigMapRef != nil {
+				add("ConfigMap", source.ConfigMapRef.Name)
+			}
+			if source.SecretRef != nil {
+				add("Secret", source.SecretRef.Name)
+			}
+		}
+		for _, v := range env {
+			if v.ValueFrom == nil {
+				continue
+			}
+			if v.ValueFrom.ConfigMapKeyRef != nil {
+				add("ConfigMap", v.ValueFrom.ConfigMapKeyRef.Name)
+			}
+			if v.ValueFrom.SecretKeyRef != nil {
+				add("Secret", v.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	}
+
+	addContainer(ms.Env, ms.EnvFrom)
+	for _, c := range ms.ExtraContainers {
+		addContainer(c.Env, c.EnvFrom)
+	}
+	for _, c := range ms.InitContainers {
+		addContainer(c.Env, c.EnvFrom)
+	}
+	for _, volume := range ms.Volumes {
+		if volume.ConfigMap != nil {
+			add("ConfigMap", volume.ConfigMap.Name)
+		}
+		if volume.Secret != nil {
+			add("Secret", volume.Secret.SecretName)
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					add("ConfigMap", source.ConfigMap.Name)
+				}
+				if source.Secret != nil {
+					add("Secret", source.Secret.Name)
+				}
+			}
+		}
+	}
+
+	for _, ignored := range ms.IgnoredReferences {
+		delete(refs, ignored.Kind+"/"+ignored.Name)
+	}
+	keys := make([]string, 0, len(refs))
+	for key := range refs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setReferencedConfigChecksum sets the referencedConfigAnnotation of template
+// to the combined hash of the data of the ConfigMaps and Secrets referenced by
+// phare, so that changing them rolls the pods. Missing ones hash as absent.
+func (r *PhareReconciler) setReferencedConfigChecksum(ctx context.Context, phare *pharev1beta1.Phare, template *corev1.PodTemplateSpec) error {
+	refs := configReferences(phare)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	h := sha256.New()
+	for _, ref := range refs {
+		fmt.Fprintf(h, "%s\n", ref)
+		hash, err := r.referencedConfigHash(ctx, phare.Namespace, ref)
+		if err != nil {
+			return fmt.Errorf("hash %s: %w", ref, err)
+		}
+		fmt.Fprintf(h, "%s\n", hash)
+	}
+	if template.Annotations == nil {
+		template.Annotations = make(map[string]string)
+	}
+	template.Annotations[referencedConfigAnnotation] = fmt.Sprintf("%x", h.Sum(nil))
+	return nil
+}
+
+// referencedConfigHash hashes the data of the ConfigMap or Secret ref, or
+// returns "absent" if it does not exist.
+func (r *PhareReconciler) referencedConfigHash(ctx context.Context, namespace, ref string) (string, error) {
+	kind, name, _ := strings.Cut(ref, "/")
+	key := client.ObjectKey{Name: name, Namespace: namespace}
+	data := map[string]string{}
+	switch kind {
+	case "ConfigMap":
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, key, cm); err != nil {
+			if errors.IsNotFound(err) {
+				return "absent", nil
+			}
+			return "", err
+		}
+		for k, v := range cm.Data {
+			data[k] = v
+		}
+		for k, v := range cm.BinaryData {
+			data["binary:"+k] = string(v)
+		}
+	case "Secret":
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, key, secret); err != nil {
+			if errors.IsNotFound(err) {
+				return "absent", nil
+			}
+			return "", err
+		}
+		for k, v := range secret.Data {
+			data[k] = string(v)
+		}
+	}
+	return configDataHash(data), nil
+}
+
+// referencedConfigIndexValues extracts the referencedConfigIndex values of a
+// Phare.
+func referencedConfigIndexValues(obj client.Object) []string {
+	phare, ok := obj.(*pharev1beta1.Phare)
+	if !ok {
+		return nil
+	}
+	// Schema ConfigMaps are indexed too, so that fixing a schema revalidates
+	// the config; they are not part of the pod template checksum.
+	refs := configReferences(phare)
+	seen := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		seen[ref] = true
+	}
+	for _, ref := range configSchemaReferences(phare) {
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// referencingPhares maps a ConfigMap or Secret to the Phares of its namespace
+// whose pods, or config schemas, reference it.
+func (r *PhareReconciler) referencingPhares(kind string) func(context.Context, client.Object) []reconcile.Request {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		phares := &pharev1beta1.PhareList{}
+		if err := r.List(ctx, phares, client.InNamespace(obj.GetNamespace()), client.MatchingFields{referencedConfigIndex: kind + "/" + obj.GetName()}); err != nil {
+			r.Log.Error(err, "Failed to list Phares referencing "+kind, kind+".Namespace", obj.GetNamespace(), kind+".Name", obj.GetName())
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(phares.Items))
+		for _, phare := range phares.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&phare)})
+		}
+		return requests
+	}
+}
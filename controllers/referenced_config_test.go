@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"testing"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReferencedConfigChangesRollPods(t *testing.T) {
+	phare := basePhare("app", "default")
+	phare.Spec.MicroService.EnvFrom = []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "shared"}}}}
+	phare.Spec.MicroService.Env = []corev1.EnvVar{{Name: "DB_PASSWORD", ValueFrom: &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "db"}, Key: "password"},
+	}}}
+	phare.Spec.MicroService.Volumes = []corev1.Volume{{Name: "certs", VolumeSource: corev1.VolumeSource{
+		ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "certs"}},
+	}}}
+	phare.Spec.MicroService.IgnoredReferences = []pharev1beta1.ConfigReference{{Kind: "ConfigMap", Name: "certs"}}
+	f := newReconcileFixture(t, phare)
+
+	shared := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "default"}, Data: map[string]string{"LOG_LEVEL": "info"}}
+	db := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"}, Data: map[string][]byte{"password": []byte("one")}}
+	certs := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "certs", Namespace: "default"}, Data: map[string]string{"ca.pem": "a"}}
+	for _, obj := range []client.Object{shared, db, certs} {
+		if err := f.r.Create(f.ctx, obj); err != nil {
+			t.Fatalf("create %s: %v", obj.GetName(), err)
+		}
+	}
+
+	checksum := func() string {
+		t.Helper()
+		f.reconcile()
+		deploy := &appsv1.Deployment{}
+		if err := f.r.Get(f.ctx, client.ObjectKey{Name: "app", Namespace: "default"}, deploy); err != nil {
+			t.Fatalf("get deployment: %v", err)
+		}
+		return deploy.Spec.Template.Annotations[referencedConfigAnnotation]
+	}
+
+	first := checksum()
+	if first == "" {
+		t.Fatalf("expected the referenced config checksum annotation")
+	}
+
+	db.Data["password"] = []byte("two")
+	if err := f.r.Update(f.ctx, db); err != nil {
+		t.Fatalf("update secret: %v", err)
+	}
+	second := checksum()
+	if second == first {
+		t.Fatalf("expected a Secret change to change the checksum")
+	}
+
+	certs.Data["ca.pem"] = "b"
+	if err := f.r.Update(f.ctx, certs); err != nil {
+		t.Fatalf("update configmap: %v", err)
+	}
+	if third := checksum(); third != second {
+		t.Fatalf("expected an ignored ConfigMap not to change the checksum")
+	}
+
+	if reqs := f.r.referencingPhares("Secret")(f.ctx, db); len(reqs) != 1 || reqs[0].Name != "app" {
+		t.Fatalf("expected the Secret to requeue app, got %v", reqs)
+	}
+	if reqs := f.r.referencingPhares("ConfigMap")(f.ctx, shared); len(reqs) != 1 {
+		t.Fatalf("expected the ConfigMap to requeue app, got %v", reqs)
+	}
+	if reqs := f.r.referencingPhares("ConfigMap")(f.ctx, certs); len(reqs) != 0 {
+		t.Fatalf("expected the ignored ConfigMap not to requeue app, got %v", reqs)
+	}
+}
@@ -0,0 +1,27 @@
+package controllers
+
+import (
+	"time"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+)
+
+// restartedAtAnnotation is set on the Phare by `kubectl phare restart` and on the
+// pod template by the workload builders. Changing it rolls the pods.
+const restartedAtAnnotation = "phare.localcorp.internal/restartedAt"
+
+// restartedAt returns the pod template value of restartedAtAnnotation: the most
+// recent of spec.restartedAt and the Phare annotation. An annotation that is not
+// RFC 3339 is only used when spec.restartedAt is unset.
+func restartedAt(phare *pharev1beta1.Phare) string {
+	fromAnnotation := phare.Annotations[restartedAtAnnotation]
+	if phare.Spec.RestartedAt == nil {
+		return fromAnnotation
+	}
+
+	fromSpec := phare.Spec.RestartedAt.UTC()
+	if annotated, err := time.Parse(time.RFC3339, fromAnnotation); err == nil && annotated.After(fromSpec) {
+		return fromAnnotation
+	}
+	return fromSpec.Format(time.RFC3339)
+}
@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestRestartedAtPrefersMostRecentSource(t *testing.T) {
+	phare := basePhare("demo", "default")
+	if got := restartedAt(phare); got != "" {
+		t.Fatalf("expected no restart stamp, got %q", got)
+	}
+
+	spec := metav1.NewTime(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	phare.Spec.RestartedAt = &spec
+	if got := restartedAt(phare); got != "2024-05-01T10:00:00Z" {
+		t.Fatalf("expected spec stamp, got %q", got)
+	}
+
+	phare.Annotations = map[string]string{restartedAtAnnotation: "2024-05-02T08:00:00Z"}
+	if got := restartedAt(phare); got != "2024-05-02T08:00:00Z" {
+		t.Fatalf("expected newer annotation stamp, got %q", got)
+	}
+
+	phare.Annotations[restartedAtAnnotation] = "2024-04-01T08:00:00Z"
+	if got := restartedAt(phare); got != "2024-05-01T10:00:00Z" {
+		t.Fatalf("expected newer spec stamp, got %q", got)
+	}
+}
+
+func TestReconcileDeploymentAppliesRestartStamp(t *testing.T) {
+	scheme := testScheme(t)
+	old := basePhare("demo", "default")
+
+	builder := &PhareReconciler{Scheme: scheme}
+	existing := builder.newDeployment(old)
+	if existing == nil {
+		t.Fatalf("expected existing deployment")
+	}
+
+	updated := old.DeepCopy()
+	updated.Annotations = map[string]string{restartedAtAnnotation: "2024-05-02T08:00:00Z"}
+
+	r := newTestReconciler(t, scheme, updated, existing)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: updated.Name, Namespace: updated.Namespace}}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile restart: %v", err)
+	}
+
+	current := &appsv1.Deployment{}
+	if err := r.Get(context.Background(), req.NamespacedName, current); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if got := current.Spec.Template.Annotations[restartedAtAnnotation]; got != "2024-05-02T08:00:00Z" {
+		t.Fatalf("expected restart stamp on pod template, got %q", got)
+	}
+}
@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// revisionHashLabel identifies the microservice spec stored in a ControllerRevision.
+	revisionHashLabel = "phare.localcorp.internal/revision-hash"
+
+	defaultRevisionHistoryLimit = 10
+
+	// rolloutPollInterval is how often an unavailable workload is re-checked for
+	// failing pods, whose status changes are not watched.
+	rolloutPollInterval = 30 * time.Second
+)
+
+// failingWaitingReasons are container waiting reasons that will not resolve
+// without a change to the pod spec.
+var failingWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// resolveRevision replaces phare.Spec.MicroService with the revision that must
+// be applied, records it as a ControllerRevision and prunes old revisions. The
+// in-memory spec is never written back: only status is persisted.
+func (r *PhareReconciler) resolveRevision(ctx context.Context, phare *pharev1beta1.Phare) error {
+	revisions, err := r.listRevisions(ctx, phare)
+	if err != nil {
+		return err
+	}
+
+	var target *appsv1.ControllerRevision
+	switch {
+	case phare.Spec.Rollback != nil && phare.Spec.Rollback.ToRevision != nil:
+		n := *phare.Spec.Rollback.ToRevision
+		if target = findRevision(revisions, n); target == nil {
+			return fmt.Errorf("revision %d of Phare %s/%s not found", n, phare.Namespace, phare.Name)
+		}
+		if rb := phare.Status.RolledBack; rb == nil || rb.Revision != n || rb.FailedRevision != 0 {
+			phare.Status.RolledBack = &pharev1beta1.RollbackStatus{
+				Revision: n,
+				Reason:   fmt.Sprintf("Manual rollback to revision %d", n),
+				Time:     metav1.Now(),
+			}
+			r.Recorder.Eventf(phare, corev1.EventTypeNormal, "RolledBack", "Rolled back to revision %d", n)
+		}
+	case phare.Status.RolledBack != nil && phare.Status.RolledBack.FailedRevision != 0:
+		// Stay on the good revision until spec.microservice moves past the failed one.
+		failed := findRevision(revisions, phare.Status.RolledBack.FailedRevision)
+		if failed != nil && failed.Labels[revisionHashLabel] == microServiceHash(phare.Spec.MicroService) {
+			target = findRevision(revisions, phare.Status.RolledBack.Revision)
+		}
+		if target == nil {
+			phare.Status.RolledBack = nil
+		}
+	default:
+		phare.Status.RolledBack = nil
+	}
+
+	if target != nil {
+		spec := pharev1beta1.MicroServiceSpec{}
+		if err := json.Unmarshal(target.Data.Raw, &spec); err != nil {
+			return fmt.Errorf("decode revision %d of Phare %s/%s: %w", target.Revision, phare.Namespace, phare.Name, err)
+		}
+		// Scaling is not part of a release: keep the replica count of the spec.
+		spec.ReplicaCount = phare.Spec.MicroService.ReplicaCount
+		phare.Spec.MicroService = spec
+		phare.Status.CurrentRevision = target.Revision
+	} else {
+		revision, err := r.recordRevision(ctx, phare, revisions)
+		if err != nil {
+			return err
+		}
+		if revision.Revision != phare.Status.CurrentRevision {
+			apimeta.RemoveStatusCondition(&phare.Status.Conditions, pharev1beta1.ConditionRolloutFailed)
+		}
+		phare.Status.CurrentRevision = revision.Revision
+		revisions = append(revisions, *revision)
+	}
+
+	return r.pruneRevisions(ctx, phare, revisions)
+}
+
+// recordRevision returns the ControllerRevision holding the current
+// microservice spec, creating it with the next revision number if needed.
+func (r *PhareReconciler) recordRevision(ctx context.Context, phare *pharev1beta1.Phare, revisions []appsv1.ControllerRevision) (*appsv1.ControllerRevision, error) {
+	hash := microServiceHash(phare.Spec.MicroService)
+	var next int64 = 1
+	for i := range revisions {
+		if revisions[i].Labels[revisionHashLabel] == hash {
+			return &revisions[i], nil
+		}
+		if revisions[i].Revision >= next {
+			next = revisions[i].Revision + 1
+		}
+	}
+
+	data, err := json.Marshal(revisionSpec(phare.Spec.MicroService))
+	if err != nil {
+		return nil, err
+	}
+	labels := standardLabels(phare)
+	labels[revisionHashLabel] = hash
+	revision := &appsv1.ControllerRevision{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      revisionName(phare.Name, hash),
+			Namespace: phare.Namespace,
+			Labels:    labels,
+		},
+		Data:     runtime.RawExtension{Raw: data},
+		Revision: next,
+	}
+	if err := ctrl.SetControllerReference(phare, revision, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := r.Create(ctx, revision); errors.IsAlreadyExists(err) {
+		// Revisions are named by hash: a concurrent reconcile recorded this one.
+		existing := &appsv1.ControllerRevision{}
+		if err := r.reader().Get(ctx, client.ObjectKeyFromObject(revision), existing); err != nil {
+			return nil, err
+		}
+		return existing, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// listRevisions lists the revisions of phare from the API server: the next
+// revision number must not come from a stale cache, and the controller has no
+// informer for ControllerRevisions.
+func (r *PhareReconciler) listRevisions(ctx context.Context, phare *pharev1beta1.Phare) ([]appsv1.ControllerRevision, error) {
+	list := &appsv1.ControllerRevisionList{}
+	if err := r.reader().List(ctx, list, client.InNamespace(phare.Namespace),
+		client.MatchingLabels{"app.kubernetes.io/instance": phare.Name},
+		client.HasLabels{revisionHashLabel}); err != nil {
+		return nil, err
+	}
+	owned := make([]appsv1.ControllerRevision, 0, len(list.Items))
+	for _, revision := range list.Items {
+		if metav1.IsControlledBy(&revision, phare) {
+			owned = append(owned, revision)
+		}
+	}
+	return owned, nil
+}
+
+// pruneRevisions deletes the oldest revisions beyond the history limit. Revisions
+// referenced from spec or status are always kept.
+func (r *PhareReconciler) pruneRevisions(ctx context.Context, phare *pharev1beta1.Phare, revisions []appsv1.ControllerRevision) error {
+	keep := defaultRevisionHistoryLimit
+	if phare.Spec.Rollback != nil && phare.Spec.Rollback.RevisionHistoryLimit != nil {
+		keep = int(*phare.Spec.Rollback.RevisionHistoryLimit)
+	}
+	if len(revisions) <= keep {
+		return nil
+	}
+
+	pinned := map[int64]bool{
+		phare.Status.CurrentRevision:  true,
+		phare.Status.LastGoodRevision: true,
+	}
+	if rb := phare.Status.RolledBack; rb != nil {
+		pinned[rb.Revision] = true
+		pinned[rb.FailedRevision] = true
+	}
+	if phare.Spec.Rollback != nil && phare.Spec.Rollback.ToRevision != nil {
+		pinned[*phare.Spec.Rollback.ToRevision] = true
+	}
+
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision > revisions[j].Revision })
+	for i := keep; i < len(revisions); i++ {
+		if pinned[revisions[i].Revision] {
+			continue
+		}
+		if err := r.Delete(ctx, &revisions[i]); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRollout records the last revision that became available and detects
+// failed rollouts, rolling back to the last good revision when automatic
+// rollback is enabled.
+func (r *PhareReconciler) checkRollout(ctx context.Context, phare *pharev1beta1.Phare) (ctrl.Result, error) {
+	if phare.Spec.Suspend {
+		return ctrl.Result{}, nil
+	}
+
+	available, err := r.workloadAvailable(ctx, phare)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if available {
+		phare.Status.LastGoodRevision = phare.Status.CurrentRevision
+		r.setRolloutFailed(phare, metav1.ConditionFalse, pharev1beta1.ReasonRolloutHealthy, "Workload is available")
+		return ctrl.Result{}, nil
+	}
+
+	reason, message, err := r.rolloutFailure(ctx, phare)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if reason == "" {
+		return ctrl.Result{RequeueAfter: rolloutPollInterval}, nil
+	}
+
+	message = fmt.Sprintf("Revision %d failed: %s", phare.Status.CurrentRevision, message)
+	if !apimeta.IsStatusConditionTrue(phare.Status.Conditions, pharev1beta1.ConditionRolloutFailed) {
+		r.Recorder.Event(phare, corev1.EventTypeWarning, "RolloutFailed", message)
+	}
+	r.setRolloutFailed(phare, metav1.ConditionTrue, reason, message)
+
+	good := phare.Status.LastGoodRevision
+	if !automaticRollback(phare) || good == 0 || good == phare.Status.CurrentRevision {
+		return ctrl.Result{RequeueAfter: rolloutPollInterval}, nil
+	}
+	phare.Status.RolledBack = &pharev1beta1.RollbackStatus{
+		Revision:       good,
+		FailedRevision: phare.Status.CurrentRevision,
+		Reason:         message,
+		Time:           metav1.Now(),
+	}
+	r.Recorder.Eventf(phare, corev1.EventTypeWarning, "RolledBack", "Rolled back to revision %d: %s", good, message)
+	// The next reconcile applies the good revision.
+	return ctrl.Result{Requeue: true}, nil
+}
+
+// rolloutFailure reports why the rollout of the applied spec failed, or an
+// empty reason while it may still succeed.
+func (r *PhareReconciler) rolloutFailure(ctx context.Context, phare *pharev1beta1.Phare) (string, string, error) {
+	name, selector := rolloutTarget(phare)
+	key := client.ObjectKey{Name: name, Namespace: phare.Namespace}
+	if phare.Spec.MicroService.Kind == "Deployment" {
+		d := &appsv1.Deployment{}
+		if err := r.Get(ctx, key, d); err != nil {
+			return "", "", client.IgnoreNotFound(err)
+		}
+		if d.Status.ObservedGeneration >= d.Generation {
+			for _, c := range d.Status.Conditions {
+				if c.Type == appsv1.DeploymentProgressing && c.Status == corev1.ConditionFalse && c.Reason == "ProgressDeadlineExceeded" {
+					return pharev1beta1.ReasonProgressDeadlineExceeded, c.Message, nil
+				}
+			}
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.reader().List(ctx, pods, client.InNamespace(phare.Namespace), client.MatchingLabels(selector)); err != nil {
+		return "", "", err
+	}
+	image := imageRef(phare.Spec.MicroService.Image)
+	for _, pod := range pods.Items {
+		if !runsImage(&pod, phare.Name, image) {
+			continue
+		}
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			if w := cs.State.Waiting; w != nil && failingWaitingReasons[w.Reason] {
+				return pharev1beta1.ReasonPodsFailing, fmt.Sprintf("pod %s: container %s is in %s", pod.Name, cs.Name, w.Reason), nil
+			}
+		}
+	}
+	return "", "", nil
+}
+
+func (r *PhareReconciler) setRolloutFailed(phare *pharev1beta1.Phare, status metav1.ConditionStatus, reason, message string) {
+	apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+		Type:               pharev1beta1.ConditionRolloutFailed,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: phare.Generation,
+	})
+}
+
+// rolloutTarget returns the name and pod selector of the workload rolling out
+// the applied spec: the preview color during a blue/green switch.
+func rolloutTarget(phare *pharev1beta1.Phare) (string, map[string]string) {
+	name := phare.Name
+	if st := phare.Status.BlueGreen; isBlueGreen(phare) && st != nil {
+		color := st.ActiveColor
+		if st.PreviewHash != "" || color == "" {
+			color = idleColor(phare)
+		}
+		name = colorName(phare, color)
+		return name, instanceLabels(workloadSelectorLabels(phare), name)
+	}
+	return name, workloadSelectorLabels(phare)
+}
+
+// runsImage reports whether the pod's main container runs the given image, so
+// pods of a previous revision that are still terminating are ignored.
+func runsImage(pod *corev1.Pod, container, image string) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == container {
+			return c.Image == image
+		}
+	}
+	return false
+}
+
+func automaticRollback(phare *pharev1beta1.Phare) bool {
+	return phare.Spec.Rollback != nil && phare.Spec.Rollback.Automatic && phare.Spec.Rollback.ToRevision == nil
+}
+
+func findRevision(revisions []appsv1.ControllerRevision, n int64) *appsv1.ControllerRevision {
+	for i := range revisions {
+		if revisions[i].Revision == n {
+			return &revisions[i]
+		}
+	}
+	return nil
+}
+
+// revisionSpec is the part of the microservice spec stored in a revision.
+func revisionSpec(spec pharev1beta1.MicroServiceSpec) pharev1beta1.MicroServiceSpec {
+	spec.ReplicaCount = 0
+	return spec
+}
+
+func microServiceHash(spec pharev1beta1.MicroServiceSpec) string {
+	data, _ := json.Marshal(revisionSpec(spec))
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:10]
+}
+
+func revisionName(phareName, hash string) string {
+	const maxPrefix = 253 - len("-") - 10
+	if len(phareName) > maxPrefix {
+		phareName = phareName[:maxPrefix]
+	}
+	return fmt.Sprintf("%s-%s", phareName, hash)
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+	"testing"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveRevisionRecordsEachMicroServiceSpec(t *testing.T) {
+	f := newReconcileFixture(t, basePhare("demo", "default"))
+
+	if phare := f.reconcile(); phare.Status.CurrentRevision != 1 {
+		t.Fatalf("expected revision 1, got %d", phare.Status.CurrentRevision)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.MicroService.ReplicaCount = 4 })
+	if phare := f.reconcile(); phare.Status.CurrentRevision != 1 {
+		t.Fatalf("expected scaling to keep revision 1, got %d", phare.Status.CurrentRevision)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.MicroService.Image.Tag = "v2" })
+	if phare := f.reconcile(); phare.Status.CurrentRevision != 2 {
+		t.Fatalf("expected revision 2, got %d", phare.Status.CurrentRevision)
+	}
+
+	revisions := &appsv1.ControllerRevisionList{}
+	if err := f.r.List(f.ctx, revisions); err != nil {
+		t.Fatalf("list revisions: %v", err)
+	}
+	if len(revisions.Items) != 2 {
+		t.Fatalf("expected 2 revisions, got %d", len(revisions.Items))
+	}
+}
+
+func TestRecordRevisionReusesRevisionMissingFromList(t *testing.T) {
+	f := newReconcileFixture(t, basePhare("demo", "default"))
+	phare := f.reconcile()
+
+	// A list that missed the revision, e.g. one recorded concurrently.
+	revision, err := f.r.recordRevision(f.ctx, phare, nil)
+	if err != nil {
+		t.Fatalf("record revision: %v", err)
+	}
+	if revision.Revision != 1 {
+		t.Fatalf("expected the recorded revision 1, got %d", revision.Revision)
+	}
+}
+
+func TestAutomaticRollbackOnCrashLoop(t *testing.T) {
+	phare := basePhare("demo", "default")
+	phare.Spec.Rollback = &pharev1beta1.RollbackSpec{Automatic: true}
+	f := newReconcileFixture(t, phare)
+
+	f.reconcile()
+	f.setAvailable("demo", true)
+	if got := f.reconcile(); got.Status.LastGoodRevision != 1 {
+		t.Fatalf("expected last good revision 1, got %d", got.Status.LastGoodRevision)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.MicroService.Image.Tag = "broken" })
+	// The fake client does not bump generations, so mark the rollout as pending up front.
+	f.setAvailable("demo", false)
+	f.reconcile()
+	if got := f.deploymentImage("demo"); got != "nginx:broken" {
+		t.Fatalf("expected new image to be rolled out, got %q", got)
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-abc", Namespace: "default", Labels: workloadSelectorLabels(phare)},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "demo", Image: "nginx:broken"}}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "demo",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		}}},
+	}
+	if err := f.r.Create(f.ctx, pod); err != nil {
+		t.Fatalf("create pod: %v", err)
+	}
+
+	got := f.reconcile()
+	if got.Status.RolledBack == nil || got.Status.RolledBack.Revision != 1 || got.Status.RolledBack.FailedRevision != 2 {
+		t.Fatalf("expected rollback from revision 2 to 1, got %+v", got.Status.RolledBack)
+	}
+
+	got = f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:latest" {
+		t.Fatalf("expected good image to be reapplied, got %q", img)
+	}
+	if got.Status.Phase != pharev1beta1.PharePhaseRolledBack {
+		t.Fatalf("expected phase RolledBack, got %q", got.Status.Phase)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.MicroService.Image.Tag = "fixed" })
+	got = f.reconcile()
+	if got.Status.RolledBack != nil || f.deploymentImage("demo") != "nginx:fixed" {
+		t.Fatalf("expected a new spec to clear the rollback, got %+v and image %q", got.Status.RolledBack, f.deploymentImage("demo"))
+	}
+}
+
+func TestManualRollbackToRevision(t *testing.T) {
+	f := newReconcileFixture(t, basePhare("demo", "default"))
+	f.reconcile()
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.MicroService.Image.Tag = "v2" })
+	f.reconcile()
+
+	f.update(func(p *pharev1beta1.Phare) {
+		revision := int64(1)
+		p.Spec.Rollback = &pharev1beta1.RollbackSpec{ToRevision: &revision}
+	})
+	got := f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:latest" {
+		t.Fatalf("expected revision 1 image, got %q", img)
+	}
+	if got.Status.RolledBack == nil || got.Status.RolledBack.Revision != 1 || got.Status.CurrentRevision != 1 {
+		t.Fatalf("expected status to report revision 1, got %+v", got.Status)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.Rollback.ToRevision = nil })
+	got = f.reconcile()
+	if img := f.deploymentImage("demo"); img != "nginx:v2" {
+		t.Fatalf("expected spec image after clearing toRevision, got %q", img)
+	}
+	if got.Status.RolledBack != nil {
+		t.Fatalf("expected rollback status to be cleared")
+	}
+}
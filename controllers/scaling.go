@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	"github.com/localcorp/phare-controller/pkg/cron"
+)
+
+// scaleOverrideName is reported in status.scaling while spec.scaleOverride applies.
+const scaleOverrideName = "scaleOverride"
+
+// resolveReplicas replaces spec.microservice.replicaCount in memory with the
+// replica count set by the schedules or an unexpired scale override, and
+// reports it in status.scaling. Like resolveRevision it runs before the
+// workload is built, so suspension still takes precedence.
+func (r *PhareReconciler) resolveReplicas(phare *pharev1beta1.Phare, now time.Time) error {
+	if len(phare.Spec.Schedules) == 0 && phare.Spec.ScaleOverride == nil {
+		phare.Status.Scaling = nil
+		return nil
+	}
+
+	st := &pharev1beta1.ScalingStatus{}
+	var lastFired, next time.Time
+	for _, schedule := range phare.Spec.Schedules {
+		loc, err := time.LoadLocation(schedule.TimeZone)
+		if err != nil {
+			return fmt.Errorf("invalid schedule time zone %q: %w", schedule.TimeZone, err)
+		}
+		parsed, err := cron.Parse(schedule.Schedule)
+		if err != nil {
+			return fmt.Errorf("invalid replica schedule: %w", err)
+		}
+		local := now.In(loc)
+		// On a tie the schedule listed last wins.
+		if fired := parsed.Prev(local); !fired.IsZero() && !fired.Before(lastFired) {
+			lastFired = fired
+			st.Active = scheduleName(schedule)
+			st.Replicas = schedule.Replicas
+		}
+		next = earliest(next, parsed.Next(local))
+	}
+	if o := phare.Spec.ScaleOverride; o != nil && now.Before(o.Until.Time) {
+		st.Active = scaleOverrideName
+		st.Replicas = o.Replicas
+		next = earliest(next, o.Until.Time)
+	}
+	if !next.IsZero() {
+		transition := metav1.NewTime(next)
+		st.NextTransition = &transition
+	}
+
+	if previous := phare.Status.Scaling; st.Active != "" && (previous == nil || previous.Active != st.Active || previous.Replicas != st.Replicas) {
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "ScheduledScaling", "Scaling to %d replicas set by %s", st.Replicas, st.Active)
+	}
+	if st.Active != "" {
+		phare.Spec.MicroService.ReplicaCount = st.Replicas
+	}
+	phare.Status.Scaling = st
+	return nil
+}
+
+// scalingRequeue requeues the Phare at the next schedule or override transition.
+func scalingRequeue(phare *pharev1beta1.Phare) ctrl.Result {
+	st := phare.Status.Scaling
+	if st == nil || st.NextTransition == nil {
+		return ctrl.Result{}
+	}
+	wait := time.Until(st.NextTransition.Time)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return ctrl.Result{RequeueAfter: wait}
+}
+
+func scheduleName(schedule pharev1beta1.ReplicaSchedule) string {
+	if schedule.Name != "" {
+		return schedule.Name
+	}
+	return schedule.Schedule
+}
+
+// earliest returns the earlier of two times, ignoring zero times.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestResolveReplicas(t *testing.T) {
+	nightly := []pharev1beta1.ReplicaSchedule{
+		{Name: "night", Schedule: "0 20 * * *", Replicas: 0},
+		{Name: "day", Schedule: "0 7 * * mon-fri", Replicas: 3},
+	}
+	// Thursday 2024-02-01.
+	at := func(day, hour int) time.Time {
+		return time.Date(2024, time.February, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	for _, tc := range []struct {
+		name         string
+		schedules    []pharev1beta1.ReplicaSchedule
+		override     *pharev1beta1.ScaleOverride
+		now          time.Time
+		wantActive   string
+		wantReplicas int32
+		wantNext     time.Time
+	}{
+		{name: "day", schedules: nightly, now: at(1, 12), wantActive: "day", wantReplicas: 3, wantNext: at(1, 20)},
+		{name: "night", schedules: nightly, now: at(1, 22), wantActive: "night", wantReplicas: 0, wantNext: at(2, 7)},
+		// Saturday morning: the day schedule does not fire on weekends.
+		{name: "weekend", schedules: nightly, now: at(3, 12), wantActive: "night", wantReplicas: 0, wantNext: at(3, 20)},
+		{name: "override", schedules: nightly, now: at(1, 12), wantActive: scaleOverrideName, wantReplicas: 10, wantNext: at(1, 18),
+			override: &pharev1beta1.ScaleOverride{Replicas: 10, Until: metav1.NewTime(at(1, 18))}},
+		{name: "expired override", schedules: nightly, now: at(1, 19), wantActive: "day", wantReplicas: 3, wantNext: at(1, 20),
+			override: &pharev1beta1.ScaleOverride{Replicas: 10, Until: metav1.NewTime(at(1, 18))}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			phare := basePhare("demo", "default")
+			phare.Spec.MicroService.ReplicaCount = 2
+			phare.Spec.Schedules = tc.schedules
+			phare.Spec.ScaleOverride = tc.override
+			r := &PhareReconciler{Recorder: record.NewFakeRecorder(10)}
+
+			if err := r.resolveReplicas(phare, tc.now); err != nil {
+				t.Fatalf("resolveReplicas: %v", err)
+			}
+			st := phare.Status.Scaling
+			if st == nil || st.Active != tc.wantActive {
+				t.Fatalf("expected %q to be active, got %+v", tc.wantActive, st)
+			}
+			if phare.Spec.MicroService.ReplicaCount != tc.wantReplicas {
+				t.Fatalf("expected %d replicas, got %d", tc.wantReplicas, phare.Spec.MicroService.ReplicaCount)
+			}
+			if st.NextTransition == nil || !st.NextTransition.Time.Equal(tc.wantNext) {
+				t.Fatalf("expected next transition at %v, got %v", tc.wantNext, st.NextTransition)
+			}
+		})
+	}
+}
+
+func TestScaleOverrideScalesWorkloadAndRequeues(t *testing.T) {
+	phare := basePhare("demo", "default")
+	phare.Spec.ScaleOverride = &pharev1beta1.ScaleOverride{
+		Replicas: 5,
+		Until:    metav1.NewTime(time.Now().Add(time.Hour)),
+	}
+	f := newReconcileFixture(t, phare)
+	f.reconcile()
+	// Without rollout polling the override expiry is the only requeue.
+	f.setAvailable("demo", true)
+
+	result, err := f.r.Reconcile(f.ctx, f.req)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if result.RequeueAfter <= 50*time.Minute || result.RequeueAfter > time.Hour {
+		t.Fatalf("expected a requeue when the override expires, got %v", result.RequeueAfter)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: "demo", Namespace: "default"}, deployment); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if *deployment.Spec.Replicas != 5 {
+		t.Fatalf("expected the override to set 5 replicas, got %d", *deployment.Spec.Replicas)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.ScaleOverride.Until = metav1.NewTime(time.Now().Add(-time.Minute)) })
+	got := f.reconcile()
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: "demo", Namespace: "default"}, deployment); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if *deployment.Spec.Replicas != 1 {
+		t.Fatalf("expected the expired override to restore 1 replica, got %d", *deployment.Spec.Replicas)
+	}
+	if got.Status.Scaling == nil || got.Status.Scaling.Active != "" {
+		t.Fatalf("expected no active schedule, got %+v", got.Status.Scaling)
+	}
+	if got.Spec.MicroService.ReplicaCount != 1 {
+		t.Fatalf("expected spec.microservice.replicaCount to be left unchanged, got %d", got.Spec.MicroService.ReplicaCount)
+	}
+}
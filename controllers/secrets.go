@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	"github.com/localcorp/phare-controller/pkg/seal"
+)
+
+const (
+	secretsVolumeName      = "secrets-volume"
+	secretsVolumeMountPath = "/etc/phare/secrets"
+
+	// secretsChecksumAnnotation is the hash of spec.toolchain.secrets, as
+	// written in the spec, so that the pods are rolled when a secret changes
+	// without hashing the decrypted values.
+	secretsChecksumAnnotation = "checksum/secrets"
+)
+
+// secretsName returns the name of the Secret of spec.toolchain.secrets.
+func secretsName(phare *pharev1beta1.Phare) string {
+	return phare.Name + "-secrets"
+}
+
+func phareSecrets(phare *pharev1beta1.Phare) map[string]string {
+	if phare.Spec.ToolChain == nil {
+		return nil
+	}
+	return phare.Spec.ToolChain.Secrets
+}
+
+// reconcileSecrets creates, updates or deletes the <name>-secrets Secret of
+// spec.toolchain.secrets. Sealed values are decrypted with the keys of the
+// EncryptionKeys Secret; a value that cannot be decrypted leaves the Secret
+// as it was.
+func (r *PhareReconciler) reconcileSecrets(ctx context.Context, phare *pharev1beta1.Phare) error {
+	existing := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Name: secretsName(phare), Namespace: phare.Namespace}, existing)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	found := err == nil
+
+	secrets := phareSecrets(phare)
+	if len(secrets) == 0 {
+		if found && metav1.IsControlledBy(existing, phare) {
+			if err := r.Delete(ctx, existing); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			r.Recorder.Eventf(phare, corev1.EventTypeNormal, "DeletedResource", "Deleted Secret %s", existing.Name)
+		}
+		return nil
+	}
+
+	data, err := r.decryptSecrets(ctx, phare, secrets)
+	if err != nil {
+		r.Recorder.Eventf(phare, corev1.EventTypeWarning, "DecryptionFailed", "%v", err)
+		return err
+	}
+	desired := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        secretsName(phare),
+			Namespace:   phare.Namespace,
+			Labels:      childLabels(phare, pharev1beta1.PropagationTargetSecret),
+			Annotations: childAnnotations(phare, pharev1beta1.PropagationTargetSecret),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+	if err := ctrl.SetControllerReference(phare, desired, r.Scheme); err != nil {
+		return fmt.Errorf("failed to set controller reference for Secret %s/%s: %w", desired.Namespace, desired.Name, err)
+	}
+
+	if !found {
+		if err := r.Create(ctx, desired); err != nil {
+			return err
+		}
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "CreatedResource", "Created Secret %s", desired.Name)
+		return nil
+	}
+	if secretDataEqual(existing.Data, desired.Data) &&
+		stringMapsEqualNilEmpty(existing.Labels, desired.Labels) &&
+		stringMapsEqualNilEmpty(existing.Annotations, desired.Annotations) {
+		return nil
+	}
+	existing.Data = desired.Data
+	existing.Labels = copyStringMapPreserveNil(desired.Labels)
+	existing.Annotations = copyStringMapPreserveNil(desired.Annotations)
+	if err := r.Update(ctx, existing); err != nil {
+		return err
+	}
+	r.Recorder.Eventf(phare, corev1.EventTypeNormal, "UpdatedResource", "Updated Secret %s", desired.Name)
+	return nil
+}
+
+// decryptSecrets returns the data of the Secret of secrets. Sealed values
+// must be sealed for phare. The decryption keys are only read when a value is
+// sealed.
+func (r *PhareReconciler) decryptSecrets(ctx context.Context, phare *pharev1beta1.Phare, secrets map[string]string) (map[string][]byte, error) {
+	var keys map[string][]byte
+	data := make(map[string][]byte, len(secrets))
+	for _, k := range sortedKeys(secrets) {
+		value := secrets[k]
+		if !seal.IsSealed(value) {
+			data[k] = []byte(value)
+			continue
+		}
+		if keys == nil {
+			var err error
+			if keys, err = r.decryptionKeys(ctx); err != nil {
+				return nil, err
+			}
+		}
+		plaintext, err := seal.Open(value, seal.Scope{Namespace: phare.Namespace, Name: phare.Name}, keys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt spec.toolchain.secrets[%s]: %w", k, err)
+		}
+		data[k] = plaintext
+	}
+	return data, nil
+}
+
+// decryptionKeys reads the keys of the EncryptionKeys Secret, by key id.
+func (r *PhareReconciler) decryptionKeys(ctx context.Context) (map[string][]byte, error) {
+	if r.EncryptionKeys.Name == "" {
+		return nil, fmt.Errorf("no encryption keys Secret is configured to decrypt sealed values")
+	}
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, r.EncryptionKeys, secret); err != nil {
+		return nil, fmt.Errorf("failed to read the encryption keys Secret %s: %w", r.EncryptionKeys, err)
+	}
+	keys := make(map[string][]byte, len(secret.Data))
+	for id, data := range secret.Data {
+		key, err := seal.ParseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s of the encryption keys Secret %s: %w", id, r.EncryptionKeys, err)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// addSecretsVolume mounts the Secret of spec.toolchain.secrets at
+// /etc/phare/secrets in the main container.
+func addSecretsVolume(phare *pharev1beta1.Phare, template *corev1.PodTemplateSpec) {
+	if len(phareSecrets(phare)) == 0 {
+		return
+	}
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name: secretsVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName:  secretsName(phare),
+				DefaultMode: pointer.Int32(420),
+				Optional:    pointer.Bool(false),
+			},
+		},
+	})
+	template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      secretsVolumeName,
+		MountPath: secretsVolumeMountPath,
+		ReadOnly:  true,
+	})
+}
+
+// setSecretsChecksum sets the secretsChecksumAnnotation of the pod template.
+func setSecretsChecksum(phare *pharev1beta1.Phare, template *corev1.PodTemplateSpec) {
+	secrets := phareSecrets(phare)
+	if len(secrets) == 0 {
+		return
+	}
+	if template.Annotations == nil {
+		template.Annotations = make(map[string]string)
+	}
+	template.Annotations[secretsChecksumAnnotation] = configDataHash(secrets)
+}
+
+func secretDataEqual(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || string(v) != string(w) {
+			return false
+		}
+	}
+	return true
+}
+
+// encryptionKeysToPhares maps the EncryptionKeys Secret to the Phares with
+// sealed secrets, so that they are decrypted again once a key is added.
+func (r *PhareReconciler) encryptionKeysToPhares(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetName() != r.EncryptionKeys.Name || obj.GetNamespace() != r.EncryptionKeys.Namespace {
+		return nil
+	}
+	phares := &pharev1beta1.PhareList{}
+	if err := r.List(ctx, phares); err != nil {
+		r.Log.Error(err, "Failed to list Phares for the encryption keys Secret")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, phare := range phares.Items {
+		for _, value := range phareSecrets(&phare) {
+			if seal.IsSealed(value) {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&phare)})
+				break
+			}
+		}
+	}
+	return requests
+}
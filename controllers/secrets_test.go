@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	"github.com/localcorp/phare-controller/pkg/seal"
+)
+
+func sealed(t *testing.T, value, namespace, keyID string, key []byte) string {
+	t.Helper()
+	s, err := seal.Seal([]byte(value), seal.Scope{Namespace: namespace, Name: "api"}, keyID, key)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	return s
+}
+
+func TestSealedSecretsDecryptedIntoChildSecret(t *testing.T) {
+	oldKey, newKey := bytes.Repeat([]byte{1}, seal.KeySize), bytes.Repeat([]byte{2}, seal.KeySize)
+	phare := basePhare("api", "default")
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{Secrets: map[string]string{
+		"db-password": sealed(t, "s3cret", "default", "2025", oldKey),
+		"plain":       "visible",
+	}}
+	f := newReconcileFixture(t, phare)
+	f.r.EncryptionKeys = types.NamespacedName{Namespace: "phare-system", Name: "phare-encryption-keys"}
+	keys := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "phare-encryption-keys", Namespace: "phare-system"},
+		Data:       map[string][]byte{"2025": oldKey},
+	}
+	if err := f.r.Create(f.ctx, keys); err != nil {
+		t.Fatalf("create keys: %v", err)
+	}
+	f.reconcile()
+
+	secret := &corev1.Secret{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-secrets", Namespace: "default"}, secret); err != nil {
+		t.Fatalf("get secret: %v", err)
+	}
+	if string(secret.Data["db-password"]) != "s3cret" || string(secret.Data["plain"]) != "visible" {
+		t.Fatalf("unexpected secret data %v", secret.Data)
+	}
+	deploy := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api", Namespace: "default"}, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if mount := mountOf(deploy.Spec.Template.Spec.Containers[0], secretsVolumeName); mount == nil || mount.MountPath != "/etc/phare/secrets" {
+		t.Fatalf("expected the secrets to be mounted, got %+v", deploy.Spec.Template.Spec.Containers[0].VolumeMounts)
+	}
+	checksum := deploy.Spec.Template.Annotations[secretsChecksumAnnotation]
+	if checksum == "" {
+		t.Fatalf("expected the %s annotation", secretsChecksumAnnotation)
+	}
+
+	// A value sealed for a Phare of another namespace cannot be opened.
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.ToolChain.Secrets["db-password"] = sealed(t, "stolen", "other", "2025", oldKey)
+	})
+	if _, err := f.r.Reconcile(f.ctx, f.req); err == nil || !strings.Contains(err.Error(), `cannot decrypt with key "2025" for default/api: message authentication failed`) {
+		t.Fatalf("expected the value of another namespace to fail, got %v", err)
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-secrets", Namespace: "default"}, secret); err != nil || string(secret.Data["db-password"]) != "s3cret" {
+		t.Fatalf("expected the Secret to be left as it was, got %v, %v", secret.Data, err)
+	}
+
+	// A value sealed with a key the controller does not have leaves the
+	// Secret as it was.
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.ToolChain.Secrets["db-password"] = sealed(t, "rotated", "default", "2026", newKey)
+	})
+	if _, err := f.r.Reconcile(f.ctx, f.req); err == nil || !strings.Contains(err.Error(), `spec.toolchain.secrets[db-password]: unknown key id "2026"`) {
+		t.Fatalf("expected the unknown key to fail, got %v", err)
+	}
+	if !hasEvent(f.r.Recorder.(*record.FakeRecorder), "Warning DecryptionFailed") {
+		t.Fatalf("expected a Warning DecryptionFailed event")
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-secrets", Namespace: "default"}, secret); err != nil || string(secret.Data["db-password"]) != "s3cret" {
+		t.Fatalf("expected the Secret to be left as it was, got %v, %v", secret.Data, err)
+	}
+
+	// Both keys are active during the rotation.
+	keys.Data["2026"] = newKey
+	if err := f.r.Update(f.ctx, keys); err != nil {
+		t.Fatalf("update keys: %v", err)
+	}
+	f.reconcile()
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-secrets", Namespace: "default"}, secret); err != nil || string(secret.Data["db-password"]) != "rotated" {
+		t.Fatalf("expected the rotated value, got %v, %v", secret.Data, err)
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api", Namespace: "default"}, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if deploy.Spec.Template.Annotations[secretsChecksumAnnotation] == checksum {
+		t.Fatalf("expected the pods to be rolled when a secret changes")
+	}
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.ToolChain.Secrets = nil
+	})
+	f.reconcile()
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-secrets", Namespace: "default"}, &corev1.Secret{}); err == nil {
+		t.Fatalf("expected the Secret to be deleted with spec.toolchain.secrets")
+	}
+}
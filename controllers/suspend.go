@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/pointer"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// pausedAnnotation pauses reconciliation like spec.paused, without a spec change.
+const pausedAnnotation = "phare.localcorp.internal/paused"
+
+func isPaused(phare *pharev1beta1.Phare) bool {
+	return phare.Spec.Paused || annotationEnabled(phare, pausedAnnotation)
+}
+
+// annotationEnabled reports whether the Phare annotation key holds a truthy value.
+func annotationEnabled(phare *pharev1beta1.Phare, key string) bool {
+	if phare == nil {
+		return false
+	}
+	v, ok := phare.Annotations[key]
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "yes", "on":
+		return true
+	default:
+		return false
+	}
+}
+
+// workloadReplicas returns the replica count for the Deployment or StatefulSet:
+// zero while suspended, the remembered count after resuming until the spec
+// or the scheduled replica count changes, and spec.microservice.replicaCount
+// otherwise.
+func workloadReplicas(phare *pharev1beta1.Phare) *int32 {
+	switch {
+	case phare.Spec.Suspend:
+		return pointer.Int32(0)
+	case restoresSuspendedReplicas(phare):
+		return pointer.Int32(*phare.Status.SuspendedReplicas)
+	default:
+		return pointer.Int32(phare.Spec.MicroService.ReplicaCount)
+	}
+}
+
+// restoresSuspendedReplicas reports whether the remembered replica count
+// still applies: spec.microservice.replicaCount, after scheduled scaling, is
+// the one the Phare was suspended with, and the spec did not change since
+// the resume.
+func restoresSuspendedReplicas(phare *pharev1beta1.Phare) bool {
+	st := phare.Status
+	if st.SuspendedReplicas == nil {
+		return false
+	}
+	if st.SuspendedReplicaCount != nil && *st.SuspendedReplicaCount != phare.Spec.MicroService.ReplicaCount {
+		return false
+	}
+	return st.ResumedGeneration == nil || *st.ResumedGeneration == phare.Generation
+}
+
+// recordSuspension remembers the current workload replica count in status the
+// first time a suspended Phare is reconciled. A count kept from an earlier
+// resume is replaced.
+func (r *PhareReconciler) recordSuspension(ctx context.Context, phare *pharev1beta1.Phare) error {
+	if !phare.Spec.Suspend || (phare.Status.SuspendedReplicas != nil && phare.Status.ResumedGeneration == nil) {
+		return nil
+	}
+
+	replicas := phare.Spec.MicroService.ReplicaCount
+	key := client.ObjectKey{Name: workloadName(phare), Namespace: phare.Namespace}
+	var current *int32
+	switch phare.Spec.MicroService.Kind {
+	case "Deployment":
+		d := &appsv1.Deployment{}
+		if err := r.Get(ctx, key, d); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		current = d.Spec.Replicas
+	case "StatefulSet":
+		ss := &appsv1.StatefulSet{}
+		if err := r.Get(ctx, key, ss); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		current = ss.Spec.Replicas
+	}
+	if current != nil && *current > 0 {
+		replicas = *current
+	}
+
+	phare.Status.SuspendedReplicas = pointer.Int32(replicas)
+	phare.Status.SuspendedReplicaCount = pointer.Int32(phare.Spec.MicroService.ReplicaCount)
+	phare.Status.ResumedGeneration = nil
+	r.Recorder.Eventf(phare, corev1.EventTypeNormal, "Suspended", "Scaling workload to zero; %d replicas will be restored on resume", replicas)
+	return nil
+}
+
+// finishResume records the generation the workload was resumed at, and
+// forgets the remembered replica count once it no longer applies.
+func (r *PhareReconciler) finishResume(phare *pharev1beta1.Phare) {
+	st := &phare.Status
+	if phare.Spec.Suspend || st.SuspendedReplicas == nil {
+		return
+	}
+	if st.ResumedGeneration == nil {
+		r.Recorder.Eventf(phare, corev1.EventTypeNormal, "Resumed", "Restored %d replicas", *workloadReplicas(phare))
+		st.ResumedGeneration = pointer.Int64(phare.Generation)
+	}
+	if !restoresSuspendedReplicas(phare) {
+		st.SuspendedReplicas = nil
+		st.SuspendedReplicaCount = nil
+		st.ResumedGeneration = nil
+	}
+}
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/pointer"
+	ctrl "sigs.k8s.io/controller-runtime"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+func TestReconcilePausedSkipsMutations(t *testing.T) {
+	scheme := testScheme(t)
+	old := basePhare("demo", "default")
+
+	builder := &PhareReconciler{Scheme: scheme}
+	existing := builder.newDeployment(old)
+	if existing == nil {
+		t.Fatalf("expected existing deployment")
+	}
+
+	updated := old.DeepCopy()
+	updated.Spec.MicroService.ReplicaCount = 3
+	updated.Annotations = map[string]string{pausedAnnotation: "true"}
+
+	r := newTestReconciler(t, scheme, updated, existing)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: updated.Name, Namespace: updated.Namespace}}
+	ctx := context.Background()
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile paused phare: %v", err)
+	}
+
+	current := &appsv1.Deployment{}
+	if err := r.Get(ctx, req.NamespacedName, current); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if *current.Spec.Replicas != 1 {
+		t.Fatalf("expected paused phare to leave replicas at 1, got %d", *current.Spec.Replicas)
+	}
+
+	phare := &pharev1beta1.Phare{}
+	if err := r.Get(ctx, req.NamespacedName, phare); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	if phare.Status.Phase != pharev1beta1.PharePhasePaused {
+		t.Fatalf("expected phase Paused, got %q", phare.Status.Phase)
+	}
+}
+
+func TestReconcileSuspendScalesToZeroAndRestores(t *testing.T) {
+	scheme := testScheme(t)
+	phare := basePhare("demo", "default")
+	phare.Spec.MicroService.ReplicaCount = 2
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{
+		HTTPRoute: &pharev1beta1.HTTPRouteSpec{Hostnames: []gatewayv1beta1.Hostname{"demo.example.com"}},
+	}
+
+	r := newTestReconciler(t, scheme, phare)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: phare.Name, Namespace: phare.Namespace}}
+	ctx := context.Background()
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("initial reconcile: %v", err)
+	}
+
+	if err := r.Get(ctx, req.NamespacedName, phare); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	phare.Spec.Suspend = true
+	phare.Spec.SuspendPolicy = &pharev1beta1.SuspendPolicy{RemoveHTTPRoute: true}
+	if err := r.Update(ctx, phare); err != nil {
+		t.Fatalf("suspend phare: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("suspend reconcile: %v", err)
+	}
+
+	deploy := &appsv1.Deployment{}
+	if err := r.Get(ctx, req.NamespacedName, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if *deploy.Spec.Replicas != 0 {
+		t.Fatalf("expected suspended deployment to have 0 replicas, got %d", *deploy.Spec.Replicas)
+	}
+	if err := r.Get(ctx, req.NamespacedName, &gatewayv1beta1.HTTPRoute{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected HTTPRoute to be removed while suspended, got %v", err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, phare); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	if phare.Status.Phase != pharev1beta1.PharePhaseSuspended {
+		t.Fatalf("expected phase Suspended, got %q", phare.Status.Phase)
+	}
+	if phare.Status.SuspendedReplicas == nil || *phare.Status.SuspendedReplicas != 2 {
+		t.Fatalf("expected 2 suspended replicas in status, got %v", phare.Status.SuspendedReplicas)
+	}
+
+	phare.Spec.Suspend = false
+	if err := r.Update(ctx, phare); err != nil {
+		t.Fatalf("resume phare: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("resume reconcile: %v", err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if *deploy.Spec.Replicas != 2 {
+		t.Fatalf("expected 2 replicas after resume, got %d", *deploy.Spec.Replicas)
+	}
+	if err := r.Get(ctx, req.NamespacedName, &gatewayv1beta1.HTTPRoute{}); err != nil {
+		t.Fatalf("expected HTTPRoute to be recreated after resume: %v", err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, phare); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	if phare.Status.ResumedGeneration == nil {
+		t.Fatalf("expected the resume to be recorded in status")
+	}
+}
+
+func TestResumeKeepsRestoredReplicasUntilSpecChanges(t *testing.T) {
+	phare := basePhare("demo", "default")
+	phare.Spec.MicroService.ReplicaCount = 2
+	f := newReconcileFixture(t, phare)
+	f.reconcile()
+
+	deploy := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	deploy.Spec.Replicas = pointer.Int32(5)
+	if err := f.r.Update(f.ctx, deploy); err != nil {
+		t.Fatalf("scale deployment: %v", err)
+	}
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.Suspend = true })
+	f.reconcile()
+
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.Suspend = false })
+	for i := 0; i < 2; i++ {
+		f.reconcile()
+		if err := f.r.Get(f.ctx, f.req.NamespacedName, deploy); err != nil {
+			t.Fatalf("get deployment: %v", err)
+		}
+		if *deploy.Spec.Replicas != 5 {
+			t.Fatalf("pass %d: expected the 5 replicas from before the suspension, got %d", i, *deploy.Spec.Replicas)
+		}
+	}
+
+	// The fake client does not bump the generation on spec changes.
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.MicroService.Image.Tag = "1.26"
+		p.Generation++
+	})
+	phare = f.reconcile()
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if *deploy.Spec.Replicas != 2 {
+		t.Fatalf("expected spec.microservice.replicaCount after a spec change, got %d", *deploy.Spec.Replicas)
+	}
+	if phare.Status.SuspendedReplicas != nil || phare.Status.ResumedGeneration != nil {
+		t.Fatalf("expected the restored count to be forgotten, got %v", phare.Status.SuspendedReplicas)
+	}
+}
+
+func TestResumePrefersReplicaCountChangedWhileSuspended(t *testing.T) {
+	phare := basePhare("demo", "default")
+	phare.Spec.MicroService.ReplicaCount = 2
+	f := newReconcileFixture(t, phare)
+	f.reconcile()
+
+	// Scaled outside the Phare, e.g. by hand, before the suspension.
+	deploy := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	deploy.Spec.Replicas = pointer.Int32(5)
+	if err := f.r.Update(f.ctx, deploy); err != nil {
+		t.Fatalf("scale deployment: %v", err)
+	}
+	f.update(func(p *pharev1beta1.Phare) { p.Spec.Suspend = true })
+	f.reconcile()
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.Suspend = false
+		p.Spec.MicroService.ReplicaCount = 3
+	})
+	for i := 0; i < 2; i++ {
+		f.reconcile()
+		if err := f.r.Get(f.ctx, f.req.NamespacedName, deploy); err != nil {
+			t.Fatalf("get deployment: %v", err)
+		}
+		if *deploy.Spec.Replicas != 3 {
+			t.Fatalf("pass %d: expected the replica count set while suspended, got %d", i, *deploy.Spec.Replicas)
+		}
+	}
+}
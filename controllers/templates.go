@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	tpl "github.com/localcorp/phare-controller/pkg/go-templates"
+)
+
+// templateRenderer returns the renderer of the templates of phare. include
+// resolves spec.toolchain.config keys.
+func (r *PhareReconciler) templateRenderer(ctx context.Context, phare *pharev1beta1.Phare) (*tpl.Renderer, error) {
+	namespace := &corev1.Namespace{}
+	if err := r.Get(ctx, client.ObjectKey{Name: phare.Namespace}, namespace); err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	data := tpl.NewContext(phare, namespace.Labels, tpl.Cluster{Name: r.ClusterName, Domain: r.clusterDomain()})
+
+	strict := phare.Spec.Templates != nil && phare.Spec.Templates.Strict
+	var includes map[string]string
+	if phare.Spec.ToolChain != nil {
+		includes = phare.Spec.ToolChain.Config
+	}
+	return tpl.NewRenderer(data, strict, includes), nil
+}
+
+// renderTemplates renders, in memory, the templates in the pod annotations,
+// the probe paths, the HTTPRoute hostnames and the canary analysis queries of
+// phare, and in the env values and args of the containers with
+// spec.templates.containers. Config values
+// are rendered into the managed ConfigMap by generateConfigMap. Errors
+// rendering a template are *tpl.RenderError.
+func (r *PhareReconciler) renderTemplates(ctx context.Context, phare *pharev1beta1.Phare) error {
+	renderer, err := r.templateRenderer(ctx, phare)
+	if err != nil {
+		return err
+	}
+	render := func(path, key string, value *string) error {
+		out, err := renderer.RenderField(path, key, *value)
+		if err != nil {
+			return err
+		}
+		*value = out
+		return nil
+	}
+
+	ms := &phare.Spec.MicroService
+	if phare.Spec.Templates != nil && phare.Spec.Templates.Containers {
+		if err := renderContainer(render, "spec.microservice", ms.Env, ms.Args); err != nil {
+			return err
+		}
+		for i := range ms.ExtraContainers {
+			c := &ms.ExtraContainers[i]
+			if err := renderContainer(render, fmt.Sprintf("spec.microservice.extraContainers[%d]", i), c.Env, c.Args); err != nil {
+				return err
+			}
+		}
+		for i := range ms.InitContainers {
+			c := &ms.InitContainers[i]
+			if err := renderContainer(render, fmt.Sprintf("spec.microservice.initContainers[%d]", i), c.Env, c.Args); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(ms.PodAnnotations) {
+		value := ms.PodAnnotations[key]
+		if err := render("spec.microservice.podAnnotations", key, &value); err != nil {
+			return err
+		}
+		ms.PodAnnotations[key] = value
+	}
+
+	for _, probe := range []struct {
+		name  string
+		probe *corev1.Probe
+	}{
+		{"livenessProbe", ms.LivenessProbe},
+		{"readinessProbe", ms.ReadinessProbe},
+		{"startupProbe", ms.StartupProbe},
+	} {
+		if probe.probe == nil || probe.probe.HTTPGet == nil {
+			continue
+		}
+		if err := render("spec.microservice."+probe.name+".httpGet.path", "", &probe.probe.HTTPGet.Path); err != nil {
+			return err
+		}
+	}
+
+	if phare.Spec.ToolChain != nil && phare.Spec.ToolChain.HTTPRoute != nil {
+		hostnames := phare.Spec.ToolChain.HTTPRoute.Hostnames
+		for i := range hostnames {
+			hostname := string(hostnames[i])
+			if err := render(fmt.Sprintf("spec.toolchain.httpRoute.hostnames[%d]", i), "", &hostname); err != nil {
+				return err
+			}
+			hostnames[i] = gatewayv1beta1.Hostname(hostname)
+		}
+	}
+
+	if phare.Spec.Canary != nil && phare.Spec.Canary.Analysis != nil {
+		metrics := phare.Spec.Canary.Analysis.Metrics
+		for i := range metrics {
+			if err := render(fmt.Sprintf("spec.canary.analysis.metrics[%d].query", i), metrics[i].Name, &metrics[i].Query); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderContainer renders the env values and args of a container.
+func renderContainer(render func(path, key string, value *string) error, path string, env []corev1.EnvVar, args []string) error {
+	for i := range env {
+		if err := render(fmt.Sprintf("%s.env[%d].value", path, i), env[i].Name, &env[i].Value); err != nil {
+			return err
+		}
+	}
+	for i := range args {
+		if err := render(fmt.Sprintf("%s.args[%d]", path, i), "", &args[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordTemplateRender sets the TemplateRenderFailed condition from the
+// result of rendering the templates of phare, and emits a Warning event when
+// a template starts failing. err is returned unchanged.
+func (r *PhareReconciler) recordTemplateRender(phare *pharev1beta1.Phare, err error) error {
+	var renderErr *tpl.RenderError
+	switch {
+	case errors.As(err, &renderErr):
+		message := renderErr.Error()
+		if c := apimeta.FindStatusCondition(phare.Status.Conditions, pharev1beta1.ConditionTemplateRenderFailed); c == nil || c.Status != metav1.ConditionTrue || c.Message != message {
+			r.Recorder.Event(phare, corev1.EventTypeWarning, "TemplateRenderFailed", message)
+		}
+		apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+			Type:    pharev1beta1.ConditionTemplateRenderFailed,
+			Status:  metav1.ConditionTrue,
+			Reason:  pharev1beta1.ReasonRenderFailed,
+			Message: message,
+		})
+	case err == nil && apimeta.FindStatusCondition(phare.Status.Conditions, pharev1beta1.ConditionTemplateRenderFailed) != nil:
+		apimeta.SetStatusCondition(&phare.Status.Conditions, metav1.Condition{
+			Type:    pharev1beta1.ConditionTemplateRenderFailed,
+			Status:  metav1.ConditionFalse,
+			Reason:  pharev1beta1.ReasonRendered,
+			Message: "All templates rendered",
+		})
+	}
+	return err
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	tpl "github.com/localcorp/phare-controller/pkg/go-templates"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+func TestRenderTemplatesAcrossSpec(t *testing.T) {
+	phare := basePhare("api", "default")
+	phare.Labels = map[string]string{"team": "core"}
+	phare.Spec.Templates = &pharev1beta1.TemplatesSpec{Containers: true}
+	phare.Spec.MicroService.Env = []corev1.EnvVar{{Name: "REGION", Value: "{{ .NamespaceLabels.region }}"}}
+	phare.Spec.MicroService.Args = []string{"--name={{ .Name }}", `--cluster={{ .Cluster.Name | default "local" }}`}
+	phare.Spec.MicroService.PodAnnotations = map[string]string{"owner": "{{ .Labels.team }}"}
+	phare.Spec.MicroService.ReadinessProbe = &corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+		HTTPGet: &corev1.HTTPGetAction{Path: "/{{ .Name }}/ready", Port: intstr.FromInt(80)},
+	}}
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{
+		Config:    pharev1beta1.ConfigSpec{"app.yaml": "tag: {{ .Spec.MicroService.Image.Tag }}", "all.yaml": `{{ include "app.yaml" }}`},
+		HTTPRoute: &pharev1beta1.HTTPRouteSpec{Hostnames: []gatewayv1beta1.Hostname{"{{ .Name }}.{{ .NamespaceLabels.region }}.example.com"}},
+	}
+	f := newReconcileFixture(t, phare)
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"region": "eu"}}}
+	if err := f.r.Create(f.ctx, namespace); err != nil {
+		t.Fatalf("create namespace: %v", err)
+	}
+
+	got := f.reconcile()
+	if got.Spec.MicroService.Env[0].Value != "{{ .NamespaceLabels.region }}" {
+		t.Fatalf("expected the stored spec to keep its templates, got %q", got.Spec.MicroService.Env[0].Value)
+	}
+
+	deploy := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api", Namespace: "default"}, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	container := deploy.Spec.Template.Spec.Containers[0]
+	if container.Env[0].Value != "eu" {
+		t.Fatalf("expected the env value to be rendered, got %q", container.Env[0].Value)
+	}
+	if container.Args[0] != "--name=api" || container.Args[1] != "--cluster=local" {
+		t.Fatalf("expected the args to be rendered, got %v", container.Args)
+	}
+	if container.ReadinessProbe.HTTPGet.Path != "/api/ready" {
+		t.Fatalf("expected the readiness path to be rendered, got %q", container.ReadinessProbe.HTTPGet.Path)
+	}
+	if deploy.Spec.Template.Annotations["owner"] != "core" {
+		t.Fatalf("expected the pod annotation to be rendered, got %v", deploy.Spec.Template.Annotations)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-config", Namespace: "default"}, cm); err != nil {
+		t.Fatalf("get configmap: %v", err)
+	}
+	if cm.Data["app.yaml"] != "tag: latest" || cm.Data["all.yaml"] != "tag: latest" {
+		t.Fatalf("expected the config values to be rendered, got %v", cm.Data)
+	}
+
+	route := &gatewayv1beta1.HTTPRoute{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api", Namespace: "default"}, route); err != nil {
+		t.Fatalf("get httproute: %v", err)
+	}
+	if len(route.Spec.Hostnames) != 1 || route.Spec.Hostnames[0] != "api.eu.example.com" {
+		t.Fatalf("expected the hostname to be rendered, got %v", route.Spec.Hostnames)
+	}
+}
+
+func TestRenderTemplatesStrictMode(t *testing.T) {
+	phare := basePhare("api", "default")
+	phare.Spec.MicroService.PodAnnotations = map[string]string{"owner": "{{ .Labels.owner }}"}
+	f := newReconcileFixture(t, phare)
+
+	f.reconcile()
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api", Namespace: "default"}, &appsv1.Deployment{}); err != nil {
+		t.Fatalf("expected a missing key to be tolerated by default: %v", err)
+	}
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.Templates = &pharev1beta1.TemplatesSpec{Strict: true}
+	})
+	if _, err := f.r.Reconcile(f.ctx, f.req); err == nil {
+		t.Fatalf("expected a missing key to fail in strict mode")
+	}
+}
+
+func TestTemplateRenderFailureKeepsConfigMap(t *testing.T) {
+	phare := basePhare("api", "default")
+	phare.Spec.ToolChain = &pharev1beta1.ToolChainSpec{Config: pharev1beta1.ConfigSpec{
+		"a.yaml": "name: {{ .Name }}",
+		"b.yaml": "static",
+	}}
+	f := newReconcileFixture(t, phare)
+	f.reconcile()
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.ToolChain.Config = pharev1beta1.ConfigSpec{
+			"a.yaml": "name: {{ .Name }}-v2",
+			"b.yaml": "{{ .Nope }}",
+		}
+	})
+	_, err := f.r.Reconcile(f.ctx, f.req)
+	var renderErr *tpl.RenderError
+	if !errors.As(err, &renderErr) || renderErr.Path != "spec.toolchain.config" || renderErr.Key != "b.yaml" {
+		t.Fatalf("expected a render error of spec.toolchain.config[b.yaml], got %v", err)
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api-config", Namespace: "default"}, cm); err != nil {
+		t.Fatalf("get configmap: %v", err)
+	}
+	if cm.Data["a.yaml"] != "name: api" || cm.Data["b.yaml"] != "static" {
+		t.Fatalf("expected the ConfigMap to be left as it was, got %v", cm.Data)
+	}
+
+	got := &pharev1beta1.Phare{}
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, got); err != nil {
+		t.Fatalf("get phare: %v", err)
+	}
+	c := apimeta.FindStatusCondition(got.Status.Conditions, pharev1beta1.ConditionTemplateRenderFailed)
+	if c == nil || c.Status != metav1.ConditionTrue || !strings.Contains(c.Message, "spec.toolchain.config[b.yaml]") {
+		t.Fatalf("expected TemplateRenderFailed to name the key, got %+v", c)
+	}
+	if !hasEvent(f.r.Recorder.(*record.FakeRecorder), "Warning TemplateRenderFailed") {
+		t.Fatalf("expected a Warning TemplateRenderFailed event")
+	}
+
+	f.update(func(p *pharev1beta1.Phare) {
+		p.Spec.ToolChain.Config["b.yaml"] = "static"
+	})
+	got = f.reconcile()
+	if apimeta.IsStatusConditionTrue(got.Status.Conditions, pharev1beta1.ConditionTemplateRenderFailed) {
+		t.Fatalf("expected TemplateRenderFailed to be False once fixed, got %+v", got.Status.Conditions)
+	}
+}
+
+func TestTemplateRenderFailureNamesEnvVar(t *testing.T) {
+	phare := basePhare("api", "default")
+	phare.Spec.MicroService.Env = []corev1.EnvVar{{Name: "PLAIN", Value: "x"}, {Name: "BROKEN", Value: "{{ .Name "}}
+	phare.Spec.Templates = &pharev1beta1.TemplatesSpec{Containers: true}
+	f := newReconcileFixture(t, phare)
+
+	_, err := f.r.Reconcile(f.ctx, f.req)
+	var renderErr *tpl.RenderError
+	if !errors.As(err, &renderErr) || renderErr.Path != "spec.microservice.env[1].value" || renderErr.Key != "BROKEN" {
+		t.Fatalf("expected a render error of the BROKEN env var, got %v", err)
+	}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api", Namespace: "default"}, &appsv1.Deployment{}); err == nil {
+		t.Fatalf("expected no workload while a template fails")
+	}
+}
+
+// hasEvent drains recorder and reports whether an event starting with prefix
+// was recorded.
+func hasEvent(recorder *record.FakeRecorder, prefix string) bool {
+	found := false
+	for {
+		select {
+		case event := <-recorder.Events:
+			found = found || strings.HasPrefix(event, prefix)
+		default:
+			return found
+		}
+	}
+}
+
+func TestContainerTemplatesNeedOptIn(t *testing.T) {
+	phare := basePhare("api", "default")
+	phare.Spec.MicroService.Env = []corev1.EnvVar{{Name: "GREETING", Value: "Hello {{ .User }}"}}
+	phare.Spec.MicroService.Args = []string{"--format={{ .Name }}"}
+	f := newReconcileFixture(t, phare)
+
+	f.reconcile()
+	deploy := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, client.ObjectKey{Name: "api", Namespace: "default"}, deploy); err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	container := deploy.Spec.Template.Spec.Containers[0]
+	if container.Env[0].Value != "Hello {{ .User }}" || container.Args[0] != "--format={{ .Name }}" {
+		t.Fatalf("expected the env values and args to be passed as they are, got %v and %v", container.Env, container.Args)
+	}
+}
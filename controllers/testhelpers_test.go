@@ -1,11 +1,13 @@
 package controllers
 
 import (
+	"context"
 	"testing"
 
 	"github.com/go-logr/logr"
 	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -14,6 +16,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
@@ -31,6 +34,9 @@ func testScheme(t *testing.T) *runtime.Scheme {
 	if err := appsv1.AddToScheme(scheme); err != nil {
 		t.Fatalf("add apps scheme: %v", err)
 	}
+	if err := batchv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("add batch scheme: %v", err)
+	}
 	if err := gatewayv1beta1.Install(scheme); err != nil {
 		t.Fatalf("add gateway scheme: %v", err)
 	}
@@ -46,7 +52,10 @@ func testScheme(t *testing.T) *runtime.Scheme {
 
 func newTestReconciler(t *testing.T, scheme *runtime.Scheme, objs ...client.Object) *PhareReconciler {
 	t.Helper()
-	builder := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&pharev1beta1.Phare{})
+	builder := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&pharev1beta1.Phare{}).
+		WithIndex(&pharev1beta1.Phare{}, dependsOnIndex, dependsOnIndexValues).
+		WithIndex(&pharev1beta1.Phare{}, phareEnvIndex, phareEnvIndexValues).
+		WithIndex(&pharev1beta1.Phare{}, referencedConfigIndex, referencedConfigIndexValues)
 	if len(objs) > 0 {
 		builder = builder.WithObjects(objs...)
 	}
@@ -59,6 +68,75 @@ func newTestReconciler(t *testing.T, scheme *runtime.Scheme, objs ...client.Obje
 	}
 }
 
+type reconcileFixture struct {
+	t   *testing.T
+	r   *PhareReconciler
+	req ctrl.Request
+	ctx context.Context
+}
+
+func newReconcileFixture(t *testing.T, phare *pharev1beta1.Phare) *reconcileFixture {
+	t.Helper()
+	return &reconcileFixture{
+		t:   t,
+		r:   newTestReconciler(t, testScheme(t), phare),
+		req: ctrl.Request{NamespacedName: types.NamespacedName{Name: phare.Name, Namespace: phare.Namespace}},
+		ctx: context.Background(),
+	}
+}
+
+func (f *reconcileFixture) reconcile() *pharev1beta1.Phare {
+	f.t.Helper()
+	if _, err := f.r.Reconcile(f.ctx, f.req); err != nil {
+		f.t.Fatalf("reconcile: %v", err)
+	}
+	phare := &pharev1beta1.Phare{}
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, phare); err != nil {
+		f.t.Fatalf("get phare: %v", err)
+	}
+	return phare
+}
+
+func (f *reconcileFixture) update(mutate func(*pharev1beta1.Phare)) {
+	f.t.Helper()
+	phare := &pharev1beta1.Phare{}
+	if err := f.r.Get(f.ctx, f.req.NamespacedName, phare); err != nil {
+		f.t.Fatalf("get phare: %v", err)
+	}
+	mutate(phare)
+	if err := f.r.Update(f.ctx, phare); err != nil {
+		f.t.Fatalf("update phare: %v", err)
+	}
+}
+
+// setAvailable fakes the deployment controller, which the fake client lacks.
+func (f *reconcileFixture) setAvailable(name string, available bool) {
+	f.t.Helper()
+	d := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: name, Namespace: f.req.Namespace}, d); err != nil {
+		f.t.Fatalf("get deployment: %v", err)
+	}
+	d.Status.ObservedGeneration = d.Generation
+	d.Status.UpdatedReplicas = 0
+	d.Status.AvailableReplicas = 0
+	if available {
+		d.Status.UpdatedReplicas = *d.Spec.Replicas
+		d.Status.AvailableReplicas = *d.Spec.Replicas
+	}
+	if err := f.r.Status().Update(f.ctx, d); err != nil {
+		f.t.Fatalf("update deployment status: %v", err)
+	}
+}
+
+func (f *reconcileFixture) deploymentImage(name string) string {
+	f.t.Helper()
+	d := &appsv1.Deployment{}
+	if err := f.r.Get(f.ctx, types.NamespacedName{Name: name, Namespace: f.req.Namespace}, d); err != nil {
+		f.t.Fatalf("get deployment: %v", err)
+	}
+	return d.Spec.Template.Spec.Containers[0].Image
+}
+
 func basePhare(name, namespace string) *pharev1beta1.Phare {
 	return &pharev1beta1.Phare{
 		ObjectMeta: metav1.ObjectMeta{
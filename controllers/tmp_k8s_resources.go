@@ -18,7 +18,8 @@ import (
 )
 
 func (r *PhareReconciler) handleHTTPRoute(ctx context.Context, req ctrl.Request, phare pharev1beta1.Phare) error {
-	if phare.Spec.ToolChain != nil && phare.Spec.ToolChain.HTTPRoute != nil {
+	suspendedWithoutRoute := phare.Spec.Suspend && phare.Spec.SuspendPolicy != nil && phare.Spec.SuspendPolicy.RemoveHTTPRoute
+	if phare.Spec.ToolChain != nil && phare.Spec.ToolChain.HTTPRoute != nil && !suspendedWithoutRoute {
 		return r.reconcileHttpRoute(ctx, req, phare)
 	}
 	return r.cleanupHTTPRoute(ctx, phare)
@@ -78,20 +79,54 @@ func (r *PhareReconciler) cleanupHealthCheckPolicy(ctx context.Context, phare ph
 	return nil
 }
 
-func (r *PhareReconciler) reconcileMicroService(ctx context.Context, phare pharev1beta1.Phare) error {
+func (r *PhareReconciler) reconcileMicroService(ctx context.Context, phare *pharev1beta1.Phare) (ctrl.Result, error) {
+	if isBlueGreen(phare) {
+		if podTemplateHeld(phare) {
+			// Both colors keep their pod templates until approved and a window opens.
+			return ctrl.Result{}, nil
+		}
+		return r.reconcileBlueGreen(ctx, phare)
+	}
+	result, err := r.reconcileWorkloadKind(ctx, phare)
+	if err != nil {
+		return result, err
+	}
+	bgResult, err := r.finishBlueGreen(ctx, phare)
+	return mergeResults(result, bgResult), err
+}
+
+// reconcileWorkloadKind reconciles the workload of the kind named in the spec
+// and removes or migrates the workload of the other kind.
+func (r *PhareReconciler) reconcileWorkloadKind(ctx context.Context, phare *pharev1beta1.Phare) (ctrl.Result, error) {
+	var stale client.Object
+	switch phare.Spec.MicroService.Kind {
+	case "Deployment":
+		stale = &appsv1.StatefulSet{}
+	case "StatefulSet":
+		stale = &appsv1.Deployment{}
+	default:
+		return ctrl.Result{}, fmt.Errorf("unsupported kind: %s", phare.Spec.MicroService.Kind)
+	}
+
+	if kindMigrationStrategy(phare) == pharev1beta1.KindMigrationCreateBeforeDelete {
+		return r.migrateWorkloadKind(ctx, phare, stale)
+	}
+
+	// Remove a stale workload left over from a previous Kind value.
+	phare.Status.KindMigration = nil
+	if err := r.deleteIfExists(ctx, stale, phare.Name, phare.Namespace, phare); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.reconcileWorkload(ctx, *phare)
+}
+
+// reconcileWorkload creates or updates the workload of the kind named in the spec.
+func (r *PhareReconciler) reconcileWorkload(ctx context.Context, phare pharev1beta1.Phare) error {
 	switch phare.Spec.MicroService.Kind {
 	case "Deployment":
-		// Remove a stale StatefulSet left over from a previous Kind value.
-		if err := r.deleteIfExists(ctx, &appsv1.StatefulSet{}, phare.Name, phare.Namespace, &phare); err != nil {
-			return err
-		}
 		r.Log.Info("Reconciling Deployment", "Deployment.Namespace", phare.Namespace, "Deployment.Name", phare.Name)
 		return r.reconcileDeployment(ctx, phare)
 	case "StatefulSet":
-		// Remove a stale Deployment left over from a previous Kind value.
-		if err := r.deleteIfExists(ctx, &appsv1.Deployment{}, phare.Name, phare.Namespace, &phare); err != nil {
-			return err
-		}
 		r.Log.Info("Reconciling StatefulSet", "StatefulSet.Namespace", phare.Namespace, "StatefulSet.Name", phare.Name)
 		return r.reconcileStatefulSet(ctx, phare)
 	default:
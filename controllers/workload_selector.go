@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// workloadSelectorLabels returns the selector of the Phare's Deployment or
+// StatefulSet. Selectors are immutable, so it depends only on the Phare identity
+// and never on spec.microservice.podLabels.
+func workloadSelectorLabels(phare *pharev1beta1.Phare) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":     phare.Name,
+		"app.kubernetes.io/instance": phare.Name,
+	}
+}
+
+// workloadPodLabels returns the pod template labels: the child labels, overridden
+// by spec pod labels. The selector labels are applied last so user pod labels can
+// never make the template stop matching the selector.
+func workloadPodLabels(phare *pharev1beta1.Phare) map[string]string {
+	labels := childLabels(phare, pharev1beta1.PropagationTargetPodTemplate)
+	for key, value := range phare.Spec.MicroService.PodLabels {
+		labels[key] = value
+	}
+	for key, value := range workloadSelectorLabels(phare) {
+		labels[key] = value
+	}
+	return labels
+}
+
+// hasStableSelector reports whether selector is the one built by
+// workloadSelectorLabels. Workloads created by older controller versions select
+// on every pod label and need to be recreated.
+func hasStableSelector(selector *metav1.LabelSelector, phare *pharev1beta1.Phare) bool {
+	return equality.Semantic.DeepEqual(selector, &metav1.LabelSelector{MatchLabels: workloadSelectorLabels(phare)})
+}
+
+// orphanWorkload deletes a workload whose selector can no longer be patched,
+// leaving its ReplicaSets or Pods running so traffic is not interrupted. The
+// replacement is created once the deletion finishes.
+func (r *PhareReconciler) orphanWorkload(ctx context.Context, phare *pharev1beta1.Phare, obj client.Object, kind string) error {
+	if err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationOrphan)); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	r.Log.Info("Deleted workload with outdated selector, orphaning its pods", kind+".Namespace", obj.GetNamespace(), kind+".Name", obj.GetName())
+	r.Recorder.Eventf(phare, corev1.EventTypeNormal, "SelectorMigration",
+		"Recreating %s %s to replace its immutable selector; existing pods are kept until the new %s takes over", kind, obj.GetName(), kind)
+	return nil
+}
+
+// labelOrphansForAdoption adds the stable selector labels to objects in list's
+// kind that carry app=<name> but have no controller, typically ReplicaSets or
+// Pods orphaned by orphanWorkload. The new workload then adopts and rolls them
+// instead of running next to them.
+func (r *PhareReconciler) labelOrphansForAdoption(ctx context.Context, phare *pharev1beta1.Phare, list client.ObjectList) error {
+	if err := r.reader().List(ctx, list, client.InNamespace(phare.Namespace), client.MatchingLabels{"app": phare.Name}); err != nil {
+		return err
+	}
+	items, err := apimeta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	selector := workloadSelectorLabels(phare)
+	for _, item := range items {
+		obj, ok := item.(client.Object)
+		if !ok || metav1.GetControllerOf(obj) != nil || !obj.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+		labels := obj.GetLabels()
+		if isSubsetOf(selector, labels) {
+			continue
+		}
+		patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+		obj.SetLabels(mergeStringMaps(labels, selector))
+		if err := r.Patch(ctx, obj, patch); err != nil {
+			if errors.IsNotFound(err) {
+				// The orphan is gone since it was listed.
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// reader returns the uncached reader when one is configured so that listing
+// ReplicaSets and Pods does not start cluster-wide informers.
+func (r *PhareReconciler) reader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+func isSubsetOf(subset, set map[string]string) bool {
+	for key, value := range subset {
+		if v, ok := set[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestWorkloadSelectorExcludesPodLabels(t *testing.T) {
+	scheme := testScheme(t)
+	r := &PhareReconciler{Scheme: scheme}
+	phare := basePhare("demo", "default")
+	phare.Spec.MicroService.PodLabels = map[string]string{
+		"team":                   "payments",
+		"app.kubernetes.io/name": "override",
+	}
+
+	deploy := r.newDeployment(phare)
+	if deploy == nil {
+		t.Fatalf("expected deployment")
+	}
+	want := map[string]string{"app.kubernetes.io/name": "demo", "app.kubernetes.io/instance": "demo"}
+	if !stringMapsEqualNilEmpty(deploy.Spec.Selector.MatchLabels, want) {
+		t.Fatalf("expected stable selector %v, got %v", want, deploy.Spec.Selector.MatchLabels)
+	}
+	labels := deploy.Spec.Template.Labels
+	if labels["team"] != "payments" || labels["app"] != "demo" {
+		t.Fatalf("expected pod labels on the template, got %v", labels)
+	}
+	if labels["app.kubernetes.io/name"] != "demo" {
+		t.Fatalf("expected selector labels to win over pod labels, got %v", labels)
+	}
+
+	phare.Spec.MicroService.Kind = "StatefulSet"
+	ss := r.newStatefulSet(phare)
+	if ss == nil {
+		t.Fatalf("expected statefulset")
+	}
+	if !stringMapsEqualNilEmpty(ss.Spec.Selector.MatchLabels, want) {
+		t.Fatalf("expected stable statefulset selector %v, got %v", want, ss.Spec.Selector.MatchLabels)
+	}
+}
+
+func TestReconcileDeploymentRecreatesLegacySelector(t *testing.T) {
+	scheme := testScheme(t)
+	phare := basePhare("demo", "default")
+
+	builder := &PhareReconciler{Scheme: scheme}
+	legacy := builder.newDeployment(phare)
+	if legacy == nil {
+		t.Fatalf("expected deployment")
+	}
+	legacy.Spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "demo"}}
+	legacy.Spec.Template.Labels = map[string]string{"app": "demo"}
+
+	orphan := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "demo-5d4f",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "demo", "pod-template-hash": "5d4f"},
+		},
+		Spec: appsv1.ReplicaSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "demo", "pod-template-hash": "5d4f"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "demo", "pod-template-hash": "5d4f"}},
+			},
+		},
+	}
+
+	r := newTestReconciler(t, scheme, phare, legacy, orphan)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: phare.Name, Namespace: phare.Namespace}}
+	ctx := context.Background()
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("first reconcile: %v", err)
+	}
+	if err := r.Get(ctx, req.NamespacedName, &appsv1.Deployment{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected legacy deployment to be deleted, got %v", err)
+	}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("second reconcile: %v", err)
+	}
+	current := &appsv1.Deployment{}
+	if err := r.Get(ctx, req.NamespacedName, current); err != nil {
+		t.Fatalf("expected deployment to be recreated: %v", err)
+	}
+	if !hasStableSelector(current.Spec.Selector, phare) {
+		t.Fatalf("expected stable selector, got %v", current.Spec.Selector)
+	}
+
+	rs := &appsv1.ReplicaSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: orphan.Name, Namespace: orphan.Namespace}, rs); err != nil {
+		t.Fatalf("get orphaned replicaset: %v", err)
+	}
+	if !isSubsetOf(workloadSelectorLabels(phare), rs.Labels) {
+		t.Fatalf("expected orphaned replicaset to be labelled for adoption, got %v", rs.Labels)
+	}
+}
+
+func TestLabelOrphansSkipsVanishedOrphans(t *testing.T) {
+	scheme := testScheme(t)
+	phare := basePhare("demo", "default")
+	orphan := func(name string) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{"app": "demo"},
+		}}
+	}
+	// The reader lists an orphan deleted since, sorted before the live one.
+	r := newTestReconciler(t, scheme, phare, orphan("demo-b"))
+	r.APIReader = newTestReconciler(t, scheme, orphan("demo-a"), orphan("demo-b")).Client
+	ctx := context.Background()
+
+	if err := r.labelOrphansForAdoption(ctx, phare, &appsv1.ReplicaSetList{}); err != nil {
+		t.Fatalf("label orphans: %v", err)
+	}
+	rs := &appsv1.ReplicaSet{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "demo-b", Namespace: "default"}, rs); err != nil {
+		t.Fatalf("get replicaset: %v", err)
+	}
+	if !isSubsetOf(workloadSelectorLabels(phare), rs.Labels) {
+		t.Fatalf("expected the orphans after a vanished one to be labelled, got %v", rs.Labels)
+	}
+}
@@ -18,21 +18,30 @@ package main
 
 import (
 	"flag"
+	"net/http"
 	"os"
+	"time"
+	// Embed the time zone database for maintenance windows; the distroless
+	// base image has none.
+	_ "time/tzdata"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
 	"github.com/localcorp/phare-controller/controllers"
+	"github.com/localcorp/phare-controller/pkg/analysis"
+	"github.com/localcorp/phare-controller/pkg/gitsource"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 	//+kubebuilder:scaffold:imports
 )
@@ -55,8 +64,23 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var prometheusAddr string
+	var clusterDomain string
+	var clusterName string
+	var controllerNamespace string
+	var encryptionKeysSecret string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&prometheusAddr, "prometheus-address", "",
+		"Default address of the Prometheus-compatible API used by canary analyses.")
+	flag.StringVar(&clusterDomain, "cluster-domain", "cluster.local",
+		"DNS domain of the cluster, used to build Service addresses.")
+	flag.StringVar(&clusterName, "cluster-name", "",
+		"Name of the cluster, available to templates as {{ .Cluster.Name }}.")
+	flag.StringVar(&controllerNamespace, "controller-namespace", os.Getenv("POD_NAMESPACE"),
+		"Namespace the controller runs in, where the encryption keys Secret is read.")
+	flag.StringVar(&encryptionKeysSecret, "encryption-keys-secret", "phare-encryption-keys",
+		"Name of the Secret holding the keys, by key id, that decrypt sealed spec.toolchain.secrets values.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -70,7 +94,9 @@ func main() {
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
-		// MetricsBindAddress:     metricsAddr, // TODO: enable metrics later
+		Metrics: metricsserver.Options{
+			BindAddress: metricsAddr,
+		},
 		// Port:                   9443,        // TODO: investigate this later
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
@@ -93,10 +119,17 @@ func main() {
 	}
 
 	if err = (&controllers.PhareReconciler{
-		Client:   mgr.GetClient(),
-		Scheme:   mgr.GetScheme(),
-		Log:      ctrl.Log.WithName("controllers").WithName("Phare"),
-		Recorder: mgr.GetEventRecorderFor("phare-controller"),
+		Client:            controllers.NewMetricsClient(mgr.GetClient()),
+		APIReader:         mgr.GetAPIReader(),
+		Scheme:            mgr.GetScheme(),
+		Log:               ctrl.Log.WithName("controllers").WithName("Phare"),
+		Recorder:          mgr.GetEventRecorderFor("phare-controller"),
+		Analysis:          &analysis.Prometheus{Client: &http.Client{Timeout: 10 * time.Second}},
+		PrometheusAddress: prometheusAddr,
+		ClusterDomain:     clusterDomain,
+		ClusterName:       clusterName,
+		GitFetcher:        &gitsource.Git{},
+		EncryptionKeys:    types.NamespacedName{Namespace: controllerNamespace, Name: encryptionKeysSecret},
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Phare")
 		os.Exit(1)
@@ -0,0 +1,93 @@
+// Package analysis evaluates metric queries used to judge canary releases.
+package analysis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Querier runs an instant query against a metrics backend and returns a single value.
+type Querier interface {
+	Query(ctx context.Context, address, query string) (float64, error)
+}
+
+// Prometheus queries the HTTP API of Prometheus or any compatible backend
+// (Thanos, Mimir, VictoriaMetrics...).
+type Prometheus struct {
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+var _ Querier = &Prometheus{}
+
+type queryResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type vectorSample struct {
+	Value [2]interface{} `json:"value"`
+}
+
+// Query runs query through /api/v1/query. The result must be a scalar or a
+// vector with exactly one sample.
+func (p *Prometheus) Query(ctx context.Context, address, query string) (float64, error) {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	endpoint := strings.TrimSuffix(address, "/") + "/api/v1/query?" + url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var body queryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("decode response of %s (HTTP %d): %w", address, resp.StatusCode, err)
+	}
+	if body.Status != "success" {
+		return 0, fmt.Errorf("query %q failed: %s: %s", query, body.ErrorType, body.Error)
+	}
+
+	var sample [2]interface{}
+	switch body.Data.ResultType {
+	case "scalar":
+		if err := json.Unmarshal(body.Data.Result, &sample); err != nil {
+			return 0, err
+		}
+	case "vector":
+		var samples []vectorSample
+		if err := json.Unmarshal(body.Data.Result, &samples); err != nil {
+			return 0, err
+		}
+		if len(samples) != 1 {
+			return 0, fmt.Errorf("query %q returned %d series, expected 1", query, len(samples))
+		}
+		sample = samples[0].Value
+	default:
+		return 0, fmt.Errorf("query %q returned unsupported result type %q", query, body.Data.ResultType)
+	}
+
+	value, ok := sample[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("query %q returned a malformed sample", query)
+	}
+	return strconv.ParseFloat(value, 64)
+}
@@ -0,0 +1,51 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func prometheusStandIn(t *testing.T, results map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		result, ok := results[r.URL.Query().Get("query")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"unknown query"}`)
+			return
+		}
+		fmt.Fprint(w, result)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPrometheusQuery(t *testing.T) {
+	server := prometheusStandIn(t, map[string]string{
+		"vector": `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"0.25"]}]}}`,
+		"scalar": `{"status":"success","data":{"resultType":"scalar","result":[1700000000,"3"]}}`,
+		"empty":  `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+	})
+	p := &Prometheus{}
+	ctx := context.Background()
+
+	if v, err := p.Query(ctx, server.URL, "vector"); err != nil || v != 0.25 {
+		t.Fatalf("expected 0.25, got %v (%v)", v, err)
+	}
+	if v, err := p.Query(ctx, server.URL+"/", "scalar"); err != nil || v != 3 {
+		t.Fatalf("expected 3, got %v (%v)", v, err)
+	}
+	if _, err := p.Query(ctx, server.URL, "empty"); err == nil {
+		t.Fatalf("expected an error for an empty vector")
+	}
+	if _, err := p.Query(ctx, server.URL, "unknown"); err == nil {
+		t.Fatalf("expected an error for a failed query")
+	}
+}
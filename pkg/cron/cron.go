@@ -0,0 +1,93 @@
+// Package cron parses standard five-field cron expressions
+// (minute hour day-of-month month day-of-week) with robfig/cron and computes
+// their activation times. robfig/cron only looks forward; Prev is added on top
+// of its parsed fields.
+package cron
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	robfig "github.com/robfig/cron/v3"
+)
+
+// maxLookback bounds the search for the previous activation of expressions
+// that never match, such as "0 0 31 2 *".
+const maxLookback = 5 * 366 * 24 * time.Hour
+
+// starBit is set by robfig/cron in a day field written as "*".
+const starBit = 1 << 63
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	spec *robfig.SpecSchedule
+}
+
+// Parse parses a five-field cron expression as robfig/cron.ParseStandard
+// does: fields accept *, numbers, names of months and weekdays, ranges (1-5),
+// lists (1,15) and steps (*/10, 0-30/5), and descriptors such as @daily are
+// accepted too. Times are in the location of the time passed to Next and
+// Prev, so TZ= prefixes and @every, which has no fixed activation times, are
+// rejected.
+func Parse(expr string) (*Schedule, error) {
+	if trimmed := strings.TrimSpace(expr); strings.HasPrefix(trimmed, "TZ=") || strings.HasPrefix(trimmed, "CRON_TZ=") {
+		return nil, fmt.Errorf("cron: %q sets a time zone; use the timeZone field instead", expr)
+	}
+	parsed, err := robfig.ParseStandard(expr)
+	if err != nil {
+		return nil, fmt.Errorf("cron: %w", err)
+	}
+	spec, ok := parsed.(*robfig.SpecSchedule)
+	if !ok {
+		return nil, fmt.Errorf("cron: %q has no fixed activation times", expr)
+	}
+	return &Schedule{spec: spec}, nil
+}
+
+// Next returns the first activation strictly after t, in the location of t,
+// or the zero time if there is none within five years. An activation in the
+// hour skipped when daylight saving time starts does not happen; one in the
+// hour repeated when it ends happens twice.
+func (s *Schedule) Next(t time.Time) time.Time {
+	return s.spec.Next(t)
+}
+
+// Prev returns the last activation at or before t, in the location of t, or
+// the zero time if there is none within the previous five years. Daylight
+// saving time is handled as by Next.
+func (s *Schedule) Prev(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute)
+	limit := t.Add(-maxLookback)
+
+	for t.After(limit) {
+		year, month, day := t.Date()
+		switch {
+		case s.spec.Month&(1<<uint(month)) == 0:
+			t = time.Date(year, month, 1, 0, 0, 0, 0, loc).Add(-time.Minute)
+		case !s.dayMatches(t):
+			t = time.Date(year, month, day, 0, 0, 0, 0, loc).Add(-time.Minute)
+		case s.spec.Hour&(1<<uint(t.Hour())) == 0:
+			// Step back in absolute time, so an hour repeated when daylight
+			// saving time ends is searched both times.
+			t = t.Add(-time.Duration(t.Minute())*time.Minute - time.Minute)
+		case s.spec.Minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(-time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches mirrors robfig/cron: when both day fields are restricted a time
+// matches if either of them does.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.spec.Dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.spec.Dow&(1<<uint(t.Weekday())) != 0
+	if s.spec.Dom&starBit != 0 || s.spec.Dow&starBit != 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
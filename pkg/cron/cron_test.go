@@ -0,0 +1,139 @@
+package cron
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestNext(t *testing.T) {
+	start := time.Date(2024, time.January, 31, 22, 30, 15, 0, time.UTC) // a Wednesday
+	for _, tc := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.January, 31, 22, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.January, 31, 22, 45, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, time.February, 1, 2, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * sun", time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"30 6 1,15 * *", time.Date(2024, time.February, 1, 6, 30, 0, 0, time.UTC)},
+		// Restricted day-of-month and day-of-week match if either does.
+		{"0 0 15 * fri", time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	} {
+		s, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.expr, err)
+		}
+		if got := s.Next(start); !got.Equal(tc.want) {
+			t.Errorf("Next(%q) = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	s, err := Parse("0 2 * * *")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	got := s.Next(time.Date(2024, time.March, 1, 1, 0, 0, 0, loc))
+	if want := time.Date(2024, time.March, 1, 2, 0, 0, 0, loc); !got.Equal(want) {
+		t.Fatalf("Next = %v, want %v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *", "0 0 * * 8", "@every 1h", "CRON_TZ=Europe/Paris 0 2 * * *"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestPrev(t *testing.T) {
+	start := time.Date(2024, time.February, 1, 7, 0, 0, 0, time.UTC) // a Thursday
+	for _, tc := range []struct {
+		expr string
+		want time.Time
+	}{
+		// The activation at t itself counts.
+		{"0 7 * * *", start},
+		{"0 20 * * mon-fri", time.Date(2024, time.January, 31, 20, 0, 0, 0, time.UTC)},
+		{"0 20 * * sat", time.Date(2024, time.January, 27, 20, 0, 0, 0, time.UTC)},
+		{"15 * * * *", time.Date(2024, time.February, 1, 6, 15, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	} {
+		s, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.expr, err)
+		}
+		if got := s.Prev(start.Add(30 * time.Second)); !got.Equal(tc.want) {
+			t.Errorf("Prev(%q) = %v, want %v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestDaylightSavingTime(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	// 2024-03-31 02:00 CET jumps to 03:00 CEST; 2024-10-27 03:00 CEST falls
+	// back to 02:00 CET.
+	at := func(hour, min int, month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, hour, min, 0, 0, time.UTC).In(paris)
+	}
+	for _, tc := range []struct {
+		name       string
+		expr       string
+		from       time.Time
+		next, prev time.Time
+	}{
+		{
+			name: "skipped hour",
+			expr: "30 2 * * *",
+			from: at(10, 0, time.March, 31),
+			next: at(0, 30, time.April, 1),
+			prev: at(1, 30, time.March, 30),
+		},
+		{
+			name: "wall clock after the jump",
+			expr: "0 9 * * *",
+			from: at(10, 0, time.March, 31),
+			next: at(7, 0, time.April, 1),
+			prev: at(7, 0, time.March, 31),
+		},
+		{
+			name: "first of the repeated hours",
+			expr: "30 2 * * *",
+			from: at(0, 45, time.October, 27), // 02:45 CEST
+			next: at(1, 30, time.October, 27), // 02:30 CET
+			prev: at(0, 30, time.October, 27), // 02:30 CEST
+		},
+		{
+			name: "second of the repeated hours",
+			expr: "30 2 * * *",
+			from: at(1, 15, time.October, 27), // 02:15 CET
+			next: at(1, 30, time.October, 27), // 02:30 CET
+			prev: at(0, 30, time.October, 27), // 02:30 CEST
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := Parse(tc.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tc.expr, err)
+			}
+			if got := s.Next(tc.from); !got.Equal(tc.next) {
+				t.Errorf("Next(%v) = %v, want %v", tc.from, got, tc.next)
+			}
+			if got := s.Prev(tc.from); !got.Equal(tc.prev) {
+				t.Errorf("Prev(%v) = %v, want %v", tc.from, got, tc.prev)
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+// Package gitsource fetches config files from a path of a Git repository.
+package gitsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Request names the files to fetch.
+type Request struct {
+	// URL of the repository, https or ssh.
+	URL string
+	// Ref is a branch, a tag or a commit SHA. HEAD if empty.
+	Ref string
+	// Path is a directory, whose files are fetched, or a single file. The
+	// root of the repository if empty.
+	Path string
+	Auth Auth
+}
+
+// Auth holds the credentials of a repository.
+type Auth struct {
+	// Username and Password are sent with HTTPS requests.
+	Username string
+	Password string
+	// SSHPrivateKey is used for SSH URLs, checked against KnownHosts if set.
+	SSHPrivateKey []byte
+	KnownHosts    []byte
+}
+
+// Result is the files of a path at a commit.
+type Result struct {
+	// Commit is the SHA of the commit Ref resolved to.
+	Commit string
+	// Files are the contents of the files by name.
+	Files map[string]string
+}
+
+// Fetcher fetches the files of a path of a repository.
+type Fetcher interface {
+	Fetch(ctx context.Context, req Request) (*Result, error)
+}
+
+// DefaultTimeout bounds a fetch when Git.Timeout is zero.
+const DefaultTimeout = time.Minute
+
+// fileNamePattern matches the file names that are valid ConfigMap keys;
+// other files are skipped.
+var fileNamePattern = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// commitPattern matches a full commit SHA.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Git fetches in-process into memory: nothing is kept between fetches, so
+// fetches of different repositories, or credentials, never share state. A
+// branch or tag is fetched without history; a commit SHA needs the history
+// of the branches and tags, since servers may refuse to send an arbitrary
+// commit. Only https and ssh URLs are accepted.
+type Git struct {
+	// Timeout bounds each fetch; DefaultTimeout if zero.
+	Timeout time.Duration
+
+	// allowFile also accepts local repositories, for tests.
+	allowFile bool
+}
+
+var _ Fetcher = &Git{}
+
+// Fetch fetches req.Ref and reads the files of req.Path at it.
+func (g *Git) Fetch(ctx context.Context, req Request) (*Result, error) {
+	endpoint, err := transport.NewEndpoint(req.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository URL: %w", err)
+	}
+	switch endpoint.Protocol {
+	case "https", "ssh":
+	case "file":
+		if !g.allowFile {
+			return nil, fmt.Errorf("unsupported repository URL %s: only https and ssh repositories can be fetched", req.URL)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported repository URL %s: only https and ssh repositories can be fetched", req.URL)
+	}
+
+	timeout := g.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	auth, cleanup, err := authMethod(endpoint, req.Auth)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	ref := req.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	storage := memory.NewStorage()
+	remote := git.NewRemote(storage, &config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{req.URL}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s of %s: %w", ref, req.URL, err)
+	}
+
+	hash, err := fetchRef(ctx, remote, storage, refs, ref, auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s of %s: %w", ref, req.URL, err)
+	}
+	commit, err := object.GetCommit(storage, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s of %s: %w", ref, req.URL, err)
+	}
+	files, err := readPath(commit, req.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Commit: commit.Hash.String(), Files: files}, nil
+}
+
+// fetchRef fetches ref into storage and returns the commit it points to.
+func fetchRef(ctx context.Context, remote *git.Remote, storage *memory.Storage, refs []*plumbing.Reference, ref string, auth transport.AuthMethod) (plumbing.Hash, error) {
+	name, ok := findRef(refs, ref)
+	if !ok {
+		if !commitPattern.MatchString(ref) {
+			return plumbing.ZeroHash, fmt.Errorf("no branch or tag %s", ref)
+		}
+		err := remote.FetchContext(ctx, &git.FetchOptions{
+			RefSpecs: []config.RefSpec{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"},
+			Auth:     auth,
+			Tags:     git.NoTags,
+		})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return plumbing.ZeroHash, err
+		}
+		return plumbing.NewHash(ref), nil
+	}
+
+	err := remote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", name, name))},
+		Depth:    1,
+		Auth:     auth,
+		Tags:     git.NoTags,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return plumbing.ZeroHash, err
+	}
+	fetched, err := storage.Reference(name)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	hash := fetched.Hash()
+	// An annotated tag points to its tag object.
+	if tag, err := object.GetTag(storage, hash); err == nil {
+		hash = tag.Target
+	}
+	return hash, nil
+}
+
+// findRef returns the name of the branch or tag ref names in refs. HEAD
+// resolves to the branch it points to.
+func findRef(refs []*plumbing.Reference, ref string) (plumbing.ReferenceName, bool) {
+	byName := make(map[plumbing.ReferenceName]*plumbing.Reference, len(refs))
+	for _, r := range refs {
+		byName[r.Name()] = r
+	}
+	if ref == "HEAD" {
+		head, ok := byName[plumbing.HEAD]
+		if !ok {
+			return "", false
+		}
+		if head.Type() == plumbing.SymbolicReference {
+			return head.Target(), true
+		}
+		return plumbing.HEAD, true
+	}
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.ReferenceName(ref),
+		plumbing.NewBranchReferenceName(ref),
+		plumbing.NewTagReferenceName(ref),
+	} {
+		if _, ok := byName[name]; ok && strings.HasPrefix(name.String(), "refs/") {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// readPath reads the file at p, or the files directly under the directory
+// at p, in the tree of commit.
+func readPath(commit *object.Commit, p string) (map[string]string, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	p = strings.Trim(p, "/")
+	files := map[string]string{}
+	if p != "" {
+		entry, err := tree.FindEntry(p)
+		if err != nil {
+			return nil, fmt.Errorf("path %q not found at %s", p, commit.Hash)
+		}
+		if entry.Mode.IsFile() {
+			content, err := readBlob(tree, p)
+			if err != nil {
+				return nil, err
+			}
+			files[path.Base(p)] = content
+			return files, nil
+		}
+		if tree, err = tree.Tree(p); err != nil {
+			return nil, fmt.Errorf("path %q is not a file or a directory", p)
+		}
+	}
+	for _, entry := range tree.Entries {
+		if !entry.Mode.IsFile() || !fileNamePattern.MatchString(entry.Name) {
+			continue
+		}
+		content, err := readBlob(tree, entry.Name)
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name] = content
+	}
+	return files, nil
+}
+
+func readBlob(tree *object.Tree, name string) (string, error) {
+	file, err := tree.File(name)
+	if err != nil {
+		return "", err
+	}
+	r, err := file.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// authMethod returns the credentials of auth for endpoint, or nil. cleanup
+// removes the files written for SSH.
+func authMethod(endpoint *transport.Endpoint, auth Auth) (transport.AuthMethod, func(), error) {
+	cleanup := func() {}
+	switch endpoint.Protocol {
+	case "https":
+		if auth.Username == "" && auth.Password == "" {
+			return nil, cleanup, nil
+		}
+		return &githttp.BasicAuth{Username: auth.Username, Password: auth.Password}, cleanup, nil
+	case "ssh":
+		if len(auth.SSHPrivateKey) == 0 {
+			return nil, cleanup, nil
+		}
+		user := endpoint.User
+		if user == "" {
+			user = "git"
+		}
+		keys, err := gitssh.NewPublicKeys(user, auth.SSHPrivateKey, "")
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("invalid SSH private key: %w", err)
+		}
+		if len(auth.KnownHosts) == 0 {
+			keys.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+			return keys, cleanup, nil
+		}
+		// knownhosts only reads files.
+		f, err := os.CreateTemp("", "known_hosts-")
+		if err != nil {
+			return nil, cleanup, err
+		}
+		cleanup = func() { os.Remove(f.Name()) }
+		_, err = f.Write(auth.KnownHosts)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+		if keys.HostKeyCallback, err = knownhosts.New(f.Name()); err != nil {
+			cleanup()
+			return nil, func() {}, fmt.Errorf("invalid known_hosts: %w", err)
+		}
+		return keys, cleanup, nil
+	}
+	return nil, cleanup, nil
+}
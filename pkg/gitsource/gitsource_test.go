@@ -0,0 +1,144 @@
+package gitsource
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRepo is a bare repository with a work tree pushing to it.
+type testRepo struct {
+	t    *testing.T
+	bare string
+	work string
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	r := &testRepo{t: t, bare: filepath.Join(dir, "config.git"), work: filepath.Join(dir, "work")}
+	r.run(dir, "init", "--quiet", "--bare", "--initial-branch=main", r.bare)
+	r.run(dir, "init", "--quiet", "--initial-branch=main", r.work)
+	return r
+}
+
+func (r *testRepo) run(dir string, args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes files, commits and pushes them, and returns the commit SHA.
+func (r *testRepo) commit(files map[string]string) string {
+	r.t.Helper()
+	for name, content := range files {
+		path := filepath.Join(r.work, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	r.run(r.work, "add", "-A")
+	r.run(r.work, "commit", "--quiet", "-m", "update")
+	r.run(r.work, "push", "--quiet", r.bare, "main")
+	return r.run(r.work, "rev-parse", "HEAD")
+}
+
+func TestFetchDirectoryAndFile(t *testing.T) {
+	repo := newTestRepo(t)
+	first := repo.commit(map[string]string{
+		"apps/api/app.yaml":       "port: 8080\n",
+		"apps/api/nested/ignored": "x",
+		"apps/api/not a key":      "x",
+		"README.md":               "docs",
+	})
+	fetcher := &Git{allowFile: true}
+	ctx := context.Background()
+
+	res, err := fetcher.Fetch(ctx, Request{URL: repo.bare, Ref: "main", Path: "/apps/api/"})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if res.Commit != first || !reflect.DeepEqual(res.Files, map[string]string{"app.yaml": "port: 8080\n"}) {
+		t.Fatalf("unexpected result %+v, want commit %s", res, first)
+	}
+
+	second := repo.commit(map[string]string{"apps/api/app.yaml": "port: 9090\n"})
+	res, err = fetcher.Fetch(ctx, Request{URL: repo.bare, Path: "apps/api/app.yaml"})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if res.Commit != second || res.Files["app.yaml"] != "port: 9090\n" {
+		t.Fatalf("expected the new commit of HEAD, got %+v", res)
+	}
+
+	// A commit SHA pins the files.
+	res, err = fetcher.Fetch(ctx, Request{URL: repo.bare, Ref: first, Path: "apps/api"})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if res.Commit != first || res.Files["app.yaml"] != "port: 8080\n" {
+		t.Fatalf("expected the pinned commit, got %+v", res)
+	}
+
+	// An annotated tag resolves to its commit.
+	repo.run(repo.work, "tag", "-a", "-m", "release", "v1", first)
+	repo.run(repo.work, "push", "--quiet", repo.bare, "v1")
+	res, err = fetcher.Fetch(ctx, Request{URL: repo.bare, Ref: "v1", Path: "apps/api"})
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if res.Commit != first || res.Files["app.yaml"] != "port: 8080\n" {
+		t.Fatalf("expected the tagged commit, got %+v", res)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.commit(map[string]string{"app.yaml": "a: 1\n"})
+	fetcher := &Git{allowFile: true}
+	ctx := context.Background()
+
+	if _, err := fetcher.Fetch(ctx, Request{URL: repo.bare, Ref: "nope"}); err == nil || !strings.Contains(err.Error(), "failed to fetch nope") {
+		t.Fatalf("expected an unknown ref to fail, got %v", err)
+	}
+	if _, err := fetcher.Fetch(ctx, Request{URL: repo.bare, Path: "missing"}); err == nil || !strings.Contains(err.Error(), `path "missing" not found`) {
+		t.Fatalf("expected a missing path to fail, got %v", err)
+	}
+}
+
+func TestFetchOnlyHTTPSAndSSH(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.commit(map[string]string{"app.yaml": "a: 1\n"})
+	fetcher := &Git{}
+
+	for _, url := range []string{repo.bare, "file://" + repo.bare, "http://example.com/config.git", "git://example.com/config.git"} {
+		if _, err := fetcher.Fetch(context.Background(), Request{URL: url}); err == nil || !strings.Contains(err.Error(), "only https and ssh repositories") {
+			t.Fatalf("%s: expected the URL to be refused, got %v", url, err)
+		}
+	}
+}
+
+func TestFetchTimesOut(t *testing.T) {
+	fetcher := &Git{Timeout: time.Nanosecond}
+	if _, err := fetcher.Fetch(context.Background(), Request{URL: "https://example.com/config.git"}); err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Fatalf("expected the fetch to time out, got %v", err)
+	}
+}
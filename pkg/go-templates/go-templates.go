@@ -2,39 +2,215 @@ package gotemplates
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 	"text/template"
 
-	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
 )
 
-func ProcessLivenessProbeTemplate(probe *corev1.Probe, meta metav1.ObjectMeta) error {
-	if probe == nil || probe.HTTPGet == nil {
-		return nil
+// Cluster describes the cluster the controller runs in.
+type Cluster struct {
+	Name   string
+	Domain string
+}
+
+// Context is the data templates are rendered with. The Phare metadata is
+// embedded so that {{ .Name }} and {{ .Labels.team }} keep working.
+type Context struct {
+	metav1.ObjectMeta
+	// Spec is the spec of the Phare as written, before rendering.
+	Spec pharev1beta1.PhareSpec
+	// Phare is the whole Phare, e.g. {{ .Phare.Status.CurrentRevision }}.
+	Phare *pharev1beta1.Phare
+	// NamespaceLabels are the labels of the namespace of the Phare.
+	NamespaceLabels map[string]string
+	Cluster         Cluster
+}
+
+// NewContext returns the template context of phare. phare is copied so that
+// rendering it in place does not change the context.
+func NewContext(phare *pharev1beta1.Phare, namespaceLabels map[string]string, cluster Cluster) Context {
+	phare = phare.DeepCopy()
+	return Context{
+		ObjectMeta:      phare.ObjectMeta,
+		Spec:            phare.Spec,
+		Phare:           phare,
+		NamespaceLabels: namespaceLabels,
+		Cluster:         cluster,
 	}
+}
 
-	// Render template values in the liveness probe HTTP path.
-	processedPath, err := ProcessTemplate(probe.HTTPGet.Path, meta)
-	if err != nil {
-		return fmt.Errorf("error processing template for livenessProbe path: %v", err)
+// RenderError is a template of a Phare field that failed to render.
+type RenderError struct {
+	// Path is the field path of the template, e.g. spec.toolchain.config.
+	Path string
+	// Key is the map key or the env variable name of the template, if any.
+	Key string
+	Err error
+}
+
+func (e *RenderError) Error() string {
+	if e.Key != "" {
+		return fmt.Sprintf("failed to render %s[%s]: %v", e.Path, e.Key, e.Err)
 	}
-	probe.HTTPGet.Path = processedPath
+	return fmt.Sprintf("failed to render %s: %v", e.Path, e.Err)
+}
 
-	return nil
+func (e *RenderError) Unwrap() error {
+	return e.Err
 }
 
-// ProcessTemplate renders a template string with object metadata values.
-func ProcessTemplate(tmplStr string, meta metav1.ObjectMeta) (string, error) {
-	tmpl, err := template.New("phareTemplate").Parse(tmplStr)
+// Renderer renders templates with a Context and the function library:
+//
+//	default DEFAULT VALUE   VALUE, or DEFAULT if VALUE is empty
+//	quote VALUE             VALUE as a double-quoted string
+//	b64enc VALUE            VALUE encoded as standard base64
+//	toJson VALUE            VALUE encoded as JSON
+//	indent N VALUE          VALUE with every line indented by N spaces
+//	required MESSAGE VALUE  VALUE, or an error with MESSAGE if VALUE is empty
+//	include KEY             the config value KEY, itself rendered
+type Renderer struct {
+	data     Context
+	strict   bool
+	includes map[string]string
+	// including holds the keys being included, to detect cycles.
+	including map[string]bool
+}
+
+// NewRenderer returns a Renderer of templates with data. include resolves
+// keys in includes. In strict mode a missing map key, e.g.
+// {{ .Labels.missing }}, is an error instead of an empty value.
+func NewRenderer(data Context, strict bool, includes map[string]string) *Renderer {
+	return &Renderer{
+		data:      data,
+		strict:    strict,
+		includes:  includes,
+		including: map[string]bool{},
+	}
+}
+
+// WithIncludes returns a Renderer like r whose include resolves keys in
+// includes.
+func (r *Renderer) WithIncludes(includes map[string]string) *Renderer {
+	return NewRenderer(r.data, r.strict, includes)
+}
+
+// Render renders text, naming the template name in errors. Text without
+// actions is returned as is.
+func (r *Renderer) Render(name, text string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl := template.New(name).Funcs(r.funcs())
+	if r.strict {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+	tmpl, err := tmpl.Parse(text)
 	if err != nil {
 		return "", err
 	}
 
 	var buf bytes.Buffer
-	if err = tmpl.Execute(&buf, meta); err != nil {
+	if err = tmpl.Execute(&buf, r.data); err != nil {
 		return "", err
 	}
-
 	return buf.String(), nil
 }
+
+// RenderField renders the template of the field at path. key is its map key
+// or env variable name, if any. Errors are *RenderError.
+func (r *Renderer) RenderField(path, key, text string) (string, error) {
+	name := path
+	if key != "" {
+		name += "[" + key + "]"
+	}
+	out, err := r.Render(name, text)
+	if err != nil {
+		return "", &RenderError{Path: path, Key: key, Err: err}
+	}
+	return out, nil
+}
+
+func (r *Renderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		"default": func(def, value interface{}) interface{} {
+			if empty(value) {
+				return def
+			}
+			return value
+		},
+		"quote": func(value interface{}) string {
+			return strconv.Quote(toString(value))
+		},
+		"b64enc": func(value interface{}) string {
+			return base64.StdEncoding.EncodeToString([]byte(toString(value)))
+		},
+		"toJson": func(value interface{}) (string, error) {
+			out, err := json.Marshal(value)
+			return string(out), err
+		},
+		"indent": func(n int, value interface{}) string {
+			pad := strings.Repeat(" ", n)
+			return pad + strings.ReplaceAll(toString(value), "\n", "\n"+pad)
+		},
+		"required": func(message string, value interface{}) (interface{}, error) {
+			if empty(value) {
+				return nil, errors.New(message)
+			}
+			return value, nil
+		},
+		"include": r.include,
+	}
+}
+
+func (r *Renderer) include(key string) (string, error) {
+	text, ok := r.includes[key]
+	if !ok {
+		return "", fmt.Errorf("include: no config key %q", key)
+	}
+	if r.including[key] {
+		return "", fmt.Errorf("include: %q includes itself", key)
+	}
+	r.including[key] = true
+	defer delete(r.including, key)
+	return r.Render(key, text)
+}
+
+// empty reports whether value is nil or the zero value of its type, or an
+// empty slice or map.
+func empty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+func toString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// ProcessTemplate renders a template string with object metadata values.
+func ProcessTemplate(tmplStr string, meta metav1.ObjectMeta) (string, error) {
+	return NewRenderer(Context{ObjectMeta: meta}, false, nil).Render("phareTemplate", tmplStr)
+}
@@ -1,8 +1,10 @@
 package gotemplates
 
 import (
+	"errors"
 	"testing"
 
+	pharev1beta1 "github.com/localcorp/phare-controller/api/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -19,3 +21,71 @@ func TestProcessTemplateDoesNotHTMLEscape(t *testing.T) {
 		t.Fatalf("expected unescaped output, got %q", out)
 	}
 }
+
+func TestRendererContextAndFunctions(t *testing.T) {
+	phare := &pharev1beta1.Phare{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "apps", Labels: map[string]string{"team": "core"}},
+		Spec: pharev1beta1.PhareSpec{
+			MicroService: pharev1beta1.MicroServiceSpec{Image: pharev1beta1.ImageSpec{Repository: "nginx", Tag: "1.25"}},
+		},
+	}
+	data := NewContext(phare, map[string]string{"env": "prod"}, Cluster{Name: "eu-1", Domain: "cluster.local"})
+	r := NewRenderer(data, false, map[string]string{
+		"base":  "name={{ .Name }}",
+		"loop":  `{{ include "loop" }}`,
+		"multi": "a\nb",
+	})
+
+	cases := map[string]string{
+		"{{ .Name }}.{{ .Namespace }}.svc.{{ .Cluster.Domain }}": "api.apps.svc.cluster.local",
+		"{{ .Labels.team }}/{{ .NamespaceLabels.env }}":          "core/prod",
+		"{{ .Spec.MicroService.Image.Tag }}":                     "1.25",
+		"{{ .Phare.Spec.MicroService.Image.Repository }}":        "nginx",
+		`{{ .Labels.missing | default "none" }}`:                 "none",
+		`{{ .Cluster.Name | quote }}`:                            `"eu-1"`,
+		`{{ .Name | b64enc }}`:                                   "YXBp",
+		`{{ .Labels | toJson }}`:                                 `{"team":"core"}`,
+		`{{ include "base" }}`:                                   "name=api",
+		`{{ include "multi" | indent 2 }}`:                       "  a\n  b",
+		"no templates here":                                      "no templates here",
+	}
+	for text, want := range cases {
+		got, err := r.Render("test", text)
+		if err != nil {
+			t.Fatalf("render %q: %v", text, err)
+		}
+		if got != want {
+			t.Fatalf("render %q: expected %q, got %q", text, want, got)
+		}
+	}
+
+	for _, text := range []string{
+		`{{ required "team is required" .Labels.owner }}`,
+		`{{ include "loop" }}`,
+		`{{ include "unknown" }}`,
+	} {
+		if _, err := r.Render("test", text); err == nil {
+			t.Fatalf("render %q: expected an error", text)
+		}
+	}
+}
+
+func TestRendererStrictMode(t *testing.T) {
+	data := NewContext(&pharev1beta1.Phare{ObjectMeta: metav1.ObjectMeta{Name: "api"}}, nil, Cluster{})
+
+	if _, err := NewRenderer(data, false, nil).Render("test", "{{ .Labels.missing }}"); err != nil {
+		t.Fatalf("expected a missing key to be tolerated, got %v", err)
+	}
+	if _, err := NewRenderer(data, true, nil).Render("test", "{{ .Labels.missing }}"); err == nil {
+		t.Fatalf("expected a missing key to fail in strict mode")
+	}
+}
+
+func TestRenderFieldReturnsRenderError(t *testing.T) {
+	r := NewRenderer(Context{}, false, nil)
+	_, err := r.RenderField("spec.toolchain.config", "app.yaml", "{{ .Nope }}")
+	var renderErr *RenderError
+	if !errors.As(err, &renderErr) || renderErr.Path != "spec.toolchain.config" || renderErr.Key != "app.yaml" {
+		t.Fatalf("expected a RenderError of spec.toolchain.config[app.yaml], got %v", err)
+	}
+}
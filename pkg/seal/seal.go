@@ -0,0 +1,181 @@
+// Package seal encrypts config values so that they can be stored in a Phare
+// spec, and decrypts them in the controller.
+//
+// A sealed value is an AES-256-GCM envelope:
+//
+//	encrypted:v1:<key id>:<wrapped data key>:<ciphertext>
+//
+// The value is encrypted with a random data key, itself encrypted with the
+// key named by the key id. Both parts are base64 encoded and carry their
+// nonce as a prefix. Several keys can be active at once, which allows rotating
+// them: values are opened with the key their id names.
+//
+// Both parts are authenticated with the namespace and name of the Phare the
+// value is sealed for, so that a value copied into another Phare, in another
+// namespace or not, cannot be opened there.
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Prefix marks a sealed value.
+const Prefix = "encrypted:"
+
+// KeySize is the size of the keys, for AES-256.
+const KeySize = 32
+
+const version = "v1"
+
+// keyIDPattern matches the keys of a Secret, which hold the keys by id.
+var keyIDPattern = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// Scope is the Phare a value is sealed for.
+type Scope struct {
+	Namespace string
+	Name      string
+}
+
+func (s Scope) String() string {
+	return s.Namespace + "/" + s.Name
+}
+
+// additionalData returns the data authenticated with both parts of a value.
+func (s Scope) additionalData() ([]byte, error) {
+	if s.Namespace == "" || s.Name == "" {
+		return nil, errors.New("the namespace and name of the Phare are required")
+	}
+	return []byte(s.String()), nil
+}
+
+// IsSealed reports whether value is a sealed value.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// ParseKey parses a key given as KeySize raw bytes or as base64 text, as
+// produced by "head -c 32 /dev/urandom | base64".
+func ParseKey(data []byte) ([]byte, error) {
+	if len(data) == KeySize {
+		return data, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("a key must be %d bytes, raw or base64 encoded", KeySize)
+	}
+	return key, nil
+}
+
+// Seal encrypts plaintext for the Phare of scope with the key named keyID.
+func Seal(plaintext []byte, scope Scope, keyID string, key []byte) (string, error) {
+	if !keyIDPattern.MatchString(keyID) {
+		return "", fmt.Errorf("invalid key id %q: it must consist of alphanumeric characters, '-', '_' or '.'", keyID)
+	}
+	ad, err := scope.additionalData()
+	if err != nil {
+		return "", err
+	}
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrapped, err := encrypt(key, dataKey, ad)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := encrypt(dataKey, plaintext, ad)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		Prefix + version,
+		keyID,
+		base64.StdEncoding.EncodeToString(wrapped),
+		base64.StdEncoding.EncodeToString(ciphertext),
+	}, ":"), nil
+}
+
+// Open decrypts a value sealed for the Phare of scope with the key its id
+// names in keys.
+func Open(value string, scope Scope, keys map[string][]byte) ([]byte, error) {
+	ad, err := scope.additionalData()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(strings.TrimPrefix(value, Prefix), ":")
+	if !IsSealed(value) || len(parts) != 4 {
+		return nil, errors.New("malformed sealed value")
+	}
+	if parts[0] != version {
+		return nil, fmt.Errorf("unsupported sealed value version %q", parts[0])
+	}
+	key, ok := keys[parts[1]]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", parts[1])
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed sealed value: invalid data key encoding")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, errors.New("malformed sealed value: invalid ciphertext encoding")
+	}
+	dataKey, err := decrypt(key, wrapped, ad)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt with key %q for %s: %w", parts[1], scope, err)
+	}
+	plaintext, err := decrypt(dataKey, ciphertext, ad)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt with key %q for %s: %w", parts[1], scope, err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("a key must be %d bytes", KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt returns the nonce followed by the ciphertext, which authenticates
+// ad.
+func encrypt(key, plaintext, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func decrypt(key, sealed, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, errors.New("message authentication failed")
+	}
+	return plaintext, nil
+}
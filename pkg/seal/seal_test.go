@@ -0,0 +1,98 @@
+package seal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+var testScope = Scope{Namespace: "team-a", Name: "api"}
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestSealOpenWithRotatedKeys(t *testing.T) {
+	old, err := Seal([]byte("s3cret"), testScope, "2025-01", testKey(1))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	current, err := Seal([]byte("n3w"), testScope, "2026-01", testKey(2))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if !IsSealed(old) || !strings.HasPrefix(old, "encrypted:v1:2025-01:") {
+		t.Fatalf("unexpected sealed value %q", old)
+	}
+
+	keys := map[string][]byte{"2025-01": testKey(1), "2026-01": testKey(2)}
+	for value, want := range map[string]string{old: "s3cret", current: "n3w"} {
+		got, err := Open(value, testScope, keys)
+		if err != nil || string(got) != want {
+			t.Fatalf("open %q: got %q, %v", value, got, err)
+		}
+	}
+
+	delete(keys, "2025-01")
+	if _, err := Open(old, testScope, keys); err == nil || !strings.Contains(err.Error(), `unknown key id "2025-01"`) {
+		t.Fatalf("expected the retired key to be missing, got %v", err)
+	}
+}
+
+func TestOpenRejectsTamperedValues(t *testing.T) {
+	value, err := Seal([]byte("s3cret"), testScope, "k", testKey(1))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	keys := map[string][]byte{"k": testKey(1)}
+
+	if _, err := Open(value, testScope, map[string][]byte{"k": testKey(9)}); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Fatalf("expected a wrong key to fail, got %v", err)
+	}
+	parts := strings.Split(value, ":")
+	ciphertext, _ := base64.StdEncoding.DecodeString(parts[4])
+	ciphertext[len(ciphertext)-1] ^= 1
+	parts[4] = base64.StdEncoding.EncodeToString(ciphertext)
+	if _, err := Open(strings.Join(parts, ":"), testScope, keys); err == nil {
+		t.Fatalf("expected a tampered ciphertext to fail")
+	}
+	for _, malformed := range []string{"encrypted:v1:k:abc", "encrypted:v2:k:a:b", "plain"} {
+		if _, err := Open(malformed, testScope, keys); err == nil {
+			t.Fatalf("expected %q to fail", malformed)
+		}
+	}
+}
+
+func TestOpenRejectsValuesSealedForAnotherPhare(t *testing.T) {
+	value, err := Seal([]byte("s3cret"), Scope{Namespace: "team-a", Name: "api"}, "k", testKey(1))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	keys := map[string][]byte{"k": testKey(1)}
+
+	for _, scope := range []Scope{{Namespace: "team-b", Name: "api"}, {Namespace: "team-a", Name: "worker"}} {
+		if _, err := Open(value, scope, keys); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+			t.Fatalf("expected the value to fail for %s, got %v", scope, err)
+		}
+	}
+	if _, err := Seal([]byte("s3cret"), Scope{Name: "api"}, "k", testKey(1)); err == nil {
+		t.Fatalf("expected a value without a namespace to fail")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	raw := testKey(3)
+	for _, data := range [][]byte{raw, []byte(base64.StdEncoding.EncodeToString(raw) + "\n")} {
+		key, err := ParseKey(data)
+		if err != nil || !bytes.Equal(key, raw) {
+			t.Fatalf("parse %q: got %v, %v", data, key, err)
+		}
+	}
+	if _, err := ParseKey([]byte("short")); err == nil {
+		t.Fatalf("expected a short key to fail")
+	}
+	if _, err := Seal([]byte("x"), testScope, "bad:id", raw); err == nil {
+		t.Fatalf("expected an invalid key id to fail")
+	}
+}
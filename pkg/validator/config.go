@@ -0,0 +1,185 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFormat returns the format of a config file from the extension of its
+// key: "json", "yaml", "toml" or "properties", or "" if it is not parsed.
+func ConfigFormat(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	case ".properties":
+		return "properties"
+	}
+	return ""
+}
+
+// ParseConfig parses value in the format of key. It returns the documents of
+// the file, converted to the types of encoding/json (map[string]interface{},
+// []interface{}, string, float64, bool and nil), or no document if the format
+// of key is not known. YAML files may hold several documents.
+func ParseConfig(key, value string) ([]interface{}, error) {
+	switch ConfigFormat(key) {
+	case "json":
+		dec := json.NewDecoder(strings.NewReader(value))
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		if _, err := dec.Token(); err != io.EOF {
+			return nil, errors.New("invalid JSON: unexpected data after the top-level value")
+		}
+		return []interface{}{doc}, nil
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader([]byte(value)))
+		var docs []interface{}
+		for {
+			var doc interface{}
+			err := dec.Decode(&doc)
+			if err == io.EOF {
+				return docs, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid YAML: %w", err)
+			}
+			normalized, err := normalize(doc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid YAML: %w", err)
+			}
+			docs = append(docs, normalized)
+		}
+	case "toml":
+		var doc map[string]interface{}
+		if _, err := toml.Decode(value, &doc); err != nil {
+			return nil, fmt.Errorf("invalid TOML: %w", err)
+		}
+		normalized, err := normalize(doc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TOML: %w", err)
+		}
+		return []interface{}{normalized}, nil
+	case "properties":
+		doc, err := parseProperties(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid properties: %w", err)
+		}
+		return []interface{}{doc}, nil
+	}
+	return nil, nil
+}
+
+// ValidateConfig parses value in the format of key and, if schema is not nil,
+// validates every document against it. Keys of an unknown format are only
+// validated when a schema is given, as a JSON string.
+func ValidateConfig(key, value string, schema *Schema) error {
+	docs, err := ParseConfig(key, value)
+	if err != nil {
+		return err
+	}
+	if schema == nil {
+		return nil
+	}
+	if ConfigFormat(key) == "" {
+		docs = []interface{}{value}
+	}
+	for _, doc := range docs {
+		if err := schema.Validate(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalize converts a document decoded by yaml.v3 or toml to the types of
+// encoding/json.
+func normalize(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			n, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = n
+		}
+		return v, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			n, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = n
+		}
+		return m, nil
+	case []interface{}:
+		for i, item := range v {
+			n, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = n
+		}
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case []map[string]interface{}:
+		// Arrays of TOML tables.
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			n, err := normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = n
+		}
+		return items, nil
+	case uint64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case string, float64, bool, nil:
+		return v, nil
+	case time.Time:
+		// toml marks its local dates and times with the name of their zone.
+		switch v.Location().String() {
+		case "date-local":
+			return v.Format("2006-01-02"), nil
+		case "time-local":
+			return v.Format("15:04:05.999999999"), nil
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05.999999999"), nil
+		}
+		return v.Format(time.RFC3339Nano), nil
+	default:
+		// Binary values are compared as strings.
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var s interface{}
+		if err := json.Unmarshal(b, &s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+}
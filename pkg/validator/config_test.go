@@ -0,0 +1,119 @@
+package validator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigByExtension(t *testing.T) {
+	tests := []struct {
+		key, value string
+		want       interface{}
+	}{
+		{"app.json", `{"port": 8080, "debug": true}`, map[string]interface{}{"port": 8080.0, "debug": true}},
+		{"app.yaml", "port: 8080\ntags: [a, b]\n", map[string]interface{}{"port": 8080.0, "tags": []interface{}{"a", "b"}}},
+		{"APP.YML", "name: demo\n", map[string]interface{}{"name": "demo"}},
+		{"app.toml", `
+# comment
+title = "demo" # trailing comment
+port = 8_080
+ratio = 0.5
+hosts = ["a", 'b',
+]
+
+[server.tls]
+enabled = true
+opts = { min = "1.2" }
+
+[[backends]]
+name = "one"
+
+[[backends]]
+name = """
+two"""
+released = 2026-01-02
+at = 07:32:00
+`, map[string]interface{}{
+			"title": "demo",
+			"port":  8080.0,
+			"ratio": 0.5,
+			"hosts": []interface{}{"a", "b"},
+			"server": map[string]interface{}{"tls": map[string]interface{}{
+				"enabled": true,
+				"opts":    map[string]interface{}{"min": "1.2"},
+			}},
+			"backends": []interface{}{
+				map[string]interface{}{"name": "one"},
+				map[string]interface{}{"name": "two", "released": "2026-01-02", "at": "07:32:00"},
+			},
+		}},
+		{"app.properties", "# comment\n! comment\nname=demo\nurl: http://x\\\n  /path\ngreeting Hello\\u0021\nref=${name}\n", map[string]interface{}{
+			"name":     "demo",
+			"url":      "http://x/path",
+			"greeting": "Hello!",
+			"ref":      "${name}",
+		}},
+	}
+	for _, tt := range tests {
+		docs, err := ParseConfig(tt.key, tt.value)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.key, err)
+		}
+		if len(docs) != 1 || !reflect.DeepEqual(docs[0], tt.want) {
+			t.Fatalf("%s: got %#v, want %#v", tt.key, docs, tt.want)
+		}
+	}
+}
+
+func TestParseConfigRejectsInvalidSyntax(t *testing.T) {
+	tests := []struct {
+		key, value, want string
+	}{
+		{"app.json", `{"port": 8080,}`, "invalid JSON"},
+		{"app.json", `{} {}`, "unexpected data"},
+		{"app.yaml", "a: [1, 2\n", "invalid YAML"},
+		{"app.yaml", "ok: 1\n---\nbad: : :\n", "invalid YAML"},
+		{"app.toml", "a = \"unterminated\n", "line 1 (last key \"a\"): strings cannot contain newlines"},
+		{"app.toml", "a = 1\nb = hello\n", "line 2 (last key \"b\"): expected value"},
+		{"app.toml", "a = 1\na = 2\n", "already been defined"},
+		{"app.toml", "[t]\n[t]\n", "already been defined"},
+		{"app.toml", "a = 01\n", "leading zeroes"},
+		{"app.properties", "a=\\u00zz\n", "line 1: invalid unicode literal"},
+		{"app.properties", "a=1\nb=\\u12", "line 2: invalid unicode literal"},
+		{"app.properties", "a=b\\", "line 1: premature EOF"},
+		{"app.properties", "a=\xff\n", "not valid UTF-8"},
+	}
+	for _, tt := range tests {
+		_, err := ParseConfig(tt.key, tt.value)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Fatalf("%s %q: expected error containing %q, got %v", tt.key, tt.value, tt.want, err)
+		}
+	}
+}
+
+func TestParseConfigIgnoresUnknownExtensions(t *testing.T) {
+	docs, err := ParseConfig("nginx.conf", "{ not json")
+	if err != nil || docs != nil {
+		t.Fatalf("expected unknown formats to be skipped, got %v, %v", docs, err)
+	}
+}
+
+func TestValidateConfigAgainstSchema(t *testing.T) {
+	schema, err := ParseSchema(`{"type": "object", "required": ["port"], "properties": {"port": {"type": "integer", "maximum": 65535}}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := ValidateConfig("app.yaml", "port: 8080\n", schema); err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+	err = ValidateConfig("app.toml", "port = 70000\n", schema)
+	if err == nil || err.Error() != "schema validation failed at /port: must be <= 65535 but found 70000" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Every YAML document is validated.
+	if err := ValidateConfig("app.yaml", "port: 1\n---\nhost: x\n", schema); err == nil || !strings.Contains(err.Error(), "missing properties: 'port'") {
+		t.Fatalf("expected the second document to fail, got %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package validator
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/magiconair/properties"
+)
+
+// parseProperties parses a Java .properties file with magiconair/properties.
+// ${key} references are kept as they are rather than expanded, as the
+// application reading the file may expand them itself.
+func parseProperties(text string) (map[string]interface{}, error) {
+	if !utf8.ValidString(text) {
+		return nil, errors.New("not valid UTF-8")
+	}
+	loader := &properties.Loader{Encoding: properties.UTF8, DisableExpansion: true}
+	parsed, err := loader.LoadBytes([]byte(text))
+	if err != nil {
+		// "properties: Line 2: ..." becomes "line 2: ...".
+		message := strings.TrimPrefix(err.Error(), "properties: ")
+		return nil, errors.New(strings.Replace(message, "Line ", "line ", 1))
+	}
+	props := make(map[string]interface{}, parsed.Len())
+	for _, key := range parsed.Keys() {
+		props[key], _ = parsed.Get(key)
+	}
+	return props, nil
+}
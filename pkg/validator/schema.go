@@ -0,0 +1,120 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// schemaURL names the schema being compiled; references to it resolve within
+// the schema itself.
+const schemaURL = "mem:///schema.json"
+
+// Schema is a JSON Schema, of the draft given by its $schema or 2020-12.
+// Every keyword of the draft is supported, format included. $ref may only
+// point within the schema: nothing is loaded from files or the network.
+type Schema struct {
+	schema *jsonschema.Schema
+}
+
+// SchemaError is a document failing its schema.
+type SchemaError struct {
+	// Path is the JSON pointer of the failing value, "" for the document.
+	Path    string
+	Message string
+}
+
+func (e *SchemaError) Error() string {
+	if e.Path == "" {
+		return "schema validation failed: " + e.Message
+	}
+	return fmt.Sprintf("schema validation failed at %s: %s", e.Path, e.Message)
+}
+
+// ParseSchema parses a JSON Schema written in JSON or YAML. A schema that is
+// not valid against the meta-schema of its draft fails here, rather than
+// passing every document.
+func ParseSchema(text string) (*Schema, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	doc, err := normalize(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("invalid schema: expected an object")
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("cannot load %s: $ref must point within the schema", url)
+	}
+	if err := compiler.AddResource(schemaURL, bytes.NewReader(b)); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	schema, err := compiler.Compile(schemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %s", schemaErrorMessage(err))
+	}
+	return &Schema{schema: schema}, nil
+}
+
+// schemaErrorMessage describes a schema failing to compile without the
+// prefixes of the library.
+func schemaErrorMessage(err error) string {
+	if se, ok := err.(*jsonschema.SchemaError); ok && se.Err != nil {
+		err = se.Err
+	}
+	if ve, ok := err.(*jsonschema.ValidationError); ok {
+		leaf := leafError(ve)
+		return fmt.Sprintf("%s: %s", pointerOrRoot(leaf.InstanceLocation), leaf.Message)
+	}
+	return strings.ReplaceAll(strings.TrimPrefix(err.Error(), "jsonschema: "), schemaURL, "")
+}
+
+// Validate validates a document with the types of encoding/json against the
+// schema. The error is a *SchemaError naming the first failing value.
+func (s *Schema) Validate(doc interface{}) error {
+	err := s.schema.Validate(doc)
+	if ve, ok := err.(*jsonschema.ValidationError); ok {
+		leaf := leafError(ve)
+		return &SchemaError{Path: leaf.InstanceLocation, Message: leaf.Message}
+	}
+	return err
+}
+
+// leafError returns the first innermost cause of err, which names the value
+// and the keyword that failed. anyOf and oneOf are reported themselves, with
+// the failure of their first branch.
+func leafError(err *jsonschema.ValidationError) *jsonschema.ValidationError {
+	for len(err.Causes) > 0 {
+		if strings.HasSuffix(err.KeywordLocation, "/anyOf") || strings.HasSuffix(err.KeywordLocation, "/oneOf") {
+			first := leafError(err.Causes[0])
+			return &jsonschema.ValidationError{
+				InstanceLocation: err.InstanceLocation,
+				Message:          err.Message + ": " + first.Message,
+			}
+		}
+		err = err.Causes[0]
+	}
+	return err
+}
+
+func pointerOrRoot(pointer string) string {
+	if pointer == "" {
+		return "/"
+	}
+	return pointer
+}
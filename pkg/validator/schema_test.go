@@ -0,0 +1,115 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ParseSchema(`
+type: object
+additionalProperties: false
+properties:
+  name: {type: string, minLength: 1, pattern: "^[a-z]+$"}
+  level: {enum: [debug, info]}
+  ratio: {type: number, exclusiveMinimum: 0}
+  tags: {type: array, maxItems: 2, items: {type: string}}
+  a/b: {type: [string, "null"]}
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		doc  interface{}
+		want string
+	}{
+		{map[string]interface{}{"name": "demo", "level": "info", "ratio": 0.5, "tags": []interface{}{"a"}, "a/b": nil}, ""},
+		{[]interface{}{}, "schema validation failed: expected object, but got array"},
+		{map[string]interface{}{"name": "Demo"}, "at /name: does not match pattern '^[a-z]+$'"},
+		{map[string]interface{}{"name": ""}, "at /name: length must be >= 1, but got 0"},
+		{map[string]interface{}{"level": "warn"}, `at /level: value must be one of "debug", "info"`},
+		{map[string]interface{}{"ratio": 0.0}, "at /ratio: must be > 0 but found 0"},
+		{map[string]interface{}{"tags": []interface{}{"a", 1.0}}, "at /tags/1: expected string, but got number"},
+		{map[string]interface{}{"tags": []interface{}{"a", "b", "c"}}, "at /tags: maximum 2 items required, but found 3 items"},
+		{map[string]interface{}{"a/b": 1.0}, "at /a~1b: expected string or null, but got number"},
+		{map[string]interface{}{"other": 1.0}, "additionalProperties 'other' not allowed"},
+	}
+	for _, tt := range tests {
+		err := schema.Validate(tt.doc)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Fatalf("%v: unexpected error: %v", tt.doc, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Fatalf("%v: expected error containing %q, got %v", tt.doc, tt.want, err)
+		}
+	}
+}
+
+func TestSchemaCombinators(t *testing.T) {
+	schema, err := ParseSchema(`{"oneOf": [{"type": "integer"}, {"type": "string"}], "anyOf": [{"minimum": 1}, {"type": "string"}]}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := schema.Validate(2.0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := schema.Validate(0.0); err == nil || !strings.Contains(err.Error(), "anyOf failed: must be >= 1 but found 0") {
+		t.Fatalf("expected anyOf to fail, got %v", err)
+	}
+	if err := schema.Validate(true); err == nil || !strings.Contains(err.Error(), "oneOf failed: expected integer, but got boolean") {
+		t.Fatalf("expected oneOf to fail, got %v", err)
+	}
+}
+
+func TestParseSchemaRejectsInvalidSchemas(t *testing.T) {
+	for _, text := range []string{
+		`[]`,
+		`{"type": 1}`,
+		`{"properties": {"a": {"pattern": "("}}}`,
+		`{"required": "a"}`,
+		`{"items": [1]}`,
+		`{"maximum": "10"}`,
+		`{"$ref": "#/$defs/missing"}`,
+		`{"$ref": "file:///etc/passwd"}`,
+		`{"$ref": "https://example.com/schema.json"}`,
+	} {
+		if _, err := ParseSchema(text); err == nil || !strings.HasPrefix(err.Error(), "invalid schema") {
+			t.Fatalf("%s: expected an invalid schema error, got %v", text, err)
+		}
+	}
+}
+
+func TestSchemaReferencesPatternsAndFormats(t *testing.T) {
+	schema, err := ParseSchema(`
+$defs:
+  port: {type: integer, minimum: 1, maximum: 65535}
+type: object
+properties:
+  port: {$ref: "#/$defs/port"}
+  admin: {type: string, format: email}
+patternProperties:
+  "^x-": {type: string}
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		doc  interface{}
+		want string
+	}{
+		{map[string]interface{}{"port": 8080.0, "admin": "ops@example.com", "x-team": "core"}, ""},
+		{map[string]interface{}{"port": 0.0}, "at /port: must be >= 1 but found 0"},
+		{map[string]interface{}{"admin": "ops"}, "at /admin: 'ops' is not valid 'email'"},
+		{map[string]interface{}{"x-team": 1.0}, "at /x-team: expected string, but got number"},
+	}
+	for _, tt := range tests {
+		err := schema.Validate(tt.doc)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Fatalf("%v: unexpected error: %v", tt.doc, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Fatalf("%v: expected error containing %q, got %v", tt.doc, tt.want, err)
+		}
+	}
+}
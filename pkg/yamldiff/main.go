@@ -41,3 +41,61 @@ func colorizeDiff(diff string) string {
 	}
 	return strings.Join(lines, "\n")
 }
+
+// Changes returns an uncolored diff from current to desired that keeps only
+// the changed lines and the lines of their parent keys. Removed lines are
+// prefixed with "-" and added lines with "+". It returns "" when both
+// documents are equal.
+func Changes(desired, current string) (string, error) {
+	yamlsDesired, err := Load(desired)
+	if err != nil {
+		return "", err
+	}
+	yamlsCurrent, err := Load(current)
+	if err != nil {
+		return "", err
+	}
+
+	var out []string
+	for _, diff := range Do(yamlsCurrent, yamlsDesired) {
+		if diff.Status() == DiffStatusSame {
+			continue
+		}
+		out = append(out, changedLines(diff.Dump())...)
+	}
+	return strings.Join(out, "\n"), nil
+}
+
+// changedLines filters a dump down to its changed lines, keeping the
+// unchanged lines they are nested under.
+func changedLines(dump string) []string {
+	type parent struct {
+		line    string
+		depth   int
+		emitted bool
+	}
+	var parents []parent
+	var out []string
+	for _, line := range strings.Split(dump, "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		body := line[2:]
+		depth := len(body) - len(strings.TrimLeft(body, " "))
+		for len(parents) > 0 && parents[len(parents)-1].depth >= depth {
+			parents = parents[:len(parents)-1]
+		}
+		if line[0] != '-' && line[0] != '+' {
+			parents = append(parents, parent{line: line, depth: depth})
+			continue
+		}
+		for i := range parents {
+			if !parents[i].emitted {
+				out = append(out, parents[i].line)
+				parents[i].emitted = true
+			}
+		}
+		out = append(out, line)
+	}
+	return out
+}
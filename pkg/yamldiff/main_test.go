@@ -0,0 +1,32 @@
+package yamldiff
+
+import "testing"
+
+func TestChangesKeepsChangedLinesAndParents(t *testing.T) {
+	current := "spec:\n  replicas: 1\n  containers:\n  - name: app\n    image: app:v1\n"
+	desired := "spec:\n  replicas: 1\n  containers:\n  - name: app\n    image: app:v2\n"
+
+	got, err := Changes(desired, current)
+	if err != nil {
+		t.Fatalf("Changes: %v", err)
+	}
+	want := "  spec:\n" +
+		"    containers:\n" +
+		"      -\n" +
+		"-       image: \"app:v1\"\n" +
+		"+       image: \"app:v2\""
+	if got != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestChangesEqualDocuments(t *testing.T) {
+	doc := "spec:\n  replicas: 1\n"
+	got, err := Changes(doc, doc)
+	if err != nil {
+		t.Fatalf("Changes: %v", err)
+	}
+	if got != "" {
+		t.Fatalf("expected no diff, got:\n%s", got)
+	}
+}